@@ -0,0 +1,179 @@
+package agent
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/daneroo/backblaze"
+)
+
+// Defaults for the Agent
+const (
+	DefaultBatchSize = 1000
+	DefaultRetries   = 5
+	DefaultBackoff   = time.Second // doubled after each failed attempt
+	DefaultTimeout   = 30 * time.Second
+)
+
+// Agent tails the transmitted logs of a host, spools the new records in batches,
+// and pushes the spooled batches to the receiver at URL.
+// Its state (the tailer's offsets and the next Seq) is saved in the spool directory,
+// after the batches are spooled, so a restart neither loses nor duplicates records.
+// An agent whose state is lost starts over as a new instance, with a new ID and Seq 1.
+type Agent struct {
+	Host      string
+	URL       string // of the receiver, e.g. http://central:8080/batches
+	Client    *http.Client
+	BatchSize int
+	Retries   int
+	Backoff   time.Duration
+	Progress  io.Writer // of the tailer, nil for none
+
+	spool Spool
+	state agentState
+}
+
+type agentState struct {
+	ID     string            `json:"id"`  // of this instance
+	Seq    int64             `json:"seq"` // of the next batch
+	Tailer *backblaze.Tailer `json:"tailer"`
+}
+
+// NewAgent returns an agent for the logs matching pattern, resuming from the state in spoolDir, if any
+func NewAgent(host, url, pattern, spoolDir string) (*Agent, error) {
+	a := &Agent{
+		Host:      host,
+		URL:       url,
+		Client:    &http.Client{Timeout: DefaultTimeout},
+		BatchSize: DefaultBatchSize,
+		Retries:   DefaultRetries,
+		Backoff:   DefaultBackoff,
+		spool:     Spool{Dir: spoolDir},
+		state:     agentState{Seq: 1, Tailer: backblaze.NewTailer(pattern)},
+	}
+	err := readJSONFile(a.statePath(), &a.state)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(a.state.ID) == 0 {
+		if a.state.ID, err = newID(); err != nil {
+			return nil, err
+		}
+	}
+	// the pattern may have changed (e.g. -bzdata), the offsets of other files are harmless
+	a.state.Tailer.Pattern = pattern
+	return a, nil
+}
+
+// newID is a random instance ID
+func newID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+func (a *Agent) statePath() string {
+	return filepath.Join(a.spool.Dir, "state.json")
+}
+
+// Poll spools the records appended to the logs since the last Poll, and returns how many.
+// The records are tailed with a copy of the state, which is only kept once all their batches are spooled
+// and it is saved: after a failure, the batches of this Poll are removed, and the next Poll reads them again.
+func (a *Agent) Poll() (int, error) {
+	state := a.state
+	state.Tailer = a.state.Tailer.Clone()
+	state.Tailer.Progress = a.Progress
+	records := make([]backblaze.Transmitted, 0)
+	if err := state.Tailer.Poll(func(tx backblaze.Transmitted) {
+		records = append(records, tx)
+	}); err != nil {
+		return 0, err
+	}
+	spooled := make([]int64, 0)
+	for from := 0; from < len(records); from += a.BatchSize {
+		to := from + a.BatchSize
+		if to > len(records) {
+			to = len(records)
+		}
+		if err := a.spool.Put(Batch{Host: a.Host, Agent: state.ID, Seq: state.Seq, Records: records[from:to]}); err != nil {
+			a.unspool(spooled)
+			return 0, err
+		}
+		spooled = append(spooled, state.Seq)
+		state.Seq++
+	}
+	if err := writeJSONFile(a.statePath(), state); err != nil {
+		a.unspool(spooled)
+		return 0, err
+	}
+	a.state = state
+	return len(records), nil
+}
+
+// unspool removes the batches of a failed Poll, which the next Poll spools again
+func (a *Agent) unspool(seqs []int64) {
+	for _, seq := range seqs {
+		a.spool.Remove(seq)
+	}
+}
+
+// Flush pushes the spooled batches, in order, and returns how many were accepted.
+// It stops at the first batch which could not be pushed, it stays spooled for the next Flush.
+func (a *Agent) Flush() (int, error) {
+	seqs, err := a.spool.Pending()
+	if err != nil {
+		return 0, err
+	}
+	for i, seq := range seqs {
+		batch, err := a.spool.Get(seq)
+		if err != nil {
+			return i, err
+		}
+		if err := a.push(batch); err != nil {
+			return i, err
+		}
+		if err := a.spool.Remove(seq); err != nil {
+			return i, err
+		}
+	}
+	return len(seqs), nil
+}
+
+// push posts a batch, retrying with exponential backoff
+func (a *Agent) push(batch Batch) error {
+	payload, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	backoff := a.Backoff
+	for attempt := 0; ; attempt++ {
+		err = a.post(payload)
+		if err == nil || attempt >= a.Retries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (a *Agent) post(payload []byte) error {
+	resp, err := a.Client.Post(a.URL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("push to %s: %s", a.URL, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package agent
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/daneroo/backblaze"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestAgentPushes(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	logs := filepath.Join(dir, "logs")
+	os.MkdirAll(logs, 0755)
+	sample, err := ioutil.ReadFile("../test/data/transmitted-sample.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(filepath.Join(logs, "17.log"), sample, 0644)
+
+	rcv := &Receiver{Dir: filepath.Join(dir, "received"), VizDir: filepath.Join(dir, "viz"), FlowDays: 30,
+		Now: func() time.Time { return time.Date(2018, 10, 20, 0, 0, 0, 0, time.UTC) }}
+	// the receiver is down for the first 2 attempts
+	var failures int32 = 2
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		rcv.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	spool := filepath.Join(dir, "spool")
+	a, err := NewAgent("galois", server.URL, filepath.Join(logs, "*.log"), spool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.BatchSize = 5
+	a.Retries = 0
+	a.Backoff = time.Millisecond
+	// 11 records, of which 4 dedup
+	if n, err := a.Poll(); n != 11 || err != nil {
+		t.Fatalf("expected 11 records, got %d, %v", n, err)
+	}
+	if pending, _ := a.spool.Pending(); !reflect.DeepEqual(pending, []int64{1, 2, 3}) {
+		t.Errorf("expected 3 spooled batches, got %v", pending)
+	}
+	if n, err := a.Flush(); n != 0 || err == nil {
+		t.Errorf("expected the first push to fail, got %d, %v", n, err)
+	}
+	// retried: fails once more, then succeeds
+	a.Retries = 2
+	if n, err := a.Flush(); n != 3 || err != nil {
+		t.Fatalf("expected 3 batches pushed, got %d, %v", n, err)
+	}
+	if pending, _ := a.spool.Pending(); len(pending) != 0 {
+		t.Errorf("expected an empty spool, got %v", pending)
+	}
+	records, err := rcv.Records("galois")
+	if err != nil || len(records) != 11 {
+		t.Fatalf("expected 11 records received, got %d, %v", len(records), err)
+	}
+	if want := backblaze.ParseTransmitedAll(strings.NewReader(string(sample))); !reflect.DeepEqual(records, want) {
+		t.Errorf("expected the records with their rates:\n%+v\ngot:\n%+v", want, records)
+	}
+	var flow []interface{}
+	if err := readJSONFile(filepath.Join(rcv.VizDir, "galoisFlow.json"), &flow); err != nil || len(flow) != 7 {
+		t.Errorf("expected 7 records sent in galoisFlow.json, got %d, %v", len(flow), err)
+	}
+	var hosts []string
+	if readJSONFile(filepath.Join(rcv.VizDir, "hosts.json"), &hosts); !reflect.DeepEqual(hosts, []string{"galois"}) {
+		t.Errorf("unexpected hosts.json: %v", hosts)
+	}
+
+	// a restarted agent resumes where it was
+	a, err = NewAgent("galois", server.URL, filepath.Join(logs, "*.log"), spool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := a.Poll(); n != 0 || err != nil {
+		t.Errorf("expected nothing new, got %d, %v", n, err)
+	}
+	f, _ := os.OpenFile(filepath.Join(logs, "17.log"), os.O_APPEND|os.O_WRONLY, 0644)
+	f.Write([]byte("2018-10-18 18:39:45 -  small  - throttle auto     11 -     8 kBits/sec - 1 bytes - /Volumes/Space/fake_filename_to_refresh_volume_dashboard.txt\n"))
+	f.Close()
+	if n, _ := a.Poll(); n != 1 || a.state.Seq != 5 {
+		t.Errorf("expected 1 new record in batch 4, got %d, next seq %d", n, a.state.Seq)
+	}
+}
+
+func TestAgentPollFails(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	logs := filepath.Join(dir, "logs")
+	os.MkdirAll(logs, 0755)
+	sample, err := ioutil.ReadFile("../test/data/transmitted-sample.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(filepath.Join(logs, "17.log"), sample, 0644)
+
+	spool := filepath.Join(dir, "spool")
+	a, err := NewAgent("galois", "http://localhost", filepath.Join(logs, "*.log"), spool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.BatchSize = 5
+	// the spool is a file, so nothing can be spooled (as with a full disk)
+	ioutil.WriteFile(spool, nil, 0644)
+	if n, err := a.Poll(); n != 0 || err == nil {
+		t.Fatalf("expected the poll to fail, got %d, %v", n, err)
+	}
+	if a.state.Seq != 1 || len(a.state.Tailer.Offsets) != 0 {
+		t.Errorf("expected the state to be unchanged, got seq %d, offsets %v", a.state.Seq, a.state.Tailer.Offsets)
+	}
+	os.Remove(spool)
+	if n, err := a.Poll(); n != 11 || err != nil {
+		t.Fatalf("expected the 11 records on the next poll, got %d, %v", n, err)
+	}
+	if pending, _ := a.spool.Pending(); !reflect.DeepEqual(pending, []int64{1, 2, 3}) {
+		t.Errorf("expected 3 spooled batches, got %v", pending)
+	}
+}
+
+func TestReceiverIgnoresDuplicates(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	rcv := &Receiver{Dir: dir}
+	batch := Batch{Host: "galois", Seq: 1}
+	batch.Records = append(batch.Records, backblaze.Transmitted{Stamp: "2018-10-01 10:00:00", Size: 1, FName: "/a"})
+	if accepted, err := rcv.Receive(batch); !accepted || err != nil {
+		t.Fatalf("expected the batch to be accepted, got %v, %v", accepted, err)
+	}
+	if accepted, _ := rcv.Receive(batch); accepted {
+		t.Errorf("expected a duplicate batch to be ignored")
+	}
+	if records, _ := rcv.Records("galois"); len(records) != 1 {
+		t.Errorf("expected 1 record, got %d", len(records))
+	}
+
+	rec := httptest.NewRecorder()
+	rcv.ServeHTTP(rec, httptest.NewRequest("POST", "/batches", strings.NewReader(`{"host":"../etc","seq":1}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected a bad host to be rejected, got %d", rec.Code)
+	}
+	rcv.MaxBatchBytes = 10
+	rec = httptest.NewRecorder()
+	rcv.ServeHTTP(rec, httptest.NewRequest("POST", "/batches", strings.NewReader(`{"host":"galois","seq":2}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected a batch too large to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestReceiverNewAgent(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	now := func() time.Time { return time.Date(2018, 10, 20, 0, 0, 0, 0, time.UTC) }
+	rcv := &Receiver{Dir: dir, VizDir: filepath.Join(dir, "viz"), FlowDays: 30, Now: now}
+	record := func(name string) []backblaze.Transmitted {
+		return []backblaze.Transmitted{{Stamp: "2018-10-01 10:00:00", Size: 1, FName: name}}
+	}
+	if accepted, err := rcv.Receive(Batch{Host: "galois", Agent: "a", Seq: 5, Records: record("/a")}); !accepted || err != nil {
+		t.Fatalf("expected the batch to be accepted, got %v, %v", accepted, err)
+	}
+	// the agent lost its state, and starts over
+	if accepted, err := rcv.Receive(Batch{Host: "galois", Agent: "b", Seq: 1, Records: record("/b")}); !accepted || err != nil {
+		t.Errorf("expected the batch of a new agent to be accepted, got %v, %v", accepted, err)
+	}
+	if accepted, _ := rcv.Receive(Batch{Host: "galois", Agent: "b", Seq: 1, Records: record("/b")}); accepted {
+		t.Errorf("expected a duplicate batch to be ignored")
+	}
+
+	// a restarted receiver reads the window of records once
+	rcv = &Receiver{Dir: dir, VizDir: filepath.Join(dir, "viz"), FlowDays: 30, Now: now}
+	if accepted, err := rcv.Receive(Batch{Host: "galois", Agent: "b", Seq: 2, Records: record("/c")}); !accepted || err != nil {
+		t.Fatalf("expected the batch to be accepted, got %v, %v", accepted, err)
+	}
+	var flow []backblaze.Transmitted
+	if err := readJSONFile(filepath.Join(rcv.VizDir, "galoisFlow.json"), &flow); err != nil || len(flow) != 3 {
+		t.Errorf("expected 3 records in galoisFlow.json, got %d, %v", len(flow), err)
+	}
+}
+
+func TestNewAgentClient(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	a, err := NewAgent("galois", "http://localhost/batches", filepath.Join(dir, "*.log"), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Client.Timeout != DefaultTimeout || len(a.state.ID) == 0 {
+		t.Errorf("expected a client with a timeout and an instance ID, got %v, %q", a.Client.Timeout, a.state.ID)
+	}
+}
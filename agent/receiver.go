@@ -0,0 +1,238 @@
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/daneroo/backblaze"
+)
+
+// DefaultFlowDays is how many days of records are kept in <host>Flow.json, as in bzFlow
+const DefaultFlowDays = 20
+
+// DefaultMaxBatchBytes bounds the body of a batch, a few hundred bytes per record
+const DefaultMaxBatchBytes = 16 << 20
+
+var hostName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Receiver accepts the batches pushed by agents (POST), and stores their records per host,
+// in Dir/<host>/records.jsonl (rates included), along with the Seq and agent of the last batch (Dir/<host>/seq).
+// A batch larger than MaxBatchBytes (DefaultMaxBatchBytes if 0) is rejected.
+// A batch from another agent instance (whose state was lost) is accepted, its Seq starting over.
+// If VizDir is set, it also rewrites VizDir/<host>Flow.json (the records sent in the last FlowDays days),
+// and VizDir/hosts.json, the hosts the streamgraph offers.
+// The records of the window are kept in memory, records.jsonl is only read once per host.
+type Receiver struct {
+	Dir      string
+	VizDir   string
+	FlowDays int
+	Now      func() time.Time // time.Now if nil
+
+	MaxBatchBytes int64
+
+	mu    sync.Mutex
+	flows map[string][]backblaze.Transmitted // by host, the records of <host>Flow.json
+}
+
+// ServeHTTP accepts a batch
+func (rcv *Receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST a batch", http.StatusMethodNotAllowed)
+		return
+	}
+	limit := rcv.MaxBatchBytes
+	if limit == 0 {
+		limit = DefaultMaxBatchBytes
+	}
+	var batch Batch
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, limit)).Decode(&batch); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !hostName.MatchString(batch.Host) {
+		http.Error(w, fmt.Sprintf("invalid host: %q", batch.Host), http.StatusBadRequest)
+		return
+	}
+	accepted, err := rcv.Receive(batch)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(struct {
+		Accepted bool `json:"accepted"` // false for a batch already received
+	}{accepted})
+}
+
+// Receive stores a batch, unless it was already received
+func (rcv *Receiver) Receive(batch Batch) (bool, error) {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	hostDir := filepath.Join(rcv.Dir, batch.Host)
+	if err := os.MkdirAll(hostDir, 0755); err != nil {
+		return false, err
+	}
+	last, agent, err := readSeq(filepath.Join(hostDir, "seq"))
+	if err != nil {
+		return false, err
+	}
+	if batch.Seq <= last && batch.Agent == agent {
+		return false, nil
+	}
+	if len(rcv.VizDir) != 0 {
+		// loaded before the batch is appended
+		if err := rcv.loadFlow(batch.Host); err != nil {
+			return false, err
+		}
+	}
+	if err := appendRecords(filepath.Join(hostDir, "records.jsonl"), batch.Records); err != nil {
+		return false, err
+	}
+	seq := strconv.FormatInt(batch.Seq, 10)
+	if len(batch.Agent) != 0 {
+		seq += " " + batch.Agent
+	}
+	if err := ioutil.WriteFile(filepath.Join(hostDir, "seq"), []byte(seq), 0644); err != nil {
+		return false, err
+	}
+	if len(rcv.VizDir) != 0 {
+		if err := rcv.writeViz(batch.Host, batch.Records); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// readSeq reads the Seq and agent of the last batch, the agent is empty for older agents
+func readSeq(path string) (int64, string, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, "", nil
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, "", nil
+	}
+	seq, err := strconv.ParseInt(fields[0], 10, 64)
+	if len(fields) == 1 {
+		return seq, "", err
+	}
+	return seq, fields[1], err
+}
+
+func appendRecords(path string, records []backblaze.Transmitted) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	enc := json.NewEncoder(bw)
+	for _, tx := range records {
+		enc.Encode(backblaze.TransmittedRecord(tx))
+	}
+	err = bw.Flush()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Records reads the records stored for host
+func (rcv *Receiver) Records(host string) ([]backblaze.Transmitted, error) {
+	f, err := os.Open(filepath.Join(rcv.Dir, host, "records.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	records := make([]backblaze.Transmitted, 0)
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		var rec backblaze.TransmittedRecord
+		if err := dec.Decode(&rec); err != nil {
+			return records, err
+		}
+		records = append(records, backblaze.Transmitted(rec))
+	}
+	return records, nil
+}
+
+// Hosts are the hosts which pushed records, sorted
+func (rcv *Receiver) Hosts() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(rcv.Dir, "*", "records.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	hosts := make([]string, 0, len(files))
+	for _, file := range files {
+		hosts = append(hosts, filepath.Base(filepath.Dir(file)))
+	}
+	sort.Strings(hosts)
+	return hosts, nil
+}
+
+// loadFlow reads the window of host's records the first time the host is seen
+func (rcv *Receiver) loadFlow(host string) error {
+	if _, ok := rcv.flows[host]; ok {
+		return nil
+	}
+	if rcv.flows == nil {
+		rcv.flows = make(map[string][]backblaze.Transmitted)
+	}
+	records, err := rcv.Records(host)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	rcv.flows[host] = rcv.window(make([]backblaze.Transmitted, 0), records)
+	return nil
+}
+
+// window appends the records sent (no dedup) to flow, and drops those older than FlowDays
+func (rcv *Receiver) window(flow, records []backblaze.Transmitted) []backblaze.Transmitted {
+	now := time.Now()
+	if rcv.Now != nil {
+		now = rcv.Now()
+	}
+	days := rcv.FlowDays
+	if days == 0 {
+		days = DefaultFlowDays
+	}
+	minStamp := now.AddDate(0, 0, -days).Format("2006-01-02")
+	kept := flow[:0]
+	for _, tx := range flow {
+		if tx.Stamp >= minStamp {
+			kept = append(kept, tx)
+		}
+	}
+	for _, tx := range records {
+		if !tx.Dedup() && tx.Stamp >= minStamp {
+			kept = append(kept, tx)
+		}
+	}
+	return kept
+}
+
+// writeViz adds the records of a batch to host's window, and rewrites <host>Flow.json and hosts.json
+func (rcv *Receiver) writeViz(host string, records []backblaze.Transmitted) error {
+	rcv.flows[host] = rcv.window(rcv.flows[host], records)
+	if err := writeJSONFile(filepath.Join(rcv.VizDir, host+"Flow.json"), rcv.flows[host]); err != nil {
+		return err
+	}
+	hosts, err := rcv.Hosts()
+	if err != nil {
+		return err
+	}
+	return writeJSONFile(filepath.Join(rcv.VizDir, "hosts.json"), hosts)
+}
@@ -0,0 +1,115 @@
+// Package agent pushes the transmitted records of a host to a central receiver,
+// which stores them per host, and keeps the streamgraph data (viz/data/<host>Flow.json) up to date.
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/daneroo/backblaze"
+)
+
+// Batch is a numbered group of records from a host.
+// Seq increases with every batch of an Agent (its instance, see NewAgent),
+// so the receiver can ignore a batch it already has.
+// Its records are spooled and sent with all their fields, rates included (see backblaze.TransmittedRecord).
+type Batch struct {
+	Host    string                  `json:"host"`
+	Agent   string                  `json:"agent,omitempty"`
+	Seq     int64                   `json:"seq"`
+	Records []backblaze.Transmitted `json:"records"`
+}
+
+// batchWire is a Batch as json
+type batchWire struct {
+	Host    string                        `json:"host"`
+	Agent   string                        `json:"agent,omitempty"`
+	Seq     int64                         `json:"seq"`
+	Records []backblaze.TransmittedRecord `json:"records"`
+}
+
+// MarshalJSON writes the records with all their fields
+func (batch Batch) MarshalJSON() ([]byte, error) {
+	wire := batchWire{Host: batch.Host, Agent: batch.Agent, Seq: batch.Seq, Records: make([]backblaze.TransmittedRecord, len(batch.Records))}
+	for i, tx := range batch.Records {
+		wire.Records[i] = backblaze.TransmittedRecord(tx)
+	}
+	return json.Marshal(wire)
+}
+
+// UnmarshalJSON reads the records with all their fields
+func (batch *Batch) UnmarshalJSON(data []byte) error {
+	var wire batchWire
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+	*batch = Batch{Host: wire.Host, Agent: wire.Agent, Seq: wire.Seq, Records: make([]backblaze.Transmitted, len(wire.Records))}
+	for i, rec := range wire.Records {
+		batch.Records[i] = backblaze.Transmitted(rec)
+	}
+	return nil
+}
+
+// Spool is a directory of batches not yet accepted by the receiver, one file per batch,
+// named by Seq, so that spooling the same batch again replaces it.
+type Spool struct {
+	Dir string
+}
+
+func (s Spool) path(seq int64) string {
+	return filepath.Join(s.Dir, fmt.Sprintf("%020d.batch.json", seq))
+}
+
+// Put writes a batch to the spool
+func (s Spool) Put(batch Batch) error {
+	return writeJSONFile(s.path(batch.Seq), batch)
+}
+
+// Pending returns the sequence numbers of the spooled batches, in order
+func (s Spool) Pending() ([]int64, error) {
+	files, err := filepath.Glob(filepath.Join(s.Dir, "*.batch.json"))
+	if err != nil {
+		return nil, err
+	}
+	seqs := make([]int64, 0, len(files))
+	for _, file := range files {
+		var seq int64
+		if _, err := fmt.Sscanf(filepath.Base(file), "%d.batch.json", &seq); err == nil {
+			seqs = append(seqs, seq)
+		}
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	return seqs, nil
+}
+
+// Get reads a spooled batch
+func (s Spool) Get(seq int64) (Batch, error) {
+	var batch Batch
+	err := readJSONFile(s.path(seq), &batch)
+	return batch, err
+}
+
+// Remove removes a batch accepted by the receiver
+func (s Spool) Remove(seq int64) error {
+	return os.Remove(s.path(seq))
+}
+
+// writeJSONFile writes through a temporary file, so a crash never leaves half a file
+func writeJSONFile(path string, v interface{}) error {
+	return backblaze.WriteFileAtomic(path, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(v)
+	})
+}
+
+func readJSONFile(path string, v interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,394 @@
+package backblaze
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Counters are the totals of a host's transmissions over some time, which add up:
+// the distribution of the rates is kept whole (a count per rate), so percentiles merge exactly
+type Counters struct {
+	Records int         `json:"records"` // sent
+	Bytes   int64       `json:"bytes"`
+	Chunks  int         `json:"chunks"` // chunks of large files
+	Dedup   int         `json:"dedup"`  // records not sent
+	Rates   map[int]int `json:"rates,omitempty"`
+}
+
+func (c *Counters) add(tx Transmitted) {
+	if tx.Dedup() {
+		c.Dedup++
+		return
+	}
+	c.Records++
+	c.Bytes += int64(tx.Size)
+	if tx.Type == chunked {
+		c.Chunks++
+	}
+	if tx.Speed > 0 && countsRate(tx) {
+		if c.Rates == nil {
+			c.Rates = make(map[int]int)
+		}
+		c.Rates[tx.Speed]++
+	}
+}
+
+// Merge adds other to c
+func (c *Counters) Merge(other Counters) {
+	c.Records += other.Records
+	c.Bytes += other.Bytes
+	c.Chunks += other.Chunks
+	c.Dedup += other.Dedup
+	for rate, n := range other.Rates {
+		if c.Rates == nil {
+			c.Rates = make(map[int]int)
+		}
+		c.Rates[rate] += n
+	}
+}
+
+// Throughput summarizes the rates
+func (c Counters) Throughput() Throughput {
+	rates := make([]int, 0, len(c.Rates))
+	for rate := range c.Rates {
+		rates = append(rates, rate)
+	}
+	sort.Ints(rates)
+	total := 0
+	for _, rate := range rates {
+		total += c.Rates[rate]
+	}
+	if total == 0 {
+		return Throughput{}
+	}
+	// the nearest rank, as percentile, without expanding the counts
+	at := func(p float64) int {
+		rank := nearestRank(p, total)
+		for _, rate := range rates {
+			if rank < c.Rates[rate] {
+				return rate
+			}
+			rank -= c.Rates[rate]
+		}
+		return rates[len(rates)-1]
+	}
+	return Throughput{P50: at(50), P90: at(90), P99: at(99), Max: rates[len(rates)-1]}
+}
+
+// DayAggregate is what a host transmitted on a day (of its stamps, as logged):
+// the sizes sent below each directory, and counters for each hour of the day.
+// Aggregates of different days and hosts merge, see Rollup.
+type DayAggregate struct {
+	Host  string       `json:"host"`
+	Date  string       `json:"date"`
+	Dirs  *DirTree     `json:"dirs"`
+	Hours [24]Counters `json:"hours"`
+}
+
+// NewDayAggregate returns an empty aggregate
+func NewDayAggregate(host, date string) *DayAggregate {
+	return &DayAggregate{Host: host, Date: date, Dirs: NewDirTree()}
+}
+
+// Add counts a record of the aggregate's day, sent or dedup'd
+func (day *DayAggregate) Add(tx Transmitted) error {
+	t, err := time.Parse(StampLayout, tx.Stamp)
+	if err != nil {
+		return err
+	}
+	if t.Format(dateLayout) != day.Date {
+		return fmt.Errorf("%s is not on %s", tx.Stamp, day.Date)
+	}
+	day.Hours[t.Hour()].add(tx)
+	if !tx.Dedup() {
+		day.Dirs.Add(tx.FName, int64(tx.Size), false)
+	}
+	return nil
+}
+
+// Total is the sum of the hours
+func (day *DayAggregate) Total() Counters {
+	var total Counters
+	for _, hour := range day.Hours {
+		total.Merge(hour)
+	}
+	return total
+}
+
+// AggregateDays aggregates a host's records by day, sorted by date; it returns the number of unparsable stamps
+func AggregateDays(host string, xfrs []Transmitted) ([]*DayAggregate, int) {
+	days := make(map[string]*DayAggregate)
+	skipped := 0
+	for _, tx := range xfrs {
+		if len(tx.Stamp) < len(dateLayout) {
+			skipped++
+			continue
+		}
+		date := tx.Stamp[:len(dateLayout)]
+		day, ok := days[date]
+		if !ok {
+			day = NewDayAggregate(host, date)
+			days[date] = day
+		}
+		if err := day.Add(tx); err != nil {
+			skipped++
+		}
+	}
+	list := make([]*DayAggregate, 0, len(days))
+	for _, day := range days {
+		list = append(list, day)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Date < list[j].Date })
+	return list, skipped
+}
+
+// AggregateStore keeps the day aggregates, a file per host and day: Dir/<host>/<date>.json.
+// A run stores the days of the logs it read, replacing them, and keeps the older ones,
+// so reports over months do not need months of logs.
+type AggregateStore struct {
+	Dir string
+}
+
+func (store AggregateStore) path(host, date string) string {
+	return filepath.Join(store.Dir, host, date+".json")
+}
+
+// Put stores (or replaces) an aggregate
+func (store AggregateStore) Put(day *DayAggregate) error {
+	// through a temporary file, so a crash never leaves half a day
+	return WriteFileAtomic(store.path(day.Host, day.Date), func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(day)
+	})
+}
+
+// Get reads an aggregate
+func (store AggregateStore) Get(host, date string) (*DayAggregate, error) {
+	data, err := ioutil.ReadFile(store.path(host, date))
+	if err != nil {
+		return nil, err
+	}
+	day := NewDayAggregate(host, date)
+	return day, json.Unmarshal(data, day)
+}
+
+// Hosts are the hosts with stored aggregates, sorted
+func (store AggregateStore) Hosts() ([]string, error) {
+	files, err := ioutil.ReadDir(store.Dir)
+	if err != nil {
+		return nil, err
+	}
+	hosts := make([]string, 0, len(files))
+	for _, file := range files {
+		if file.IsDir() {
+			hosts = append(hosts, file.Name())
+		}
+	}
+	return hosts, nil
+}
+
+// Dates are the dates stored for host, in [from,to] (either may be empty, for no bound), sorted
+func (store AggregateStore) Dates(host, from, to string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(store.Dir, host, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	dates := make([]string, 0, len(files))
+	for _, file := range files {
+		date := strings.TrimSuffix(filepath.Base(file), ".json")
+		if (len(from) != 0 && date < from) || (len(to) != 0 && date > to) {
+			continue
+		}
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+	return dates, nil
+}
+
+// Query merges the aggregates of hosts (all if empty) between from and to (inclusive dates)
+func (store AggregateStore) Query(hosts []string, from, to string) (*Rollup, error) {
+	if len(hosts) == 0 {
+		var err error
+		if hosts, err = store.Hosts(); err != nil {
+			return nil, err
+		}
+	}
+	rollup := NewRollup()
+	for _, host := range hosts {
+		dates, err := store.Dates(host, from, to)
+		if err != nil {
+			return nil, err
+		}
+		for _, date := range dates {
+			day, err := store.Get(host, date)
+			if err != nil {
+				return nil, err
+			}
+			rollup.Add(day)
+		}
+	}
+	return rollup, nil
+}
+
+// Rollup is the merge of day aggregates, of one or many hosts
+type Rollup struct {
+	Hosts []string                 `json:"hosts"`
+	Dirs  *DirTree                 `json:"dirs"`
+	Days  map[string]*[24]Counters `json:"days"` // by date, then hour
+}
+
+// NewRollup returns an empty rollup
+func NewRollup() *Rollup {
+	return &Rollup{Hosts: make([]string, 0), Dirs: NewDirTree(), Days: make(map[string]*[24]Counters)}
+}
+
+// Add merges a day into the rollup
+func (rollup *Rollup) Add(day *DayAggregate) {
+	i := sort.SearchStrings(rollup.Hosts, day.Host)
+	if i == len(rollup.Hosts) || rollup.Hosts[i] != day.Host {
+		rollup.Hosts = append(rollup.Hosts, "")
+		copy(rollup.Hosts[i+1:], rollup.Hosts[i:])
+		rollup.Hosts[i] = day.Host
+	}
+	rollup.Dirs.Merge(day.Dirs)
+	hours, ok := rollup.Days[day.Date]
+	if !ok {
+		hours = &[24]Counters{}
+		rollup.Days[day.Date] = hours
+	}
+	for h := range day.Hours {
+		hours[h].Merge(day.Hours[h])
+	}
+}
+
+// CounterBucket is the total of a period, see Rollup.Buckets
+type CounterBucket struct {
+	Start      time.Time  `json:"start"`
+	Counters   Counters   `json:"counters"`
+	Throughput Throughput `json:"throughput"`
+}
+
+// Buckets totals the rollup by period (Hour, Day, Week or Month), from the first to the last day, zero filled.
+// The stamps are wall clock times, they are placed in loc (time.Local if nil).
+func (rollup *Rollup) Buckets(period string, loc *time.Location) ([]CounterBucket, error) {
+	switch period {
+	case Hour, Day, Week, Month:
+	default:
+		return nil, fmt.Errorf("unknown period: %q", period)
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+	buckets := make([]CounterBucket, 0)
+	if len(rollup.Days) == 0 {
+		return buckets, nil
+	}
+	dates := make([]string, 0, len(rollup.Days))
+	for date := range rollup.Days {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+	totals := make(map[int64]*Counters)
+	var first, last time.Time
+	for _, date := range dates {
+		day, err := time.ParseInLocation(dateLayout, date, loc)
+		if err != nil {
+			return nil, err
+		}
+		for h, hour := range rollup.Days[date] {
+			start := Truncate(time.Date(day.Year(), day.Month(), day.Day(), h, 0, 0, 0, loc), period)
+			if first.IsZero() || start.Before(first) {
+				first = start
+			}
+			if start.After(last) {
+				last = start
+			}
+			total, ok := totals[start.Unix()]
+			if !ok {
+				total = &Counters{}
+				totals[start.Unix()] = total
+			}
+			total.Merge(hour)
+		}
+	}
+	for start := first; !start.After(last); start = nextPeriod(start, period) {
+		bucket := CounterBucket{Start: start}
+		if total, ok := totals[start.Unix()]; ok {
+			bucket.Counters = *total
+			bucket.Throughput = total.Throughput()
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, nil
+}
+
+// RollupReport answers a query of the stored aggregates:
+// the totals of each period, and the directories which grew the most
+type RollupReport struct {
+	From    string          `json:"from"`
+	To      string          `json:"to"`
+	Hosts   []string        `json:"hosts"`
+	Period  string          `json:"period"`
+	Total   Counters        `json:"total"`
+	Buckets []CounterBucket `json:"buckets"`
+	TopDirs []GroupTotal    `json:"topDirs"`
+}
+
+// NewRollupReport buckets the rollup by period, and keeps its topN directories, by their first depth directories
+func NewRollupReport(rollup *Rollup, from, to, period string, loc *time.Location, depth, topN int) (*RollupReport, error) {
+	buckets, err := rollup.Buckets(period, loc)
+	if err != nil {
+		return nil, err
+	}
+	report := &RollupReport{From: from, To: to, Hosts: rollup.Hosts, Period: period, Buckets: buckets}
+	for i := range report.Buckets {
+		report.Total.Merge(report.Buckets[i].Counters)
+		report.Buckets[i].Counters.Rates = nil // summarized by Throughput
+	}
+	report.Total.Rates = nil
+	report.TopDirs = rollup.Dirs.GroupByDepth(depth)
+	if len(report.TopDirs) > topN {
+		report.TopDirs = report.TopDirs[:topN]
+	}
+	return report, nil
+}
+
+// WriteFormat writes the report as text or json
+func (report *RollupReport) WriteFormat(w io.Writer, format string) error {
+	switch format {
+	case FormatText:
+		return report.WriteText(w)
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	return fmt.Errorf("unknown format: %q", format)
+}
+
+// WriteText writes a table, with a row per period, then the top directories
+func (report *RollupReport) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "Rollup: %s [%s,%s] by %s: %s in %d files (%d dedup)\n", strings.Join(report.Hosts, ","),
+		report.From, report.To, report.Period, HumanBytes(report.Total.Bytes), report.Total.Records, report.Total.Dedup)
+	tw := tabwriter.NewWriter(bw, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "start\tsent\tfiles\tchunks\tdedup\tp50\tp90\tmax\t\n")
+	for _, b := range report.Buckets {
+		c := b.Counters
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t\n", b.Start.Format("2006-01-02 15:04"),
+			HumanBytes(c.Bytes), c.Records, c.Chunks, c.Dedup, b.Throughput.P50, b.Throughput.P90, b.Throughput.Max)
+	}
+	tw.Flush()
+	fmt.Fprintf(bw, "Top directories:\n")
+	for _, g := range report.TopDirs {
+		fmt.Fprintf(bw, " %10s %6d : %s\n", HumanBytes(int64(g.Size)), g.Count, g.Group)
+	}
+	return bw.Flush()
+}
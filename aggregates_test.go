@@ -0,0 +1,165 @@
+package backblaze
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCountersThroughput(t *testing.T) {
+	r := rand.New(rand.NewSource(42))
+	var merged Counters
+	rates := make([]int, 0)
+	for part := 0; part < 3; part++ {
+		var c Counters
+		for i := 0; i < 1+r.Intn(50); i++ {
+			rate := 1 + r.Intn(20)
+			c.add(Transmitted{Type: normal, Speed: rate})
+			rates = append(rates, rate)
+		}
+		merged.Merge(c)
+	}
+	if expected, got := NewThroughput(rates), merged.Throughput(); expected != got {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	if merged.Records != len(rates) {
+		t.Errorf("expected %d records, got %d", len(rates), merged.Records)
+	}
+}
+
+func TestAggregateDays(t *testing.T) {
+	xfrs := sampleTransmitted(t)
+	days, skipped := AggregateDays("galois", xfrs)
+	if skipped != 0 || len(days) != 3 {
+		t.Fatalf("expected 3 days, got %d (%d skipped)", len(days), skipped)
+	}
+	if days[0].Date != "2018-10-01" || days[2].Date != "2018-10-17" {
+		t.Errorf("unexpected days: %s..%s", days[0].Date, days[2].Date)
+	}
+	total := days[1].Total()
+	// 2018-10-02: 4 sent, 2 dedup'd
+	if total.Records != 4 || total.Dedup != 2 || total.Bytes != 26153736 {
+		t.Errorf("unexpected 2018-10-02 total: %+v", total)
+	}
+	if err := days[0].Add(Transmitted{Stamp: "2018-10-02 00:00:00"}); err == nil {
+		t.Errorf("expected an error for a record of another day")
+	}
+}
+
+func TestAggregateStoreQuery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aggregates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := AggregateStore{Dir: dir}
+
+	xfrs := sampleTransmitted(t)
+	// two runs, each with some of the records: the days of the second replace those of the first
+	days, _ := AggregateDays("galois", xfrs[:5])
+	for _, day := range days {
+		if err := store.Put(day); err != nil {
+			t.Fatal(err)
+		}
+	}
+	days, _ = AggregateDays("galois", xfrs)
+	for _, day := range days {
+		if err := store.Put(day); err != nil {
+			t.Fatal(err)
+		}
+	}
+	days, _ = AggregateDays("davinci", xfrs)
+	for _, day := range days {
+		if err := store.Put(day); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rollup, err := store.Query([]string{"galois"}, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the merged tree is the tree of all the records
+	sent := make([]Transmitted, 0)
+	for _, tx := range xfrs {
+		if !tx.Dedup() {
+			sent = append(sent, tx)
+		}
+	}
+	if expected, got := SummarizeBy(sent, DepthGrouper{Depth: 3}), rollup.Dirs.GroupByDepth(3); !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected:\n%v\ngot:\n%v", expected, got)
+	}
+	// and the buckets are the Aggregator's
+	agg, _ := NewAggregator(Day, time.UTC, nil)
+	agg.StampLocation = time.UTC
+	for _, tx := range sent {
+		agg.Add(tx)
+	}
+	buckets, err := rollup.Buckets(Day, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := agg.Buckets()
+	if len(buckets) != len(expected) {
+		t.Fatalf("expected %d buckets, got %d", len(expected), len(buckets))
+	}
+	for i, b := range buckets {
+		e := expected[i]
+		if !b.Start.Equal(e.Start) || b.Counters.Bytes != e.Bytes || b.Counters.Chunks != e.Chunks || b.Throughput != e.Throughput {
+			t.Errorf("expected %v, got %v", e, b)
+		}
+	}
+
+	// a date range, of both hosts
+	rollup, err = store.Query(nil, "2018-10-02", "2018-10-02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(rollup.Hosts, []string{"davinci", "galois"}) || len(rollup.Days) != 1 {
+		t.Errorf("unexpected rollup: %v %d days", rollup.Hosts, len(rollup.Days))
+	}
+	if rollup.Dirs.Root().Total.Bytes != 2*26153736 {
+		t.Errorf("unexpected total: %v", rollup.Dirs.Root().Total)
+	}
+}
+
+func TestRollupBucketsDST(t *testing.T) {
+	montreal, err := time.LoadLocation("America/Montreal")
+	if err != nil {
+		t.Skip(err)
+	}
+	// 2018-11-04 falls back: 01:00 is repeated, the day has 25 hours
+	day := NewDayAggregate("galois", "2018-11-04")
+	for _, stamp := range []string{"2018-11-04 00:30:00", "2018-11-04 01:30:00", "2018-11-04 23:30:00"} {
+		if err := day.Add(Transmitted{Stamp: stamp, Type: normal, Size: 1, FName: "/a"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rollup := NewRollup()
+	rollup.Add(day)
+	for period, expected := range map[string]int{Hour: 25, Day: 1, Week: 1, Month: 1} {
+		done := make(chan []CounterBucket, 1)
+		go func() {
+			buckets, _ := rollup.Buckets(period, montreal)
+			done <- buckets
+		}()
+		select {
+		case buckets := <-done:
+			if len(buckets) != expected {
+				t.Errorf("%s: expected %d buckets, got %d", period, expected, len(buckets))
+			}
+			records := 0
+			for _, b := range buckets {
+				records += b.Counters.Records
+			}
+			if records != 3 {
+				t.Errorf("%s: expected 3 records, got %d", period, records)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: Buckets did not return", period)
+		}
+	}
+}
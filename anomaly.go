@@ -0,0 +1,133 @@
+package backblaze
+
+import (
+	"math"
+	"sort"
+)
+
+// Kinds of Anomaly
+const (
+	SpikeAnomaly   = "spike"
+	DropAnomaly    = "drop"
+	StoppedAnomaly = "stopped" // nothing transmitted, on a usually active day
+)
+
+// Defaults for DetectAnomalies
+const (
+	DefaultAnomalyWindow    = 14  // days in the rolling baseline
+	DefaultAnomalyThreshold = 3.5 // robust z-score
+)
+
+// Anomaly is an unusual day for a group, compared to the rolling baseline of the days before it.
+// The json names match the streamgraph series (name,date,value), so they can be drawn as markers.
+type Anomaly struct {
+	Host   string  `json:"host,omitempty"`
+	Group  string  `json:"name"`
+	Date   string  `json:"date"`
+	Value  int     `json:"value"`
+	Median int     `json:"median"`
+	MAD    int     `json:"mad"`
+	Score  float64 `json:"score"`
+	Kind   string  `json:"kind"`
+}
+
+// DetectAnomalies compares each day of each group in a (zero filled) daily series,
+// to the median and MAD (median absolute deviation) of the window days before it.
+// The robust z-score is (value - median) / (1.4826 * MAD); when MAD is 0
+// (e.g. mostly idle groups), the mean absolute deviation stands in, and at least 1 byte.
+// Days with fewer than window/2 days of history are not judged.
+func DetectAnomalies(series []GroupTotal, window int, threshold float64) []Anomaly {
+	anomalies := make([]Anomaly, 0)
+	byGroup := make(map[string][]GroupTotal)
+	for _, total := range series {
+		byGroup[total.Group] = append(byGroup[total.Group], total)
+	}
+	minHistory := window / 2
+	if minHistory < 1 {
+		minHistory = 1
+	}
+	for _, group := range sortedGroups(byGroup) {
+		days := byGroup[group]
+		sort.SliceStable(days, func(i, j int) bool { return days[i].Date < days[j].Date })
+		for i, day := range days {
+			if i < minHistory {
+				continue
+			}
+			from := i - window
+			if from < 0 {
+				from = 0
+			}
+			baseline := make([]float64, 0, i-from)
+			for _, d := range days[from:i] {
+				baseline = append(baseline, float64(d.Size))
+			}
+			median, mad, scale := robustScale(baseline)
+			score := (float64(day.Size) - median) / scale
+			kind := ""
+			switch {
+			case day.Size == 0 && median > 0:
+				kind = StoppedAnomaly
+			case score > threshold:
+				kind = SpikeAnomaly
+			case score < -threshold:
+				kind = DropAnomaly
+			}
+			if kind == "" {
+				continue
+			}
+			anomalies = append(anomalies, Anomaly{
+				Group:  group,
+				Date:   day.Date,
+				Value:  day.Size,
+				Median: int(median),
+				MAD:    int(mad),
+				Score:  math.Round(score*100) / 100,
+				Kind:   kind,
+			})
+		}
+	}
+	sort.SliceStable(anomalies, func(i, j int) bool { return anomalies[i].Date < anomalies[j].Date })
+	return anomalies
+}
+
+func sortedGroups(byGroup map[string][]GroupTotal) []string {
+	groups := make([]string, 0, len(byGroup))
+	for group := range byGroup {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// robustScale returns the median and MAD of values, and the scale of the robust z-score
+func robustScale(values []float64) (median, mad, scale float64) {
+	median = medianOf(values)
+	deviations := make([]float64, 0, len(values))
+	meanDeviation := 0.0
+	for _, v := range values {
+		deviations = append(deviations, math.Abs(v-median))
+		meanDeviation += math.Abs(v - median)
+	}
+	mad = medianOf(deviations)
+	scale = 1.4826 * mad
+	if scale == 0 && len(values) > 0 {
+		scale = 1.2533 * meanDeviation / float64(len(values))
+	}
+	if scale < 1 {
+		scale = 1
+	}
+	return median, mad, scale
+}
+
+// medianOf returns the median of values, which it sorts in place
+func medianOf(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sort.Float64s(values)
+	n := len(values)
+	if n%2 == 1 {
+		return values[n/2]
+	}
+	return (values[n/2-1] + values[n/2]) / 2
+}
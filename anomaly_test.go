@@ -0,0 +1,90 @@
+package backblaze
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// series of one group, one value per day from 2018-10-01
+func anomalySeries(group string, values ...int) []GroupTotal {
+	series := make([]GroupTotal, 0, len(values))
+	for i, v := range values {
+		series = append(series, GroupTotal{Group: group, Date: fmt.Sprintf("2018-10-%02d", i+1), Size: v})
+	}
+	return series
+}
+
+func TestDetectAnomalies(t *testing.T) {
+	var data = []struct {
+		name   string
+		series []GroupTotal
+		out    []Anomaly
+	}{
+		{
+			name:   "Steady",
+			series: anomalySeries("/", 100, 110, 90, 100, 105, 95, 100, 100),
+			out:    []Anomaly{},
+		},
+		{
+			name:   "Spike",
+			series: anomalySeries("/", 100, 110, 90, 100, 105, 95, 100, 5000),
+			out: []Anomaly{
+				{Group: "/", Date: "2018-10-08", Value: 5000, Median: 100, MAD: 5, Score: 661, Kind: SpikeAnomaly},
+			},
+		},
+		{
+			name:   "Stopped",
+			series: anomalySeries("/", 100, 110, 90, 100, 105, 95, 100, 0),
+			out: []Anomaly{
+				{Group: "/", Date: "2018-10-08", Value: 0, Median: 100, MAD: 5, Score: -13.49, Kind: StoppedAnomaly},
+			},
+		},
+		{
+			name:   "Drop",
+			series: anomalySeries("/", 100, 110, 90, 100, 105, 95, 100, 40),
+			out: []Anomaly{
+				{Group: "/", Date: "2018-10-08", Value: 40, Median: 100, MAD: 5, Score: -8.09, Kind: DropAnomaly},
+			},
+		},
+		{
+			name:   "IdleGroupNewVM",
+			series: anomalySeries("/VMs/", 0, 0, 0, 0, 0, 0, 0, 1<<30),
+			out: []Anomaly{
+				{Group: "/VMs/", Date: "2018-10-08", Value: 1 << 30, Median: 0, MAD: 0, Score: 1 << 30, Kind: SpikeAnomaly},
+			},
+		},
+		{
+			name:   "NotEnoughHistory",
+			series: anomalySeries("/", 100, 5000),
+			out:    []Anomaly{},
+		},
+	}
+	for _, tt := range data {
+		got := DetectAnomalies(tt.series, DefaultAnomalyWindow, DefaultAnomalyThreshold)
+		if !reflect.DeepEqual(got, tt.out) {
+			t.Errorf("%s: expected\n%+v\ngot\n%+v", tt.name, tt.out, got)
+		}
+	}
+}
+
+func TestDetectAnomaliesWindow(t *testing.T) {
+	// the early spike is out of the 4 day window by the end, so the late one stands out again
+	series := anomalySeries("/", 10, 10, 10, 10000, 10, 10, 10, 10, 10, 10000)
+	got := DetectAnomalies(series, 4, DefaultAnomalyThreshold)
+	if len(got) != 2 || got[0].Date != "2018-10-04" || got[1].Date != "2018-10-10" {
+		t.Errorf("expected spikes on the 4th and 10th, got %+v", got)
+	}
+}
+
+func TestMedianOf(t *testing.T) {
+	if m := medianOf([]float64{3, 1, 2}); m != 2 {
+		t.Errorf("expected 2, got %v", m)
+	}
+	if m := medianOf([]float64{4, 1, 2, 3}); m != 2.5 {
+		t.Errorf("expected 2.5, got %v", m)
+	}
+	if m := medianOf(nil); m != 0 {
+		t.Errorf("expected 0, got %v", m)
+	}
+}
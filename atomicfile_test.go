@@ -0,0 +1,42 @@
+package backblaze
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atomic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "host", "day.json")
+	write := func(s string) func(io.Writer) error {
+		return func(w io.Writer) error {
+			_, err := io.WriteString(w, s)
+			return err
+		}
+	}
+	if err := WriteFileAtomic(path, write("good")); err != nil {
+		t.Fatal(err)
+	}
+	failed := errors.New("failed")
+	err = WriteFileAtomic(path, func(w io.Writer) error {
+		write("half")(w)
+		return failed
+	})
+	if err != failed {
+		t.Errorf("expected the write error, got %v", err)
+	}
+	if data, _ := ioutil.ReadFile(path); string(data) != "good" {
+		t.Errorf("expected a failed write to keep the file, got %q", data)
+	}
+	if files, _ := ioutil.ReadDir(filepath.Dir(path)); len(files) != 1 {
+		t.Errorf("expected no temporary file left, got %d files", len(files))
+	}
+}
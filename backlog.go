@@ -0,0 +1,138 @@
+package backblaze
+
+import (
+	"fmt"
+	"io"
+)
+
+// BacklogLists are the fileids and the filelists of a snapshot, each sorted, to be compared with MergeDiff:
+// the fileids are paths, the filelists are SortLines (path and size), so InBoth is a file backed up,
+// OnlyInA a file missing on disk, and OnlyInB a file not backed up (yet).
+type BacklogLists struct {
+	FileIds   *SortedLines
+	FileLists *SortedLines
+	Rules     ExclusionRules // of the snapshot, see ReadExclusionRules
+}
+
+// Close releases the sorted lists
+func (lists BacklogLists) Close() error {
+	err := lists.FileIds.Close()
+	if lerr := lists.FileLists.Close(); err == nil {
+		err = lerr
+	}
+	return err
+}
+
+// Diff streams both lists (see MergeDiff), only the differences are kept in memory:
+// each file is passed to backedUp, missingOnDisk or notBackedUp, which may be nil
+func (lists BacklogLists) Diff(backedUp func(path string, size int64), missingOnDisk func(path string), notBackedUp func(path string, size int64)) error {
+	return MergeDiff(lists.FileIds, lists.FileLists, func(side DiffSide, a, b string) {
+		switch {
+		case side == InBoth && backedUp != nil:
+			backedUp(ParseSortLine(b))
+		case side == OnlyInA && missingOnDisk != nil:
+			missingOnDisk(a)
+		case side == OnlyInB && notBackedUp != nil:
+			notBackedUp(ParseSortLine(b))
+		}
+	})
+}
+
+// ListSorter sorts the fileids and the filelists of a snapshot:
+// both lists are about 2 million paths each, so they are sorted externally
+type ListSorter struct {
+	MemoryBudget int       // per sorted list, see Sorter
+	TempDir      string    // for the sort runs
+	Progress     io.Writer // a few lines per file, nil for none
+}
+
+// Sort sorts the lists of src, and reads its exclusion rules.
+// It fails if src has no fileids (see FileIds)
+func (ls ListSorter) Sort(src DataSource) (BacklogLists, error) {
+	var lists BacklogLists
+	fileIds, err := FileIds(src)
+	if err != nil {
+		return lists, err
+	}
+	if lists.Rules, err = ReadExclusionRules(src); err != nil {
+		return lists, err
+	}
+	sorter := NewSorter(ls.MemoryBudget, ls.TempDir)
+	err = ls.parse(fileIds, sorter, func(add func(string)) (int, error) {
+		return ReadFileIds(src, func(id, path string) { add(path) })
+	})
+	if err != nil {
+		discard(sorter)
+		return lists, err
+	}
+	if lists.FileIds, err = ls.sort(sorter); err != nil {
+		return lists, err
+	}
+
+	if lists.FileLists, err = ls.sortFileLists(src); err != nil {
+		lists.FileIds.Close()
+		return BacklogLists{}, err
+	}
+	return lists, nil
+}
+
+func (ls ListSorter) sortFileLists(src DataSource) (*SortedLines, error) {
+	files, err := FileLists(src)
+	if err != nil {
+		return nil, err
+	}
+	sorter := NewSorter(ls.MemoryBudget, ls.TempDir)
+	for _, file := range files {
+		err := ls.parse(file, sorter, func(add func(string)) (int, error) {
+			return ReadFileList(src, file, func(entry FileListEntry) { add(entry.SortLine()) })
+		})
+		if err != nil {
+			discard(sorter)
+			return nil, err
+		}
+	}
+	return ls.sort(sorter)
+}
+
+// discard removes the runs already spilled by sorter
+func discard(sorter *Sorter) {
+	if sorted, err := sorter.Sort(); err == nil {
+		sorted.Close()
+	}
+}
+
+// parse adds the lines read from name to sorter
+func (ls ListSorter) parse(name string, sorter *Sorter, read func(add func(string)) (skipped int, err error)) error {
+	ls.progress("-= Parsing %s\n", name)
+	lines := 0
+	var addErr error
+	skipped, err := read(func(line string) {
+		if addErr == nil {
+			addErr = sorter.Add(line)
+			lines++
+		}
+	})
+	ls.progress("-= Parsed %d lines (%d skipped)\n", lines, skipped)
+	if err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	return addErr
+}
+
+// sort happens as the lines are consumed, so uniq'd counts are only known once drained
+func (ls ListSorter) sort(sorter *Sorter) (*SortedLines, error) {
+	// Sort resets the runs
+	added, runs := sorter.Added(), sorter.Runs()
+	sorted, err := sorter.Sort()
+	if err != nil {
+		return nil, err
+	}
+	ls.progress("-= Sorted %d lines (%d runs spilled)\n", added, runs)
+	return sorted, nil
+}
+
+func (ls ListSorter) progress(format string, a ...interface{}) {
+	if ls.Progress != nil {
+		fmt.Fprintf(ls.Progress, format, a...)
+	}
+}
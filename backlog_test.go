@@ -0,0 +1,43 @@
+package backblaze
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestListSorter(t *testing.T) {
+	src := memSource(t)
+	defer src.Close()
+	var progress bytes.Buffer
+	lists, err := ListSorter{MemoryBudget: 1 << 20, Progress: &progress}.Sort(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lists.Close()
+	counts := make(map[DiffSide]int)
+	err = lists.Diff(
+		func(path string, size int64) { counts[InBoth]++ },
+		func(path string) { counts[OnlyInA]++ },
+		func(path string, size int64) { counts[OnlyInB]++ })
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the fileids have 5 distinct paths
+	if counts[InBoth]+counts[OnlyInA] != 5 || counts[InBoth] == 0 || counts[OnlyInB] == 0 {
+		t.Errorf("unexpected diff: %v", counts)
+	}
+	if len(lists.Rules) < len(DefaultExclusionRules()) {
+		t.Errorf("expected at least the default rules, got %v", lists.Rules)
+	}
+	if !strings.Contains(progress.String(), "-= Parsing "+FileIdsFile+"\n") {
+		t.Errorf("unexpected progress:\n%s", progress.String())
+	}
+
+	if _, err := (ListSorter{}).Sort(NewSource("empty", fstest.MapFS{})); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected a not exist error without fileids, got %v", err)
+	}
+}
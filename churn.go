@@ -0,0 +1,214 @@
+package backblaze
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// DefaultSessionGap separates two uploads of the same chunked file:
+// chunks closer than this belong to the same upload, unless a chunk number repeats
+const DefaultSessionGap = time.Hour
+
+// ChurnReport ranks the paths which are uploaded again and again,
+// by the bytes actually sent for them
+type ChurnReport struct {
+	Paths    int         `json:"paths"`    // distinct paths transmitted
+	Churning int         `json:"churning"` // paths uploaded at least minUploads times
+	Bytes    int64       `json:"bytes"`    // sent for the churning paths
+	Files    []ChurnFile `json:"files"`
+
+	minUploads int
+	sessionGap time.Duration
+	records    map[string][]churnRecord
+	skipped    int
+}
+
+// ChurnFile is a path's upload history.
+// An upload is a single record, or for chunked files, a run of chunks (see DefaultSessionGap).
+// Sent and Deduped count records (chunks), Interval is the median time between uploads.
+type ChurnFile struct {
+	Path       string  `json:"path"`
+	Uploads    int     `json:"uploads"`
+	Sent       int     `json:"sent"`
+	Deduped    int     `json:"deduped"`
+	DedupShare float64 `json:"dedupShare"`
+	Bytes      int64   `json:"bytes"`
+	Interval   int64   `json:"interval"` // seconds
+	First      string  `json:"first"`
+	Last       string  `json:"last"`
+}
+
+type churnRecord struct {
+	stamp   string
+	t       time.Time
+	chunk   int
+	chunked bool
+	dedup   bool
+	size    int
+}
+
+// NewChurnReport returns an empty report, which will keep paths uploaded at least minUploads times
+func NewChurnReport(minUploads int, sessionGap time.Duration) *ChurnReport {
+	return &ChurnReport{
+		Files:      make([]ChurnFile, 0),
+		minUploads: minUploads,
+		sessionGap: sessionGap,
+		records:    make(map[string][]churnRecord),
+	}
+}
+
+// Add considers a record, sent or dedup'd (see ParseTransmitedAll)
+func (report *ChurnReport) Add(tx Transmitted) {
+	t, err := ParseStamp(tx.Stamp, time.UTC) // only the differences matter
+	if err != nil {
+		report.skipped++
+		return
+	}
+	report.records[tx.FName] = append(report.records[tx.FName], churnRecord{
+		stamp:   tx.Stamp,
+		t:       t,
+		chunk:   tx.Chunk,
+		chunked: tx.Chunked(),
+		dedup:   tx.Dedup(),
+		size:    tx.Size,
+	})
+}
+
+// Skipped is the number of records with an unparsable stamp
+func (report *ChurnReport) Skipped() int {
+	return report.skipped
+}
+
+// Rank splits each path's records into uploads, and keeps the topN churning paths,
+// by bytes sent, then by number of uploads
+func (report *ChurnReport) Rank(topN int) {
+	report.Paths = len(report.records)
+	report.Churning = 0
+	report.Bytes = 0
+	report.Files = make([]ChurnFile, 0)
+	for path, records := range report.records {
+		cf := report.history(path, records)
+		if cf.Uploads < report.minUploads {
+			continue
+		}
+		report.Churning++
+		report.Bytes += cf.Bytes
+		report.Files = append(report.Files, cf)
+	}
+	sort.Slice(report.Files, func(i, j int) bool {
+		a, b := report.Files[i], report.Files[j]
+		if a.Bytes != b.Bytes {
+			return a.Bytes > b.Bytes
+		}
+		if a.Uploads != b.Uploads {
+			return a.Uploads > b.Uploads
+		}
+		return a.Path < b.Path
+	})
+	if len(report.Files) > topN {
+		report.Files = report.Files[:topN]
+	}
+}
+
+func (report *ChurnReport) history(path string, records []churnRecord) ChurnFile {
+	sort.SliceStable(records, func(i, j int) bool { return records[i].stamp < records[j].stamp })
+	cf := ChurnFile{Path: path, First: records[0].stamp, Last: records[len(records)-1].stamp}
+	starts := make([]time.Time, 0)
+	var last time.Time
+	var chunks map[int]bool
+	for _, rec := range records {
+		newUpload := !rec.chunked || len(starts) == 0 || chunks[rec.chunk] || rec.t.Sub(last) > report.sessionGap
+		if newUpload {
+			starts = append(starts, rec.t)
+			chunks = make(map[int]bool)
+		}
+		chunks[rec.chunk] = true
+		last = rec.t
+		if rec.dedup {
+			cf.Deduped++
+		} else {
+			cf.Sent++
+			cf.Bytes += int64(rec.size)
+		}
+	}
+	cf.Uploads = len(starts)
+	cf.DedupShare = float64(cf.Deduped) / float64(cf.Sent+cf.Deduped)
+	if len(starts) > 1 {
+		intervals := make([]time.Duration, 0, len(starts)-1)
+		for i := 1; i < len(starts); i++ {
+			intervals = append(intervals, starts[i].Sub(starts[i-1]))
+		}
+		sort.Slice(intervals, func(i, j int) bool { return intervals[i] < intervals[j] })
+		cf.Interval = int64(intervals[len(intervals)/2].Seconds())
+	}
+	return cf
+}
+
+// WriteFormat writes the report in one of the Format* formats
+func (report *ChurnReport) WriteFormat(w io.Writer, format string) error {
+	switch format {
+	case FormatText:
+		return report.WriteText(w)
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	case FormatJSONL:
+		return report.WriteJSONL(w)
+	case FormatCSV:
+		return report.WriteCSV(w)
+	}
+	return fmt.Errorf("unknown format: %q", format)
+}
+
+// WriteJSONL writes the summary, then one line per file, each with a "record" field (summary,file)
+func (report *ChurnReport) WriteJSONL(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	enc.Encode(struct {
+		Record   string `json:"record"`
+		Paths    int    `json:"paths"`
+		Churning int    `json:"churning"`
+		Bytes    int64  `json:"bytes"`
+	}{"summary", report.Paths, report.Churning, report.Bytes})
+	for _, cf := range report.Files {
+		enc.Encode(struct {
+			Record string `json:"record"`
+			ChurnFile
+		}{"file", cf})
+	}
+	return bw.Flush()
+}
+
+// WriteCSV writes the files, with a header: path,uploads,sent,deduped,dedupShare,bytes,intervalSeconds,first,last
+func (report *ChurnReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"path", "uploads", "sent", "deduped", "dedupShare", "bytes", "intervalSeconds", "first", "last"})
+	for _, cf := range report.Files {
+		cw.Write([]string{cf.Path, strconv.Itoa(cf.Uploads), strconv.Itoa(cf.Sent), strconv.Itoa(cf.Deduped),
+			strconv.FormatFloat(cf.DedupShare, 'f', 3, 64), strconv.FormatInt(cf.Bytes, 10),
+			strconv.FormatInt(cf.Interval, 10), cf.First, cf.Last})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteText writes the report for humans
+func (report *ChurnReport) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "Churn: %d of %d paths uploaded repeatedly, %s sent\n", report.Churning, report.Paths, HumanBytes(report.Bytes))
+	if len(report.Files) > 0 {
+		fmt.Fprintf(bw, "Churn: (uploads sent bytes dedup%% every : path)\n")
+		for _, cf := range report.Files {
+			fmt.Fprintf(bw, " %6d %8d %10s %5.1f%% %10s : %s\n",
+				cf.Uploads, cf.Sent, HumanBytes(cf.Bytes), 100*cf.DedupShare, time.Duration(cf.Interval)*time.Second, cf.Path)
+		}
+	}
+	return bw.Flush()
+}
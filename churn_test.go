@@ -0,0 +1,134 @@
+package backblaze
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func churnSample() *ChurnReport {
+	const qcow = "/Users/daniel/Library/Containers/com.docker.docker/Data/vms/0/Docker.qcow2"
+	const history = "/Users/daniel/.bash_sessions/A.historynew"
+	report := NewChurnReport(2, DefaultSessionGap)
+	for _, tx := range []Transmitted{
+		// 3 uploads of history, every 12h, one of them dedup'd
+		{Type: normal, Stamp: "2018-10-01 00:00:00", Size: 100, FName: history},
+		{Type: dedup, Stamp: "2018-10-01 12:00:00", FName: history},
+		{Type: normal, Stamp: "2018-10-02 00:00:00", Size: 100, FName: history},
+		// qcow: 2 uploads, the second restarts at chunk 1 within the session gap
+		{Type: chunked, Stamp: "2018-10-01 10:00:00", Size: 1000, Chunk: 1, FName: qcow},
+		{Type: chunked, Stamp: "2018-10-01 10:00:05", Size: 1000, Chunk: 2, FName: qcow},
+		{Type: dedupChunked, Stamp: "2018-10-01 10:00:06", Chunk: 3, FName: qcow},
+		{Type: chunked, Stamp: "2018-10-01 10:30:00", Size: 1000, Chunk: 1, FName: qcow},
+		// once only: not churning
+		{Type: normal, Stamp: "2018-10-01 10:00:00", Size: 1 << 20, FName: "/Volumes/Space/once.jpg"},
+	} {
+		report.Add(tx)
+	}
+	report.Rank(10)
+	return report
+}
+
+func TestChurnReport(t *testing.T) {
+	report := churnSample()
+	if report.Paths != 3 || report.Churning != 2 || report.Bytes != 3200 {
+		t.Errorf("unexpected summary: %d %d %d", report.Paths, report.Churning, report.Bytes)
+	}
+	if len(report.Files) != 2 {
+		t.Fatalf("expected 2 files, got %+v", report.Files)
+	}
+	qcow := report.Files[0]
+	if qcow.Uploads != 2 || qcow.Sent != 3 || qcow.Deduped != 1 || qcow.Bytes != 3000 ||
+		qcow.DedupShare != 0.25 || qcow.Interval != 1800 || qcow.First != "2018-10-01 10:00:00" {
+		t.Errorf("unexpected qcow: %+v", qcow)
+	}
+	history := report.Files[1]
+	if history.Uploads != 3 || history.Sent != 2 || history.Deduped != 1 || history.Bytes != 200 ||
+		history.Interval != int64(12*time.Hour/time.Second) || history.Last != "2018-10-02 00:00:00" {
+		t.Errorf("unexpected history: %+v", history)
+	}
+
+	report.Rank(1)
+	if len(report.Files) != 1 || report.Churning != 2 {
+		t.Errorf("expected the top file only: %+v", report.Files)
+	}
+}
+
+func TestChurnSessionGap(t *testing.T) {
+	report := NewChurnReport(1, time.Minute)
+	report.Add(Transmitted{Type: chunked, Stamp: "2018-10-01 10:00:00", Size: 1, Chunk: 0, FName: "/a"})
+	report.Add(Transmitted{Type: chunked, Stamp: "2018-10-01 10:00:30", Size: 1, Chunk: 1, FName: "/a"})
+	report.Add(Transmitted{Type: chunked, Stamp: "2018-10-01 10:05:00", Size: 1, Chunk: 2, FName: "/a"})
+	report.Rank(10)
+	if report.Files[0].Uploads != 2 || report.Files[0].Interval != 300 {
+		t.Errorf("expected 2 uploads, 5m apart: %+v", report.Files[0])
+	}
+}
+
+func TestChurnWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := churnSample().WriteFormat(&buf, FormatCSV); err != nil {
+		t.Fatal(err)
+	}
+	expected := `path,uploads,sent,deduped,dedupShare,bytes,intervalSeconds,first,last
+/Users/daniel/Library/Containers/com.docker.docker/Data/vms/0/Docker.qcow2,2,3,1,0.250,3000,1800,2018-10-01 10:00:00,2018-10-01 10:30:00
+/Users/daniel/.bash_sessions/A.historynew,3,2,1,0.333,200,43200,2018-10-01 00:00:00,2018-10-02 00:00:00
+`
+	if buf.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, buf.String())
+	}
+}
+
+func TestChurnEdgeCases(t *testing.T) {
+	var data = []struct {
+		name    string
+		in      []Transmitted
+		skipped int
+		paths   int
+	}{
+		{"empty", nil, 0, 0},
+		{"one record", []Transmitted{{Type: normal, Stamp: "2018-10-01 10:00:00", Size: 1, FName: "/a"}}, 0, 1},
+		{"unparsable stamps", []Transmitted{{Type: normal, Stamp: "2018-10-01", Size: 1, FName: "/a"}, {Type: normal, Stamp: "", Size: 1, FName: "/a"}}, 2, 0},
+	}
+	for _, tt := range data {
+		report := NewChurnReport(1, DefaultSessionGap)
+		for _, tx := range tt.in {
+			report.Add(tx)
+		}
+		report.Rank(10)
+		if report.Skipped() != tt.skipped || report.Paths != tt.paths || len(report.Files) != tt.paths {
+			t.Errorf("%s: unexpected skipped %d, paths %d, files %+v", tt.name, report.Skipped(), report.Paths, report.Files)
+		}
+		if len(report.Files) == 1 && (report.Files[0].Uploads != 1 || report.Files[0].Interval != 0) {
+			t.Errorf("%s: expected a single upload: %+v", tt.name, report.Files[0])
+		}
+		if err := report.WriteFormat(ioutil.Discard, FormatText); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+}
+
+func TestParseTransmitedAll(t *testing.T) {
+	infile, err := os.Open("./test/data/transmitted-sample.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer infile.Close()
+	all := ParseTransmitedAll(infile)
+	dedups := 0
+	for _, tx := range all {
+		if tx.Dedup() {
+			dedups++
+			if !strings.HasPrefix(tx.FName, "/") {
+				t.Errorf("unexpected dedup record: %#v", tx)
+			}
+		}
+	}
+	// the 7 sent records, and 4 dedup'd (2 of them chunked)
+	if len(all) != 11 || dedups != 4 {
+		t.Errorf("expected 11 records, 4 dedup'd, got %d, %d", len(all), dedups)
+	}
+}
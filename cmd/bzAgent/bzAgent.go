@@ -0,0 +1,108 @@
+package main
+
+// Keeps the streamgraph up to date, without cloning bzdata:
+// - bzAgent push: runs on each Mac, tails the transmitted logs, and pushes the new records
+// - bzAgent collect: runs centrally, receives them, and rewrites viz/data/<host>Flow.json
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/daneroo/backblaze"
+	"github.com/daneroo/backblaze/agent"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	switch os.Args[1] {
+	case "push":
+		push(os.Args[2:])
+	case "collect":
+		collect(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: bzAgent push|collect [flags] (-h for the flags)\n")
+	os.Exit(2)
+}
+
+func push(args []string) {
+	flags := flag.NewFlagSet("push", flag.ExitOnError)
+	bzdata := flags.String("bzdata", backblaze.LiveBzData, "Backblaze data directory")
+	server := flags.String("server", "http://localhost:8080/batches", "url of the collector")
+	host := flags.String("host", "", "name of this host (default: hostname)")
+	spool := flags.String("spool", "", "spool directory, for the batches not yet pushed (default: ~/.bzagent/spool)")
+	interval := flags.Duration("interval", time.Minute, "how often the logs are polled")
+	once := flags.Bool("once", false, "poll and push once, then exit")
+	flags.Parse(args)
+
+	if len(*host) == 0 {
+		name, err := os.Hostname()
+		if err != nil {
+			log.Fatal(err)
+		}
+		*host = name
+	}
+	if len(*spool) == 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			log.Fatal(err)
+		}
+		*spool = filepath.Join(home, ".bzagent", "spool")
+	}
+	a, err := agent.NewAgent(*host, *server, filepath.Join(*bzdata, backblaze.TransmittedLogsPattern), *spool)
+	if err != nil {
+		log.Fatal(err)
+	}
+	a.Progress = os.Stderr
+	for {
+		n, err := a.Poll()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "-= Poll failed: %v\n", err)
+		} else if n > 0 {
+			fmt.Fprintf(os.Stderr, "-= Spooled %d records\n", n)
+		}
+		pushed, err := a.Flush()
+		if pushed > 0 {
+			fmt.Fprintf(os.Stderr, "-= Pushed %d batches to %s\n", pushed, *server)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "-= Push failed, batches stay spooled: %v\n", err)
+		}
+		if *once {
+			if err != nil {
+				os.Exit(1)
+			}
+			return
+		}
+		time.Sleep(*interval)
+	}
+}
+
+func collect(args []string) {
+	flags := flag.NewFlagSet("collect", flag.ExitOnError)
+	listen := flags.String("listen", ":8080", "address to receive the batches on (POST /batches)")
+	dataDir := flags.String("data", "./data/agent", "directory the records are stored in, as <host>/records.jsonl")
+	vizDir := flags.String("viz", "./viz", "streamgraph directory, served on /, where data/<host>Flow.json are rewritten (empty: none)")
+	days := flags.Int("days", agent.DefaultFlowDays, "days of records in <host>Flow.json")
+	flags.Parse(args)
+
+	rcv := &agent.Receiver{Dir: *dataDir, FlowDays: *days}
+	http.Handle("/batches", rcv)
+	if len(*vizDir) != 0 {
+		rcv.VizDir = filepath.Join(*vizDir, "data")
+		http.Handle("/", http.FileServer(http.Dir(*vizDir)))
+	}
+	fmt.Fprintf(os.Stderr, "-= Receiving on http://%s/batches\n", *listen)
+	log.Fatal(http.ListenAndServe(*listen, nil))
+}
@@ -0,0 +1,171 @@
+package main
+
+// Attempts to answer the question:
+// - Has any host silently stopped backing up ?
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/daneroo/backblaze"
+)
+
+var bzdata = flag.String("bzdata", backblaze.LiveBzData, "bzdata directory, or a tar archive of one, more can be given as arguments (e.g. ./data/*/bzdata)")
+var maxTransmitted = flag.Duration("max-transmitted", backblaze.DefaultTransmittedMaxAge, "alert when nothing was transmitted for this long")
+var maxFilelist = flag.Duration("max-filelist", backblaze.DefaultFilelistMaxAge, "alert when the last filelist scan is older than this")
+var scanPattern = flag.String("scan", backblaze.DefaultScanPattern, "regex matching the event log lines of a filelist scan")
+var tz = flag.String("tz", "Local", "timezone the logs were written in")
+
+var notify = flag.String("notify", "stdout,exit", "comma separated notifiers: stdout, exit, smtp, webhook")
+var smtpAddr = flag.String("smtp", "localhost:25", "smtp notifier: server host:port")
+var smtpFrom = flag.String("smtp-from", "bzcheck@localhost", "smtp notifier: sender")
+var smtpTo = flag.String("smtp-to", "", "smtp notifier: comma separated recipients")
+var smtpUser = flag.String("smtp-user", "", "smtp notifier: user for PLAIN auth, the password is in $BZCHECK_SMTP_PASSWORD")
+var webhookURL = flag.String("webhook", "", "webhook notifier: url to post the json reports to")
+
+func main() {
+	flag.Parse()
+	loc, err := time.LoadLocation(*tz)
+	if err != nil {
+		log.Fatal(err)
+	}
+	scanRE, err := regexp.Compile(*scanPattern)
+	if err != nil {
+		log.Fatal(err)
+	}
+	dirs := append([]string{*bzdata}, flag.Args()...)
+	if flag.NArg() > 0 && !isFlagSet("bzdata") {
+		dirs = flag.Args()
+	}
+
+	now := time.Now()
+	reports := make([]*backblaze.StaleReport, 0, len(dirs))
+	for _, dir := range dirs {
+		reports = append(reports, check(dir, now, loc, scanRE))
+	}
+
+	exitCode := backblaze.ExitOK
+	failed := false
+	for _, name := range strings.Split(*notify, ",") {
+		notifier, exit := newNotifier(strings.TrimSpace(name))
+		if err := notifier.Notify(reports); err != nil {
+			fmt.Fprintf(os.Stderr, "-= Notifier %s failed: %v\n", name, err)
+			failed = true
+		}
+		if exit != nil {
+			exitCode = exit.Code
+		}
+	}
+	if failed && exitCode == backblaze.ExitOK {
+		exitCode = 1
+	}
+	os.Exit(exitCode)
+}
+
+// check adds a check that failed, rather than exiting, when the host's data cannot be read,
+// so that the notifiers hear about it
+func check(dir string, now time.Time, loc *time.Location, scanRE *regexp.Regexp) *backblaze.StaleReport {
+	host := backblaze.HostOf(dir)
+	fmt.Fprintf(os.Stderr, "-= Checking %s (%s)\n", host, dir)
+	report := backblaze.NewStaleReport(host, now)
+	src, err := backblaze.OpenSource(dir)
+	if err != nil {
+		report.Fail(backblaze.ReadCheck, err)
+		return report
+	}
+	defer src.Close()
+
+	// compressed logs (.gz, .zst, .bz2) are included
+	ingested, err := (&backblaze.Ingester{}).IngestSource(src)
+	if err != nil {
+		report.Fail(backblaze.TransmittedCheck, err)
+	} else {
+		report.Check(backblaze.TransmittedCheck, backblaze.LastTransmitted(ingested.Records, loc), *maxTransmitted)
+	}
+	for _, fe := range ingested.Errors {
+		// the live log may end with a line being written
+		var malformed *backblaze.MalformedError
+		if errors.As(fe.Err, &malformed) {
+			fmt.Fprintf(os.Stderr, "-= Skipped %v\n", fe)
+			continue
+		}
+		report.Fail(backblaze.ReadCheck, fe)
+	}
+
+	scanned, err := lastScan(src, loc, scanRE)
+	if err != nil {
+		report.Fail(backblaze.FilelistCheck, err)
+	} else {
+		report.Check(backblaze.FilelistCheck, scanned, *maxFilelist)
+	}
+	return report
+}
+
+// lastScan is the time of the latest filelist scan in the event logs of src, zero if none
+func lastScan(src backblaze.DataSource, loc *time.Location, scanRE *regexp.Regexp) (time.Time, error) {
+	var lastScan time.Time
+	files, err := backblaze.EventLogs(src)
+	if err != nil {
+		return lastScan, err
+	}
+	for _, file := range files {
+		infile, err := src.Open(file)
+		if err != nil {
+			return lastScan, err
+		}
+		last, err := backblaze.LastEvent(infile, scanRE, loc)
+		infile.Close()
+		if err != nil {
+			return lastScan, fmt.Errorf("%s: %v", file, err)
+		}
+		if last.After(lastScan) {
+			lastScan = last
+		}
+	}
+	return lastScan, nil
+}
+
+// newNotifier returns the named notifier, and the ExitCodeNotifier, if it is one
+func newNotifier(name string) (backblaze.Notifier, *backblaze.ExitCodeNotifier) {
+	switch name {
+	case "stdout":
+		return &backblaze.StdoutNotifier{W: os.Stdout}, nil
+	case "exit":
+		exit := &backblaze.ExitCodeNotifier{W: os.Stdout}
+		return exit, exit
+	case "smtp":
+		if len(*smtpTo) == 0 {
+			log.Fatal("smtp notifier: -smtp-to is required")
+		}
+		var auth smtp.Auth
+		if len(*smtpUser) != 0 {
+			host := strings.Split(*smtpAddr, ":")[0]
+			auth = smtp.PlainAuth("", *smtpUser, os.Getenv("BZCHECK_SMTP_PASSWORD"), host)
+		}
+		return &backblaze.SMTPNotifier{Addr: *smtpAddr, Auth: auth, From: *smtpFrom, To: strings.Split(*smtpTo, ",")}, nil
+	case "webhook":
+		if len(*webhookURL) == 0 {
+			log.Fatal("webhook notifier: -webhook is required")
+		}
+		return &backblaze.WebhookNotifier{URL: *webhookURL}, nil
+	}
+	log.Fatalf("unknown notifier: %q", name)
+	return nil, nil
+}
+
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
@@ -0,0 +1,45 @@
+package main
+
+// Attempts to answer the question:
+// - Which files are uploaded again and again, and should maybe be excluded ?
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/daneroo/backblaze"
+)
+
+var bzdata = flag.String("bzdata", backblaze.LiveBzData, "bzdata directory (e.g. ./data/galois/bzdata), or a tar archive of one (e.g. bzdata.tgz)")
+var minUploads = flag.Int("min", 2, "minimum number of uploads for a path to be reported")
+var sessionGap = flag.Duration("gap", backblaze.DefaultSessionGap, "chunks of a file closer than this are the same upload")
+var topN = flag.Int("top", 50, "number of paths to report")
+var format = flag.String("format", backblaze.FormatText, "output format: text, json, jsonl or csv")
+var output = flag.String("o", "", "output file (default: stdout), progress is always on stderr")
+
+func main() {
+	flag.Parse()
+
+	// the logs given as arguments, or those of -bzdata, compressed ones included
+	ingester := &backblaze.Ingester{KeepDedup: true, Progress: os.Stderr}
+	ingested := ingester.Ingest(flag.Args())
+	if flag.NArg() == 0 {
+		var err error
+		if ingested, err = ingester.IngestBzData(*bzdata); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	report := backblaze.NewChurnReport(*minUploads, *sessionGap)
+	for _, tx := range ingested.Records {
+		report.Add(tx)
+	}
+	report.Rank(*topN)
+	fmt.Fprintf(os.Stderr, "-= Churning: %d of %d paths (%s), skipped: %d\n",
+		report.Churning, report.Paths, backblaze.HumanBytes(report.Bytes), report.Skipped())
+	if err := backblaze.WriteReport(os.Stdout, report, *format, *output); err != nil {
+		log.Fatal(err)
+	}
+}
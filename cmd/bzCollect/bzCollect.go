@@ -0,0 +1,61 @@
+package main
+
+// Collects the Backblaze files the tools need, from the hosts of an inventory,
+// into ./data/<host>/bzdata (replaces scripts/clone.sh)
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/daneroo/backblaze/collect"
+)
+
+var inventory = flag.String("inventory", "inventory.txt", "hosts to collect from, one per line: name address [bzdata]")
+var dest = flag.String("data", "./data", "directory the hosts are collected into, as <host>/bzdata")
+var only = flag.String("host", "", "only collect this host")
+
+func main() {
+	flag.Parse()
+	hosts := parseInventory()
+	c := &collect.Collector{Dest: *dest}
+	failed := 0
+	for _, host := range hosts {
+		if len(*only) != 0 && host.Name != *only {
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "-= Collecting %s from %s:%s\n", host.Name, host.Address, host.BzData)
+		if err := collectHost(c, host); err != nil {
+			fmt.Fprintf(os.Stderr, "-= Failed %s: %v\n", host.Name, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func collectHost(c *collect.Collector, host collect.Host) error {
+	transport, err := collect.Dial(host)
+	if err != nil {
+		return err
+	}
+	defer transport.Close()
+	stats, err := c.Collect(host, transport)
+	fmt.Fprintf(os.Stderr, "-= %v\n", stats)
+	return err
+}
+
+func parseInventory() []collect.Host {
+	infile, err := os.Open(*inventory)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer infile.Close()
+	hosts, err := collect.ParseInventory(infile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return hosts
+}
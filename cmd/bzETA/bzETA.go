@@ -0,0 +1,65 @@
+package main
+
+// Attempts to answer the question:
+// - When will the (initial) upload be done ?
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/daneroo/backblaze"
+)
+
+var bzdata = flag.String("bzdata", backblaze.LiveBzData, "bzdata directory (e.g. ./data/galois/bzdata), or a tar archive of one (e.g. bzdata.tgz)")
+var window = flag.Int("window", backblaze.DefaultETAWindow, "number of recent days to estimate the upload rate from")
+var groupSpec = flag.String("group", "volume:1", "grouping key: depth:N, volume:N, home:N, ext, regex:RE, buckets:FILE")
+var memoryMiB = flag.Int("mem", 64, "memory budget (MiB) per sorted list, spills to disk beyond that")
+var tempDir = flag.String("tmp", "", "directory for sort runs (default: system temp dir)")
+
+var format = flag.String("format", backblaze.FormatText, "output format: text, json, jsonl or csv")
+var output = flag.String("o", "", "output file (default: stdout), progress is always on stderr")
+
+func main() {
+	flag.Parse()
+	grouper, err := backblaze.ParseGrouper(*groupSpec)
+	if err != nil {
+		log.Fatal(err)
+	}
+	src, err := backblaze.OpenSource(*bzdata)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer src.Close()
+
+	lists, err := backblaze.ListSorter{MemoryBudget: *memoryMiB << 20, TempDir: *tempDir, Progress: os.Stderr}.Sort(src)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer lists.Close()
+
+	report := backblaze.NewETAReport(lists.Rules, grouper, *window)
+	if err := lists.Diff(report.AddDone, nil, report.AddNotBackedUp); err != nil {
+		log.Fatal(err)
+	}
+	// compressed logs (.gz, .zst, .bz2) are included
+	ingested, err := (&backblaze.Ingester{Progress: os.Stderr}).IngestSource(src)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, tx := range ingested.Records {
+		report.AddTransmitted(tx)
+	}
+
+	report.Estimate()
+	if report.Idle > 1 {
+		fmt.Fprintf(os.Stderr, "-= Stalled: nothing transmitted since %s\n", report.Last.Format("2006-01-02"))
+	}
+	fmt.Fprintf(os.Stderr, "-= Remaining: %d (%s), %.1f days [%.1f,%.1f]\n",
+		report.Total.Remaining.Files, backblaze.HumanBytes(report.Total.Remaining.Bytes),
+		report.Total.ETA.Days, report.Total.ETA.Earliest, report.Total.ETA.Latest)
+	if err := backblaze.WriteReport(os.Stdout, report, *format, *output); err != nil {
+		log.Fatal(err)
+	}
+}
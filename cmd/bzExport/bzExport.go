@@ -0,0 +1,148 @@
+package main
+
+// Exports the transmitted records of each host, partitioned by host and date,
+// as Parquet or CSV, to query months of history with DuckDB or pandas,
+// or loads them, along with the filelists, fileids and exclusions, into a SQLite database
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/daneroo/backblaze"
+	"github.com/daneroo/backblaze/collect"
+	"github.com/daneroo/backblaze/export"
+)
+
+var inventory = flag.String("inventory", "", "hosts to export, as collected by bzCollect (default: every <host>/bzdata in -data)")
+var dataDir = flag.String("data", "./data", "directory the hosts were collected into, as <host>/bzdata")
+var only = flag.String("host", "", "only export this host")
+var format = flag.String("format", export.FormatParquet, "export format: parquet, csv or sqlite")
+var outDir = flag.String("out", "./data/export", "directory of the partitions: host=<host>/date=<date>/transmitted.<format>, or of "+export.DBFile)
+var tz = flag.String("tz", "Local", "timezone the logs were written in")
+
+func main() {
+	flag.Parse()
+	loc, err := time.LoadLocation(*tz)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *format == export.FormatSQLite {
+		exportSQLite()
+		return
+	}
+	e := &export.Exporter{Dir: *outDir, Format: *format, Location: loc}
+	for _, host := range selected() {
+		src := hostSource(host)
+		records := parseTransmitted(src)
+		src.Close()
+		stats, err := e.Export(host, records)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintf(os.Stderr, "-= Exported %s: %d records in %d partitions (%d skipped)\n", host, stats.Records, len(stats.Files), stats.Skipped)
+	}
+}
+
+// the hosts to export, as per -host
+func selected() []string {
+	hosts, err := collect.Hosts(*inventory, *dataDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	names := make([]string, 0)
+	for _, host := range hosts {
+		if len(*only) == 0 || host == *only {
+			names = append(names, host)
+		}
+	}
+	return names
+}
+
+func exportSQLite() {
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		log.Fatal(err)
+	}
+	path := filepath.Join(*outDir, export.DBFile)
+	db, err := export.OpenDB(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+	for _, host := range selected() {
+		load, err := db.Begin(host)
+		if err != nil {
+			log.Fatal(err)
+		}
+		src := hostSource(host)
+		err = loadHost(load, src)
+		src.Close()
+		if err != nil {
+			load.Rollback()
+			log.Fatalf("%s: %v", host, err)
+		}
+		if err := load.Commit(); err != nil {
+			log.Fatal(err)
+		}
+		s := load.Stats
+		fmt.Fprintf(os.Stderr, "-= Loaded %s into %s: %d records, %d in filelists, %d fileids, %d not backed up (%d unaccounted)\n",
+			host, path, s.Transmissions, s.FileList, s.FileIds, s.NotBackedUp, s.Unaccounted)
+	}
+}
+
+func loadHost(load *export.HostLoad, src backblaze.DataSource) error {
+	if err := load.AddTransmitted(parseTransmitted(src)); err != nil {
+		return err
+	}
+	files, err := backblaze.FileLists(src)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := loadFile(src, file, load.AddFileList); err != nil {
+			return err
+		}
+	}
+	fileIds, err := backblaze.FileIds(src)
+	if err != nil {
+		return err
+	}
+	if err := loadFile(src, fileIds, load.AddFileIds); err != nil {
+		return err
+	}
+	rules, err := backblaze.ReadExclusionRules(src)
+	if err != nil {
+		return err
+	}
+	return load.Explain(rules)
+}
+
+func loadFile(src backblaze.DataSource, file string, add func(io.Reader) error) error {
+	infile, err := src.Open(file)
+	if err != nil {
+		return err
+	}
+	defer infile.Close()
+	return add(infile)
+}
+
+func hostSource(host string) backblaze.DataSource {
+	src, err := backblaze.HostSource(*dataDir, host)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return src
+}
+
+// compressed logs (.gz, .zst, .bz2) are included
+func parseTransmitted(src backblaze.DataSource) []backblaze.Transmitted {
+	ingested, err := (&backblaze.Ingester{KeepDedup: true, Progress: os.Stderr}).IngestSource(src)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return ingested.Records
+}
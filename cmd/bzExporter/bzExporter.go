@@ -0,0 +1,153 @@
+package main
+
+// Exposes Backblaze activity as Prometheus metrics:
+// - tails the transmitted logs, and the event log for the filelist scans
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/daneroo/backblaze"
+)
+
+var bzdata = flag.String("bzdata", backblaze.LiveBzData, "Backblaze data directory, more can be given as arguments (e.g. ./data/*/bzdata)")
+var listen = flag.String("listen", ":9136", "address to serve /metrics on")
+var interval = flag.Duration("interval", 15*time.Second, "how often the logs are polled")
+var scanPattern = flag.String("scan", backblaze.DefaultScanPattern, "regex matching the event log lines of a filelist scan")
+var tz = flag.String("tz", "Local", "timezone the logs were written in")
+
+type source struct {
+	host   string
+	dir    string
+	tailer *backblaze.Tailer
+	scans  map[string]*eventScan // by event log
+}
+
+// eventScan is the latest filelist scan in the lines of an event log read so far
+type eventScan struct {
+	offset int64
+	last   time.Time
+	mark   backblaze.TailFingerprint // when offset was read, as for the transmitted logs
+}
+
+func main() {
+	flag.Parse()
+	loc, err := time.LoadLocation(*tz)
+	if err != nil {
+		log.Fatal(err)
+	}
+	scanRE, err := regexp.Compile(*scanPattern)
+	if err != nil {
+		log.Fatal(err)
+	}
+	dirs := []string{*bzdata}
+	if flag.NArg() > 0 {
+		dirs = flag.Args()
+	}
+
+	metrics := backblaze.NewMetrics()
+	metrics.Location = loc
+	sources := make([]source, 0, len(dirs))
+	for _, dir := range dirs {
+		tailer := backblaze.NewTailer(filepath.Join(dir, backblaze.TransmittedLogsPattern))
+		tailer.Progress = os.Stderr
+		sources = append(sources, source{
+			host:   backblaze.HostOf(dir),
+			dir:    dir,
+			tailer: tailer,
+			scans:  make(map[string]*eventScan),
+		})
+	}
+	poll := func() {
+		for _, src := range sources {
+			count := 0
+			err := src.tailer.Poll(func(tx backblaze.Transmitted) {
+				metrics.Add(src.host, tx)
+				count++
+			})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "-= Tailing %s failed: %v\n", src.host, err)
+			}
+			if count > 0 {
+				fmt.Fprintf(os.Stderr, "-= %s: %d new records\n", src.host, count)
+			}
+			if lastScan := src.lastScan(scanRE, loc); !lastScan.IsZero() {
+				metrics.SetLastScan(src.host, lastScan)
+			}
+		}
+	}
+	poll()
+	go func() {
+		for range time.Tick(*interval) {
+			poll()
+		}
+	}()
+
+	http.Handle("/metrics", metrics)
+	fmt.Fprintf(os.Stderr, "-= Serving http://%s/metrics\n", *listen)
+	log.Fatal(http.ListenAndServe(*listen, nil))
+}
+
+// lastScan is the time of the latest filelist scan in the event logs, zero if none.
+// Only the lines appended to each log since the previous poll are read.
+func (src source) lastScan(scanRE *regexp.Regexp, loc *time.Location) time.Time {
+	var lastScan time.Time
+	files, err := filepath.Glob(filepath.Join(src.dir, backblaze.EventLogsPattern))
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, file := range files {
+		scan, ok := src.scans[file]
+		if !ok {
+			scan = &eventScan{}
+			src.scans[file] = scan
+		}
+		if err := scan.update(file, scanRE, loc); err != nil {
+			fmt.Fprintf(os.Stderr, "-= Event log: %v\n", err)
+		}
+		if scan.last.After(lastScan) {
+			lastScan = scan.last
+		}
+	}
+	return lastScan
+}
+
+// update reads the complete lines appended to file since offset, from the start if it was rewritten (see backblaze.Tailer)
+func (scan *eventScan) update(file string, scanRE *regexp.Regexp, loc *time.Location) error {
+	infile, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer infile.Close()
+	info, err := infile.Stat()
+	if err != nil {
+		return err
+	}
+	mark, err := backblaze.Fingerprint(infile, info)
+	if err != nil {
+		return err
+	}
+	if info.Size() < scan.offset || scan.mark.Rewritten(mark) {
+		*scan = eventScan{}
+	}
+	scan.mark = mark
+	lines, err := backblaze.CompleteLines(infile, scan.offset, info.Size())
+	if err != nil || lines.Size() == 0 {
+		return err
+	}
+	last, err := backblaze.LastEvent(lines, scanRE, loc)
+	if err != nil {
+		return err
+	}
+	if last.After(scan.last) {
+		scan.last = last
+	}
+	scan.offset += lines.Size()
+	return nil
+}
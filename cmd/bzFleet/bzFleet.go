@@ -0,0 +1,96 @@
+package main
+
+// Attempts to answer the question:
+// - How do the hosts compare: uploads, backlog, exclusions, activity ?
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"time"
+
+	"github.com/daneroo/backblaze"
+	"github.com/daneroo/backblaze/collect"
+)
+
+var inventory = flag.String("inventory", "", "hosts to compare, as collected by bzCollect (default: every <host>/bzdata in -data)")
+var dataDir = flag.String("data", "./data", "directory the hosts were collected into, as <host>/bzdata")
+var days = flag.Int("days", backblaze.DefaultFleetDays, "period of the uploads, in days up to today")
+var groupSpec = flag.String("group", "depth:3", "grouping key of the growing directories: depth:N, volume:N, home:N, ext, regex:RE, buckets:FILE")
+var topN = flag.Int("top", 5, "number of growing directories per host")
+var backlog = flag.Bool("backlog", true, "compare the filelists and fileids for the pending and excluded files (slower)")
+var memoryMiB = flag.Int("mem", 64, "memory budget (MiB) per sorted list, spills to disk beyond that")
+var tempDir = flag.String("tmp", "", "directory for sort runs (default: system temp dir)")
+
+var format = flag.String("format", backblaze.FormatText, "output format: text, json or html")
+var output = flag.String("o", "", "output file (default: stdout), progress is always on stderr")
+
+func main() {
+	flag.Parse()
+	grouper, err := backblaze.ParseGrouper(*groupSpec)
+	if err != nil {
+		log.Fatal(err)
+	}
+	hosts, err := collect.Hosts(*inventory, *dataDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	since := time.Now().AddDate(0, 0, -*days+1).Format("2006-01-02")
+	report := backblaze.NewFleetReport(since, grouper, *topN)
+	// a host which cannot be read is listed as failed, as bzFlow skips it
+	for _, host := range hosts {
+		src, err := backblaze.HostSource(*dataDir, host)
+		if err != nil {
+			log.Printf("Error for host %s: %v", host, err)
+			report.Fail(host, err)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "-= Host %s (%s)\n", host, src.Name())
+		// compressed logs (.gz, .zst, .bz2) are included
+		ingested, err := (&backblaze.Ingester{KeepDedup: true, Progress: os.Stderr}).IngestSource(src)
+		if err != nil {
+			src.Close()
+			log.Printf("Error for host %s: %v", host, err)
+			report.Fail(host, err)
+			continue
+		}
+		var pending, excluded backblaze.FileTotal
+		var backlogErr error
+		if *backlog {
+			pending, excluded, backlogErr = backlogOf(src)
+		}
+		src.Close()
+		fh := report.AddHost(host, ingested.Records, pending, excluded)
+		if backlogErr != nil {
+			log.Printf("Error for host %s: %v", host, backlogErr)
+			report.Fail(host, fmt.Errorf("backlog: %v", backlogErr))
+		}
+		fmt.Fprintf(os.Stderr, "-= Uploaded %s since %s, %s pending\n",
+			backblaze.HumanBytes(fh.Uploaded.Bytes), since, backblaze.HumanBytes(fh.Pending.Bytes))
+	}
+	if err := backblaze.WriteReport(os.Stdout, report, *format, *output); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// backlogOf compares the fileids and filelists, as bzETA does, none without fileids
+func backlogOf(src backblaze.DataSource) (pending, excluded backblaze.FileTotal, err error) {
+	lists, err := backblaze.ListSorter{MemoryBudget: *memoryMiB << 20, TempDir: *tempDir, Progress: os.Stderr}.Sort(src)
+	if errors.Is(err, fs.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "-= No backlog: %v\n", err)
+		return pending, excluded, nil
+	}
+	if err != nil {
+		return pending, excluded, err
+	}
+	defer lists.Close()
+
+	eta := backblaze.NewETAReport(lists.Rules, backblaze.DepthGrouper{Depth: 0}, 1)
+	if err := lists.Diff(eta.AddDone, nil, eta.AddNotBackedUp); err != nil {
+		return pending, excluded, err
+	}
+	return eta.Total.Remaining, eta.Total.Excluded, nil
+}
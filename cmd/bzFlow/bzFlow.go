@@ -6,15 +6,15 @@ package main
 import (
 	"bufio"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"os"
-	"path/filepath"
 	"sort"
-	"strings"
 	"time"
 
 	"github.com/daneroo/backblaze"
+	"github.com/daneroo/backblaze/collect"
 )
 
 var hosts = []string{"galois", "davinci"}
@@ -29,45 +29,138 @@ var minStamp = time.Now().AddDate(0, 0, -daysAgo).Format("2006-01-02")
 
 const maxStamp = "2040-12-31"
 
+var (
+	groupSpec  = flag.String("group", "depth:3", "grouping key: depth:N, volume:N, home:N, ext, regex:RE, buckets:FILE")
+	output     = flag.String("output", "raw", "output: raw (all transmissions), summary, series (streamgraph), tree (sunburst), buckets or anomalies")
+	period     = flag.String("period", "day", "buckets output: minute, hour, day, week or month")
+	tz         = flag.String("tz", "Local", "buckets output: timezone of the buckets (e.g. UTC, America/Montreal)")
+	window     = flag.Int("window", backblaze.DefaultAnomalyWindow, "anomalies output: days in the rolling baseline")
+	threshold  = flag.Float64("threshold", backblaze.DefaultAnomalyThreshold, "anomalies output: robust z-score beyond which a day is unusual")
+	inventory  = flag.String("inventory", "", "hosts to process, as collected by bzCollect (default: galois and davinci)")
+	dataDir    = flag.String("data", "./data", "directory the hosts were collected into, as <host>/bzdata")
+	aggregates = flag.String("aggregates", "./data/aggregates", "directory of the daily aggregates, stored after each run for bzRollup (empty: not stored)")
+	workers    = flag.Int("workers", 0, "log files parsed in parallel (default: number of CPUs), 1 parses them one after another")
+)
+
 func main() {
+	flag.Parse()
+	grouper, err := backblaze.ParseGrouper(*groupSpec)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(*inventory) != 0 {
+		if hosts, err = collect.Hosts(*inventory, *dataDir); err != nil {
+			log.Fatal(err)
+		}
+	}
 	for _, host := range hosts {
 		fmt.Fprintf(os.Stderr, "Processing host: %s\n", host)
-		// bzdata on localhost!
-		// baseDir = "/Library/Backblaze.bzpkg/bzdata"
-		baseDir := fmt.Sprintf("./data/%s/bzdata", host)
+		// bzdata on localhost: backblaze.LiveSource()
+		src, err := backblaze.HostSource(*dataDir, host)
+		if err != nil {
+			log.Printf("Error for host %s: %v", host, err)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, " -- Source: %s\n", src.Name())
 
-		files, err := filepath.Glob(baseDir + "/bzlogs/bzreports_lastfilestransmitted/*.log")
+		// compressed logs (.gz, .zst, .bz2) are included
+		files, err := backblaze.TransmittedLogs(src)
 		if err != nil {
+			src.Close()
 			log.Printf("Error for host %s: %v", host, err)
 			continue
 		}
 
-		allxfrs := make([]backblaze.Transmitted, 0)
 		fmt.Fprintf(os.Stderr, " -- Date range: [%s,%s)\n", minStamp, maxStamp)
-		for _, file := range files {
-			xfrs := parse(file)
-
-			fmt.Fprintf(os.Stderr, " -- Considering: %s %d\n", file, len(xfrs))
-			if len(xfrs) > 0 {
-				firstDate := xfrs[0].Stamp[0:10]
-				inRange := firstDate >= minStamp && firstDate < maxStamp
-				if len(xfrs) > 0 && !(inRange) {
-					fmt.Fprintf(os.Stderr, " -- Skipping: %s %s\n", firstDate, file)
-					continue
-				} else {
-					fmt.Fprintf(os.Stderr, " -- Keeping: %s %s\n", firstDate, file)
-				}
+		// the dates of the skipped files are only partly in the kept ones
+		partial := make(map[string]bool)
+		keep := func(file string, xfrs []backblaze.Transmitted) bool {
+			if keepInRange(file, xfrs) {
+				return true
 			}
-
-			if doSummary {
-				summary := summarize(xfrs)
-				sortBySizeThenName(summary)
-				writeJSON(summary, "", true)
+			for _, tx := range xfrs {
+				if len(tx.Stamp) >= 10 {
+					partial[tx.Stamp[0:10]] = true
+				}
 			}
-			allxfrs = append(allxfrs, xfrs...)
+			return false
+		}
+		// dedup records are only kept for the aggregates
+		ingester := &backblaze.Ingester{Workers: *workers, KeepDedup: true, Keep: keep, Progress: os.Stderr, FS: src}
+		ingested := ingester.Ingest(files)
+		src.Close()
+		if len(*aggregates) != 0 {
+			storeAggregates(host, ingested.Records, partial)
 		}
+		allxfrs := sent(ingested.Records)
 		fmt.Fprintf(os.Stderr, "-= Accumulated %d entries\n", len(allxfrs))
-		writeJSON(allxfrs, fmt.Sprintf("%sFlow", host), false)
+		switch *output {
+		case "raw":
+			writeJSON(allxfrs, fmt.Sprintf("%sFlow", host), false)
+		case "summary":
+			writeGrouped(backblaze.SummarizeBy(allxfrs, grouper), fmt.Sprintf("%sSummary.json", host))
+		case "series":
+			writeGrouped(backblaze.DailySeries(allxfrs, grouper), fmt.Sprintf("%sSeries.json", host))
+		case "tree":
+			writeGrouped(backblaze.GroupTree(allxfrs, grouper), fmt.Sprintf("%sTree.json", host))
+		case "buckets":
+			writeGrouped(bucketize(allxfrs, grouper), fmt.Sprintf("%sBuckets.json", host))
+		case "anomalies":
+			writeGrouped(anomalies(host, allxfrs, grouper), fmt.Sprintf("%sAnomalies.json", host))
+		default:
+			log.Fatalf("unknown output: %q", *output)
+		}
+	}
+}
+
+func bucketize(xfrs []backblaze.Transmitted, grouper backblaze.Grouper) []backblaze.BucketStats {
+	loc, err := time.LoadLocation(*tz)
+	if err != nil {
+		log.Fatal(err)
+	}
+	agg, err := backblaze.NewAggregator(*period, loc, grouper)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, tx := range xfrs {
+		agg.Add(tx)
+	}
+	if agg.Skipped() > 0 {
+		fmt.Fprintf(os.Stderr, "-= Skipped %d entries with unparsable stamps\n", agg.Skipped())
+	}
+	return agg.Buckets()
+}
+
+// anomalies for the whole host (group "/"), and for each group, up to today: uploads which stopped are flagged
+func anomalies(host string, xfrs []backblaze.Transmitted, grouper backblaze.Grouper) []backblaze.Anomaly {
+	today := time.Now().Format("2006-01-02")
+	series := backblaze.DailySeriesUntil(xfrs, backblaze.DepthGrouper{Depth: 0}, today)
+	found := backblaze.DetectAnomalies(series, *window, *threshold)
+	series = backblaze.DailySeriesUntil(xfrs, grouper, today)
+	found = append(found, backblaze.DetectAnomalies(series, *window, *threshold)...)
+	for i := range found {
+		found[i].Host = host
+	}
+	fmt.Fprintf(os.Stderr, "-= Found %d anomalies\n", len(found))
+	return found
+}
+
+// writeGrouped writes any of the grouped outputs (summary, series, tree) as json
+func writeGrouped(v interface{}, outfilename string) {
+	fmt.Fprintf(os.Stderr, "-= Writing %s (grouped by %s)\n", outfilename, *groupSpec)
+	outfile, err := os.Create(outfilename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer outfile.Close()
+
+	bw := bufio.NewWriter(outfile)
+	enc := json.NewEncoder(bw)
+	if err := enc.Encode(v); err != nil {
+		log.Fatal(err)
+	}
+	if err := bw.Flush(); err != nil {
+		log.Fatal(err)
 	}
 }
 
@@ -84,54 +177,59 @@ func sortBySizeThenName(list []backblaze.Transmitted) {
 
 }
 
-func parse(file string) []backblaze.Transmitted {
-	infile, err := os.Open(file)
-	if err != nil {
-		log.Fatal(err)
+// keepInRange keeps the files whose first record is in [minStamp,maxStamp)
+func keepInRange(file string, xfrs []backblaze.Transmitted) bool {
+	fmt.Fprintf(os.Stderr, " -- Considering: %s %d\n", file, len(xfrs))
+	if len(xfrs) == 0 {
+		return true
 	}
-	defer infile.Close()
-
-	return backblaze.ParseTransmited(infile)
+	firstDate := xfrs[0].Stamp[0:10]
+	if firstDate < minStamp || firstDate >= maxStamp {
+		fmt.Fprintf(os.Stderr, " -- Skipping: %s %s\n", firstDate, file)
+		return false
+	}
+	fmt.Fprintf(os.Stderr, " -- Keeping: %s %s\n", firstDate, file)
+	if doSummary {
+		summary := summarize(sent(xfrs))
+		sortBySizeThenName(summary)
+		writeJSON(summary, "", true)
+	}
+	return true
+}
 
+// sent drops the dedup records
+func sent(xfrs []backblaze.Transmitted) []backblaze.Transmitted {
+	list := make([]backblaze.Transmitted, 0, len(xfrs))
+	for _, tx := range xfrs {
+		if !tx.Dedup() {
+			list = append(list, tx)
+		}
+	}
+	return list
 }
 
-func parent(path string) string {
-	if strings.HasSuffix(path, "/") {
-		path = path[0 : len(path)-1]
+// storeAggregates replaces the aggregates of the days in xfrs, the older days are kept,
+// as are those of the partial days (also in a skipped file), which xfrs does not completely cover
+func storeAggregates(host string, xfrs []backblaze.Transmitted, partial map[string]bool) {
+	store := backblaze.AggregateStore{Dir: *aggregates}
+	days, skipped := backblaze.AggregateDays(host, xfrs)
+	stored := 0
+	for _, day := range days {
+		if partial[day.Date] {
+			fmt.Fprintf(os.Stderr, " -- Not storing the partial day %s\n", day.Date)
+			continue
+		}
+		if err := store.Put(day); err != nil {
+			log.Fatal(err)
+		}
+		stored++
 	}
-	dir, _ := filepath.Split(path)
-	return dir
+	fmt.Fprintf(os.Stderr, "-= Stored %d daily aggregates in %s (%d records skipped, %d partial days)\n", stored, *aggregates, skipped, len(days)-stored)
 }
 
 func summarize(xfrs []backblaze.Transmitted) []backblaze.Transmitted {
 	fmt.Fprintf(os.Stderr, "-= Writing %d entries\n", len(xfrs))
-	tree := make(map[string]*backblaze.Transmitted)
-	for _, tx := range xfrs {
-		// walk up the current path
-		// fmt.Println("fname", tx.FName)
-		dir := parent(tx.FName)
-		for len(dir) > 0 {
-			// fmt.Println("dir", dir)
-			// add to current dir
-			_, ok := tree[dir]
-			if !ok {
-				tree[dir] = &backblaze.Transmitted{}
-				tree[dir].FName = dir
-				tree[dir].Stamp = tx.Stamp[0:10]
-			}
-			tree[dir].Size += tx.Size
-
-			// walk up
-			dir = parent(dir)
-		}
-
-	}
-	// return tree
-	list := make([]backblaze.Transmitted, 0, len(tree))
-	for _, tx := range tree {
-		list = append(list, *tx)
-	}
-	return list
+	return backblaze.CompactTransmissions(xfrs).SummarizeDirs()
 }
 
 func writeTree(tree map[string]*backblaze.Transmitted) {
@@ -0,0 +1,103 @@
+package main
+
+// Renders a self-contained html report, for a host or the fleet,
+// to email or archive, without deploying viz/
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"time"
+
+	"github.com/daneroo/backblaze"
+	"github.com/daneroo/backblaze/collect"
+	"github.com/daneroo/backblaze/report"
+)
+
+var inventory = flag.String("inventory", "", "hosts to report on, as collected by bzCollect (default: every <host>/bzdata in -data)")
+var dataDir = flag.String("data", "./data", "directory the hosts were collected into, as <host>/bzdata")
+var only = flag.String("host", "", "only report on this host")
+var days = flag.Int("days", 7, "period of the report, in days up to today")
+var groupSpec = flag.String("group", "depth:3", "grouping key of the top directories: depth:N, volume:N, home:N, ext, regex:RE, buckets:FILE")
+var topN = flag.Int("top", 10, "number of top directories, churning files and exclusion rules per host")
+var exclusions = flag.Bool("exclusions", true, "compare the filelists and fileids for the exclusions (slower)")
+var memoryMiB = flag.Int("mem", 64, "memory budget (MiB) per sorted list, spills to disk beyond that")
+var tempDir = flag.String("tmp", "", "directory for sort runs (default: system temp dir)")
+
+var output = flag.String("o", "report.html", "output file")
+
+func main() {
+	flag.Parse()
+	grouper, err := backblaze.ParseGrouper(*groupSpec)
+	if err != nil {
+		log.Fatal(err)
+	}
+	now := time.Now()
+	page := &report.Page{Title: "Backblaze fleet report", Generated: now, Since: now.AddDate(0, 0, -*days+1).Format("2006-01-02")}
+	hosts, err := collect.Hosts(*inventory, *dataDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, name := range hosts {
+		if len(*only) != 0 && name != *only {
+			continue
+		}
+		src, err := backblaze.HostSource(*dataDir, name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintf(os.Stderr, "-= Host %s (%s)\n", name, src.Name())
+		// compressed logs (.gz, .zst, .bz2) are included
+		ingested, err := (&backblaze.Ingester{KeepDedup: true, Progress: os.Stderr}).IngestSource(src)
+		if err != nil {
+			log.Fatal(err)
+		}
+		host := report.NewHost(name, ingested.Records, page.Since, grouper, *topN)
+		if *exclusions {
+			if ignored := ignoredOf(src); ignored != nil {
+				host.SetIgnored(ignored, *topN)
+			}
+		}
+		src.Close()
+		page.Hosts = append(page.Hosts, host)
+	}
+	if len(page.Hosts) == 1 {
+		page.Title = "Backblaze report: " + page.Hosts[0].Name
+	}
+
+	outfile, err := os.Create(*output)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer outfile.Close()
+	fmt.Fprintf(os.Stderr, "-= Writing %s (%d hosts)\n", *output, len(page.Hosts))
+	if err := page.Write(outfile); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// ignoredOf compares the fileids and filelists, as bzWhyIgnored does, nil if there are no fileids
+func ignoredOf(src backblaze.DataSource) *backblaze.IgnoredReport {
+	lists, err := backblaze.ListSorter{MemoryBudget: *memoryMiB << 20, TempDir: *tempDir, Progress: os.Stderr}.Sort(src)
+	if errors.Is(err, fs.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "-= No exclusions: %v\n", err)
+		return nil
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer lists.Close()
+
+	ignored := backblaze.NewIgnoredReport(lists.Rules)
+	err = lists.Diff(ignored.AddEqual, ignored.AddMissingOnDisk, func(path string, size int64) {
+		ignored.AddNotBackedUp(path, size)
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	ignored.Rank(*topN)
+	return ignored
+}
@@ -0,0 +1,62 @@
+package main
+
+// Attempts to answer the question:
+// - What was transmitted over the last months, without re-reading months of logs ?
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/daneroo/backblaze"
+)
+
+var storeDir = flag.String("aggregates", "./data/aggregates", "directory of the daily aggregates, as stored by bzFlow")
+var hostList = flag.String("host", "", "comma separated hosts (default: every host in -aggregates)")
+var days = flag.Int("days", 90, "period, in days up to today, unless -from is set")
+var from = flag.String("from", "", "first date (yyyy-mm-dd) of the period")
+var to = flag.String("to", "", "last date (yyyy-mm-dd) of the period (default: today)")
+var period = flag.String("period", backblaze.Week, "buckets: hour, day, week or month")
+var tz = flag.String("tz", "Local", "timezone the logs were written in")
+var depth = flag.Int("depth", 3, "directories are grouped by their first N directories")
+var topN = flag.Int("top", 20, "number of top directories")
+var format = flag.String("format", backblaze.FormatText, "output format: text or json")
+var output = flag.String("o", "", "output file (default: stdout), progress is always on stderr")
+
+func main() {
+	flag.Parse()
+	loc, err := time.LoadLocation(*tz)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(*to) == 0 {
+		*to = time.Now().Format("2006-01-02")
+	}
+	if len(*from) == 0 {
+		end, err := time.Parse("2006-01-02", *to)
+		if err != nil {
+			log.Fatal(err)
+		}
+		*from = end.AddDate(0, 0, -*days+1).Format("2006-01-02")
+	}
+	var hosts []string
+	if len(*hostList) != 0 {
+		hosts = strings.Split(*hostList, ",")
+	}
+	store := backblaze.AggregateStore{Dir: *storeDir}
+	rollup, err := store.Query(hosts, *from, *to)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintf(os.Stderr, "-= Merged %d days of %v\n", len(rollup.Days), rollup.Hosts)
+	report, err := backblaze.NewRollupReport(rollup, *from, *to, *period, loc, *depth, *topN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := backblaze.WriteReport(os.Stdout, report, *format, *output); err != nil {
+		log.Fatal(err)
+	}
+}
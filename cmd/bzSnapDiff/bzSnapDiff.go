@@ -0,0 +1,59 @@
+package main
+
+// Attempts to answer the question:
+// - What changed in a host's bzdata between two snapshots, taken days apart ?
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/daneroo/backblaze"
+)
+
+var memoryMiB = flag.Int("mem", 64, "memory budget (MiB) per sorted list, spills to disk beyond that")
+var tempDir = flag.String("tmp", "", "directory for sort runs (default: system temp dir)")
+var format = flag.String("format", backblaze.FormatText, "output format: text, json, jsonl or csv")
+var output = flag.String("o", "", "output file (default: stdout), progress is always on stderr")
+var maxChanges = flag.Int("max", backblaze.DefaultMaxChanges, "changes listed, the others are only counted in the summary")
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] OLD NEW\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "  OLD and NEW are bzdata snapshots of a host: directories, or tar archives of one (e.g. bzdata.tgz)\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	old := openSource(flag.Arg(0))
+	defer old.Close()
+	new := openSource(flag.Arg(1))
+	defer new.Close()
+
+	differ := backblaze.SnapshotDiffer{MemoryBudget: *memoryMiB << 20, TempDir: *tempDir, MaxChanges: *maxChanges}
+	diff, err := differ.Diff(old, new)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, missing := range diff.Missing {
+		fmt.Fprintf(os.Stderr, "-= Missing (compared as empty): %s\n", missing)
+	}
+	fmt.Fprintf(os.Stderr, "-= Changes: %d (%d not listed)\n", len(diff.Changes)+diff.Dropped, diff.Dropped)
+	if err := backblaze.WriteReport(os.Stdout, diff, *format, *output); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func openSource(name string) backblaze.DataSource {
+	src, err := backblaze.OpenSource(name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintf(os.Stderr, "-= Snapshot: %s\n", src.Name())
+	return src
+}
@@ -0,0 +1,43 @@
+package main
+
+// Attempts to answer the question:
+// - How fast are files actually transmitted, and when ?
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/daneroo/backblaze"
+)
+
+var bzdata = flag.String("bzdata", backblaze.LiveBzData, "bzdata directory (e.g. ./data/galois/bzdata), or a tar archive of one (e.g. bzdata.tgz)")
+var idleGap = flag.Duration("idle", backblaze.DefaultIdleGap, "longest pause between transmissions still counted as busy time")
+var format = flag.String("format", backblaze.FormatText, "output format: text, json, jsonl or csv")
+var output = flag.String("o", "", "output file (default: stdout), progress is always on stderr")
+
+func main() {
+	flag.Parse()
+
+	// the logs given as arguments, or those of -bzdata, compressed ones included
+	ingester := &backblaze.Ingester{Progress: os.Stderr}
+	ingested := ingester.Ingest(flag.Args())
+	if flag.NArg() == 0 {
+		var err error
+		if ingested, err = ingester.IngestBzData(*bzdata); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	report := backblaze.NewThroughputReport(*idleGap)
+	for _, tx := range ingested.Records {
+		report.Add(tx)
+	}
+	report.Summarize()
+	fmt.Fprintf(os.Stderr, "-= Transmissions: %d (%s), skipped: %d\n",
+		report.Total.Transmissions, backblaze.HumanBytes(report.Total.Bytes), report.Skipped())
+	if err := backblaze.WriteReport(os.Stdout, report, *format, *output); err != nil {
+		log.Fatal(err)
+	}
+}
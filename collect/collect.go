@@ -0,0 +1,129 @@
+// Package collect copies the Backblaze files the tools need, from the hosts of an inventory,
+// into ./data/<host>/bzdata (the layout scripts/clone.sh used to rsync).
+package collect
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/daneroo/backblaze"
+)
+
+// DefaultPatterns are the files the tools read, relative to bzdata
+var DefaultPatterns = []string{
+	"bzinfo.xml",
+	"bzexcluderules_*.xml",
+	"bzbackup/bzfileids.dat",
+	"bzfilelists/*.dat",
+	"bzlogs/bzreports_lastfilestransmitted/*.log",
+	"bzlogs/bzreports_eventlog/*.log",
+}
+
+// Collector copies files from a host's bzdata to Dest/<host>/bzdata.
+// Files are skipped when the local copy has the same size and modification time,
+// or else the same checksum; copies keep the remote modification time.
+type Collector struct {
+	Dest     string   // e.g. ./data
+	Patterns []string // DefaultPatterns if nil
+}
+
+// Stats counts what Collect did with the matching files
+type Stats struct {
+	Host      string
+	Files     int   // matching
+	Unchanged int   // same size and modification time
+	Verified  int   // same checksum
+	Copied    int   // new or changed
+	Bytes     int64 // copied
+}
+
+func (stats Stats) String() string {
+	return fmt.Sprintf("%s: %d files, %d unchanged, %d verified, %d copied (%d bytes)",
+		stats.Host, stats.Files, stats.Unchanged, stats.Verified, stats.Copied, stats.Bytes)
+}
+
+// Dir is the local copy of host's bzdata
+func (c *Collector) Dir(host Host) string {
+	return filepath.Join(c.Dest, host.Name, "bzdata")
+}
+
+// Collect copies the new or changed files of host, read through t
+func (c *Collector) Collect(host Host, t Transport) (Stats, error) {
+	stats := Stats{Host: host.Name}
+	patterns := c.Patterns
+	if patterns == nil {
+		patterns = DefaultPatterns
+	}
+	for _, pattern := range patterns {
+		// remote paths are slash separated, local paths are not necessarily
+		remotes, err := t.Glob(path.Join(host.BzData, pattern))
+		if err != nil {
+			return stats, err
+		}
+		for _, remote := range remotes {
+			rel, err := filepath.Rel(filepath.FromSlash(host.BzData), filepath.FromSlash(remote))
+			if err != nil {
+				return stats, err
+			}
+			if err := c.collectFile(t, remote, filepath.Join(c.Dir(host), rel), &stats); err != nil {
+				return stats, fmt.Errorf("%s: %s: %v", host.Name, remote, err)
+			}
+		}
+	}
+	return stats, nil
+}
+
+func (c *Collector) collectFile(t Transport, remote, local string, stats *Stats) error {
+	info, err := t.Stat(remote)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return nil
+	}
+	stats.Files++
+	if localInfo, err := os.Stat(local); err == nil {
+		if localInfo.Size() == info.Size() && localInfo.ModTime().Equal(info.ModTime()) {
+			stats.Unchanged++
+			return nil
+		}
+		if localInfo.Size() == info.Size() {
+			remoteSum, err := t.Checksum(remote)
+			if err != nil {
+				return err
+			}
+			if localSum, err := checksumFile(local); err == nil && localSum == remoteSum {
+				stats.Verified++
+				return os.Chtimes(local, info.ModTime(), info.ModTime())
+			}
+		}
+	}
+	n, err := copyFile(t, remote, local)
+	if err != nil {
+		return err
+	}
+	stats.Copied++
+	stats.Bytes += n
+	return os.Chtimes(local, info.ModTime(), info.ModTime())
+}
+
+// copyFile copies through a temporary file, so an interrupted copy never replaces a good one
+func copyFile(t Transport, remote, local string) (int64, error) {
+	in, err := t.Open(remote)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+	var n int64
+	err = backblaze.WriteFileAtomic(local, func(w io.Writer) error {
+		n, err = io.Copy(w, in)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
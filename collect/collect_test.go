@@ -0,0 +1,68 @@
+package collect
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCollectLocal(t *testing.T) {
+	dest, err := ioutil.TempDir("", "collect")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dest)
+	host := Host{Name: "galois", Address: "local", BzData: "../test/data/bzdata"}
+	c := &Collector{Dest: dest}
+	transport, err := Dial(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer transport.Close()
+
+	// bzinfo.xml, bzfileids.dat and 2 filelists
+	stats, err := c.Collect(host, transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Files != 4 || stats.Copied != 4 || stats.Bytes == 0 {
+		t.Errorf("expected 4 files copied, got %v", stats)
+	}
+	original, _ := ioutil.ReadFile("../test/data/bzdata/bzinfo.xml")
+	copied, err := ioutil.ReadFile(filepath.Join(dest, "galois", "bzdata", "bzinfo.xml"))
+	if err != nil || string(copied) != string(original) {
+		t.Errorf("unexpected copy of bzinfo.xml: %v", err)
+	}
+
+	stats, _ = c.Collect(host, transport)
+	if stats.Unchanged != 4 || stats.Copied != 0 {
+		t.Errorf("expected 4 unchanged files, got %v", stats)
+	}
+
+	// same content, other time: verified by checksum
+	fileids := filepath.Join(c.Dir(host), "bzbackup", "bzfileids.dat")
+	old := time.Date(2018, 10, 1, 0, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(fileids, old, old); err != nil {
+		t.Fatal(err)
+	}
+	stats, _ = c.Collect(host, transport)
+	if stats.Verified != 1 || stats.Unchanged != 3 || stats.Copied != 0 {
+		t.Errorf("expected 1 verified file, got %v", stats)
+	}
+
+	// changed content, same size: copied
+	changed := []byte(string(original[:len(original)-1]) + "!")
+	bzinfo := filepath.Join(c.Dir(host), "bzinfo.xml")
+	if err := ioutil.WriteFile(bzinfo, changed, 0644); err != nil {
+		t.Fatal(err)
+	}
+	stats, _ = c.Collect(host, transport)
+	if stats.Copied != 1 || stats.Unchanged != 3 {
+		t.Errorf("expected 1 copied file, got %v", stats)
+	}
+	if copied, _ := ioutil.ReadFile(bzinfo); string(copied) != string(original) {
+		t.Errorf("expected bzinfo.xml to be restored")
+	}
+}
@@ -0,0 +1,90 @@
+package collect
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/daneroo/backblaze"
+)
+
+// DefaultBzData is where Backblaze keeps its data, on a Mac
+const DefaultBzData = "/Library/Backblaze.bzpkg/bzdata"
+
+// Host is an entry of the inventory: where to collect a host's bzdata from
+type Host struct {
+	Name    string
+	Address string // ssh://[user@]host[:port] or local
+	BzData  string // the bzdata directory, on that host
+}
+
+// Local is true for a host whose bzdata is a local directory
+func (host Host) Local() bool {
+	return host.Address == "local"
+}
+
+// ParseInventory reads hosts, one per line: name address [bzdata]
+//
+//	# comments and empty lines are ignored
+//	galois   ssh://daniel@galois
+//	davinci  ssh://davinci:2222  /Library/Backblaze.bzpkg/bzdata
+//	dirac    local               ./archive/dirac/bzdata
+//
+// bzdata defaults to DefaultBzData.
+func ParseInventory(r io.Reader) ([]Host, error) {
+	hosts := make([]Host, 0)
+	names := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("inventory line %d: expected: name address [bzdata], got %q", lineno, line)
+		}
+		host := Host{Name: fields[0], Address: fields[1], BzData: DefaultBzData}
+		if len(fields) == 3 {
+			host.BzData = fields[2]
+		}
+		if names[host.Name] {
+			return nil, fmt.Errorf("inventory line %d: duplicate host %q", lineno, host.Name)
+		}
+		names[host.Name] = true
+		if !host.Local() {
+			u, err := url.Parse(host.Address)
+			if err != nil || u.Scheme != "ssh" || len(u.Hostname()) == 0 {
+				return nil, fmt.Errorf("inventory line %d: address must be ssh://[user@]host[:port] or local, got %q", lineno, host.Address)
+			}
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts, scanner.Err()
+}
+
+// Hosts names the hosts of the inventory file, or without one (empty), the hosts collected into dataDir
+func Hosts(inventory, dataDir string) ([]string, error) {
+	if len(inventory) == 0 {
+		return backblaze.CollectedHosts(dataDir)
+	}
+	infile, err := os.Open(inventory)
+	if err != nil {
+		return nil, err
+	}
+	defer infile.Close()
+	inventoried, err := ParseInventory(infile)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", inventory, err)
+	}
+	names := make([]string, 0, len(inventoried))
+	for _, host := range inventoried {
+		names = append(names, host.Name)
+	}
+	return names, nil
+}
@@ -0,0 +1,62 @@
+package collect
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseInventory(t *testing.T) {
+	inventory := `# our hosts
+galois   ssh://daniel@galois
+davinci  ssh://davinci:2222  /Library/Backblaze.bzpkg/bzdata
+
+dirac    local               ./archive/dirac/bzdata
+`
+	hosts, err := ParseInventory(strings.NewReader(inventory))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Host{
+		{Name: "galois", Address: "ssh://daniel@galois", BzData: DefaultBzData},
+		{Name: "davinci", Address: "ssh://davinci:2222", BzData: "/Library/Backblaze.bzpkg/bzdata"},
+		{Name: "dirac", Address: "local", BzData: "./archive/dirac/bzdata"},
+	}
+	if !reflect.DeepEqual(hosts, expected) {
+		t.Errorf("expected %+v, got %+v", expected, hosts)
+	}
+	if !hosts[2].Local() || hosts[0].Local() {
+		t.Errorf("unexpected Local()")
+	}
+
+	for _, bad := range []string{
+		"galois",
+		"galois ssh://galois /bzdata extra",
+		"galois rsync://galois",
+		"galois ssh://galois\ngalois local",
+	} {
+		if _, err := ParseInventory(strings.NewReader(bad)); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestHosts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "galois", "bzdata"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "inventory.txt"), []byte("dirac local ./archive/dirac/bzdata\n"), 0644)
+
+	if hosts, err := Hosts("", dir); err != nil || !reflect.DeepEqual(hosts, []string{"galois"}) {
+		t.Errorf("expected the collected galois, got %v (%v)", hosts, err)
+	}
+	if hosts, err := Hosts(filepath.Join(dir, "inventory.txt"), dir); err != nil || !reflect.DeepEqual(hosts, []string{"dirac"}) {
+		t.Errorf("expected the inventoried dirac, got %v (%v)", hosts, err)
+	}
+}
@@ -0,0 +1,73 @@
+package collect
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Transport reads the files of a (possibly remote) host
+type Transport interface {
+	// Glob returns the paths matching pattern, as filepath.Glob
+	Glob(pattern string) ([]string, error)
+	Stat(path string) (os.FileInfo, error)
+	// Checksum is the hex encoded sha256 of the file's content
+	Checksum(path string) (string, error)
+	Open(path string) (io.ReadCloser, error)
+	Close() error
+}
+
+// Dial returns the transport for host
+func Dial(host Host) (Transport, error) {
+	if host.Local() {
+		return LocalTransport{}, nil
+	}
+	return DialSSH(host.Address)
+}
+
+// LocalTransport reads local files
+type LocalTransport struct{}
+
+// Glob is filepath.Glob
+func (LocalTransport) Glob(pattern string) ([]string, error) {
+	return filepath.Glob(pattern)
+}
+
+// Stat is os.Stat
+func (LocalTransport) Stat(path string) (os.FileInfo, error) {
+	return os.Stat(path)
+}
+
+// Checksum reads the file
+func (LocalTransport) Checksum(path string) (string, error) {
+	return checksumFile(path)
+}
+
+// Open is os.Open
+func (LocalTransport) Open(path string) (io.ReadCloser, error) {
+	return os.Open(path)
+}
+
+// Close does nothing
+func (LocalTransport) Close() error {
+	return nil
+}
+
+func checksumFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return checksum(f)
+}
+
+func checksum(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
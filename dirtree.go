@@ -0,0 +1,220 @@
+package backblaze
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// DirTree is a prefix tree of directories, accumulating the count and size of
+// the files below each one, and separately of the files which were marked
+// (e.g. not backed up, and unexplained by any rule).
+// Only directories are nodes, files are just counted in their ancestors.
+type DirTree struct {
+	root *DirNode
+}
+
+// DirNode is a directory in a DirTree
+type DirNode struct {
+	Name   string // path component, with a trailing '/'
+	Total  FileTotal
+	Marked FileTotal
+
+	children map[string]*DirNode
+}
+
+// DirRollup is a directory holding marked files.
+// Uniform means every file below Dir is marked, so the whole directory
+// was probably excluded on purpose (by the user), otherwise only the files
+// directly in Dir are counted, and its children are rolled up on their own.
+type DirRollup struct {
+	Dir     string    `json:"dir"`
+	Marked  FileTotal `json:"marked"`
+	Total   FileTotal `json:"total"`
+	Uniform bool      `json:"uniform"`
+}
+
+// NewDirTree returns an empty tree, rooted at "/"
+func NewDirTree() *DirTree {
+	return &DirTree{root: &DirNode{Name: "/"}}
+}
+
+// Add counts a file (by its absolute path) in all its ancestor directories
+func (tree *DirTree) Add(path string, size int64, marked bool) {
+	node := tree.root
+	node.add(size, marked)
+	rest := strings.TrimPrefix(path, "/")
+	for {
+		i := strings.IndexByte(rest, '/')
+		if i < 0 {
+			return // the remainder is the file name
+		}
+		name := rest[:i+1]
+		rest = rest[i+1:]
+		child, ok := node.children[name]
+		if !ok {
+			if node.children == nil {
+				node.children = make(map[string]*DirNode)
+			}
+			child = &DirNode{Name: name}
+			node.children[name] = child
+		}
+		child.add(size, marked)
+		node = child
+	}
+}
+
+func (node *DirNode) add(size int64, marked bool) {
+	node.Total.add(size)
+	if marked {
+		node.Marked.add(size)
+	}
+}
+
+// Root returns the "/" node
+func (tree *DirTree) Root() *DirNode {
+	return tree.root
+}
+
+// Children returns the sub directories, sorted by name
+func (node *DirNode) Children() []*DirNode {
+	children := make([]*DirNode, 0, len(node.children))
+	for _, child := range node.children {
+		children = append(children, child)
+	}
+	sort.Slice(children, func(i, j int) bool { return children[i].Name < children[j].Name })
+	return children
+}
+
+// Rollup collapses the marked files into the shortest list of directories:
+// a uniformly marked directory is reported as a whole, a mixed one
+// reports only its direct marked files, and recurses into its children.
+// The list is sorted by marked bytes, largest first.
+func (tree *DirTree) Rollup() []DirRollup {
+	rollup := make([]DirRollup, 0)
+	var walk func(node *DirNode, dir string)
+	walk = func(node *DirNode, dir string) {
+		if node.Marked.Files == 0 {
+			return
+		}
+		if node.Marked.Files == node.Total.Files {
+			rollup = append(rollup, DirRollup{Dir: dir, Marked: node.Marked, Total: node.Total, Uniform: true})
+			return
+		}
+		direct := DirRollup{Dir: dir, Marked: node.Marked, Total: node.Total}
+		for _, child := range node.Children() {
+			direct.Marked.Files -= child.Marked.Files
+			direct.Marked.Bytes -= child.Marked.Bytes
+			direct.Total.Files -= child.Total.Files
+			direct.Total.Bytes -= child.Total.Bytes
+			walk(child, dir+child.Name)
+		}
+		if direct.Marked.Files > 0 {
+			rollup = append(rollup, direct)
+		}
+	}
+	walk(tree.root, tree.root.Name)
+	sort.SliceStable(rollup, func(i, j int) bool {
+		if rollup[i].Marked.Bytes == rollup[j].Marked.Bytes {
+			return rollup[i].Dir < rollup[j].Dir
+		}
+		return rollup[i].Marked.Bytes > rollup[j].Marked.Bytes
+	})
+	return rollup
+}
+
+// Merge adds the counts of other into tree, e.g. of another day or host
+func (tree *DirTree) Merge(other *DirTree) {
+	tree.root.merge(other.root)
+}
+
+func (node *DirNode) merge(other *DirNode) {
+	node.Total.Files += other.Total.Files
+	node.Total.Bytes += other.Total.Bytes
+	node.Marked.Files += other.Marked.Files
+	node.Marked.Bytes += other.Marked.Bytes
+	for name, theirs := range other.children {
+		child, ok := node.children[name]
+		if !ok {
+			if node.children == nil {
+				node.children = make(map[string]*DirNode)
+			}
+			child = &DirNode{Name: name}
+			node.children[name] = child
+		}
+		child.merge(theirs)
+	}
+}
+
+// GroupByDepth totals the files by their first depth directories, largest first,
+// as SummarizeBy with a DepthGrouper (without an Anchor) would
+func (tree *DirTree) GroupByDepth(depth int) []GroupTotal {
+	totals := make(map[string]*GroupTotal)
+	var walk func(node *DirNode, dir string, d int)
+	walk = func(node *DirNode, dir string, d int) {
+		if d == depth {
+			totals[dir] = &GroupTotal{Group: dir, Count: node.Total.Files, Size: int(node.Total.Bytes)}
+			return
+		}
+		direct := node.Total
+		for _, child := range node.Children() {
+			direct.Files -= child.Total.Files
+			direct.Bytes -= child.Total.Bytes
+			walk(child, dir+child.Name, d+1)
+		}
+		if direct.Files > 0 {
+			totals[dir] = &GroupTotal{Group: dir, Count: direct.Files, Size: int(direct.Bytes)}
+		}
+	}
+	if tree.root.Total.Files > 0 {
+		walk(tree.root, tree.root.Name, 0)
+	}
+	return largestFirst(totals)
+}
+
+// dirNodeJSON is how a DirNode is stored: children are listed, by name
+type dirNodeJSON struct {
+	Name     string     `json:"name"`
+	Total    FileTotal  `json:"total"`
+	Marked   *FileTotal `json:"marked,omitempty"`
+	Children []*DirNode `json:"children,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler
+func (node *DirNode) MarshalJSON() ([]byte, error) {
+	v := dirNodeJSON{Name: node.Name, Total: node.Total, Children: node.Children()}
+	if node.Marked.Files != 0 {
+		v.Marked = &node.Marked
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (node *DirNode) UnmarshalJSON(data []byte) error {
+	var v dirNodeJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*node = DirNode{Name: v.Name, Total: v.Total}
+	if v.Marked != nil {
+		node.Marked = *v.Marked
+	}
+	for _, child := range v.Children {
+		if node.children == nil {
+			node.children = make(map[string]*DirNode)
+		}
+		node.children[child.Name] = child
+	}
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler, the tree is its root
+func (tree *DirTree) MarshalJSON() ([]byte, error) {
+	return json.Marshal(tree.root)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (tree *DirTree) UnmarshalJSON(data []byte) error {
+	tree.root = &DirNode{}
+	return json.Unmarshal(data, tree.root)
+}
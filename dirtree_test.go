@@ -0,0 +1,149 @@
+package backblaze
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDirTreeAdd(t *testing.T) {
+	tree := NewDirTree()
+	tree.Add("/Users/daniel/a.txt", 10, false)
+	tree.Add("/Users/daniel/Library/b.txt", 20, true)
+	tree.Add("/top.txt", 5, true)
+
+	root := tree.Root()
+	if root.Total != (FileTotal{Files: 3, Bytes: 35}) || root.Marked != (FileTotal{Files: 2, Bytes: 25}) {
+		t.Errorf("unexpected root: %#v", root)
+	}
+	users := root.Children()
+	if len(users) != 1 || users[0].Name != "Users/" {
+		t.Fatalf("unexpected children of /: %#v", users)
+	}
+	daniel := users[0].Children()[0]
+	if daniel.Name != "daniel/" || daniel.Total.Files != 2 || daniel.Marked.Files != 1 {
+		t.Errorf("unexpected daniel/: %#v", daniel)
+	}
+}
+
+func TestDirTreeRollup(t *testing.T) {
+	var data = []struct {
+		name  string
+		files []struct {
+			path   string
+			size   int64
+			marked bool
+		}
+		out []DirRollup
+	}{
+		{
+			name: "Empty",
+			out:  []DirRollup{},
+		},
+		{
+			name: "NoneMarked",
+			files: []struct {
+				path   string
+				size   int64
+				marked bool
+			}{
+				{"/a/b.txt", 1, false},
+			},
+			out: []DirRollup{},
+		},
+		{
+			name: "UniformCollapses",
+			files: []struct {
+				path   string
+				size   int64
+				marked bool
+			}{
+				{"/Users/daniel/keep.txt", 1, false},
+				{"/Users/daniel/Scratch/x/1.bin", 100, true},
+				{"/Users/daniel/Scratch/x/2.bin", 100, true},
+				{"/Users/daniel/Scratch/3.bin", 50, true},
+				{"/Users/daniel/Code/main.go", 1, false},
+				{"/Users/daniel/Code/main.o.tmp", 7, true},
+			},
+			out: []DirRollup{
+				{Dir: "/Users/daniel/Scratch/", Marked: FileTotal{Files: 3, Bytes: 250}, Total: FileTotal{Files: 3, Bytes: 250}, Uniform: true},
+				{Dir: "/Users/daniel/Code/", Marked: FileTotal{Files: 1, Bytes: 7}, Total: FileTotal{Files: 2, Bytes: 8}},
+			},
+		},
+		{
+			name: "DirectFilesOfMixedDir",
+			files: []struct {
+				path   string
+				size   int64
+				marked bool
+			}{
+				{"/Volumes/Space/a.bin", 10, true},
+				{"/Volumes/Space/b.bin", 10, false},
+				{"/Volumes/Space/sub/c.bin", 30, true},
+			},
+			out: []DirRollup{
+				{Dir: "/Volumes/Space/sub/", Marked: FileTotal{Files: 1, Bytes: 30}, Total: FileTotal{Files: 1, Bytes: 30}, Uniform: true},
+				{Dir: "/Volumes/Space/", Marked: FileTotal{Files: 1, Bytes: 10}, Total: FileTotal{Files: 2, Bytes: 20}},
+			},
+		},
+		{
+			name: "EverythingMarked",
+			files: []struct {
+				path   string
+				size   int64
+				marked bool
+			}{
+				{"/a/b.txt", 1, true},
+			},
+			out: []DirRollup{
+				{Dir: "/", Marked: FileTotal{Files: 1, Bytes: 1}, Total: FileTotal{Files: 1, Bytes: 1}, Uniform: true},
+			},
+		},
+	}
+	for _, tt := range data {
+		tree := NewDirTree()
+		for _, f := range tt.files {
+			tree.Add(f.path, f.size, f.marked)
+		}
+		got := tree.Rollup()
+		if !reflect.DeepEqual(tt.out, got) {
+			t.Errorf("Test:%s\nexpected:\n%#v\ngot:\n%#v", tt.name, tt.out, got)
+		}
+	}
+}
+
+func TestDirTreeMergeJSON(t *testing.T) {
+	a := NewDirTree()
+	a.Add("/Users/daniel/a.txt", 10, false)
+	a.Add("/top.txt", 5, true)
+	b := NewDirTree()
+	b.Add("/Users/daniel/Library/b.txt", 20, false)
+	b.Add("/Volumes/Space/c.mp3", 7, false)
+
+	data, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := NewDirTree()
+	if err := json.Unmarshal(data, stored); err != nil {
+		t.Fatal(err)
+	}
+	a.Merge(stored)
+
+	whole := NewDirTree()
+	whole.Add("/Users/daniel/a.txt", 10, false)
+	whole.Add("/top.txt", 5, true)
+	whole.Add("/Users/daniel/Library/b.txt", 20, false)
+	whole.Add("/Volumes/Space/c.mp3", 7, false)
+	if !reflect.DeepEqual(whole, a) {
+		t.Errorf("merged tree differs from the whole tree")
+	}
+	expected := []GroupTotal{
+		{Group: "/Users/daniel/", Count: 2, Size: 30},
+		{Group: "/Volumes/Space/", Count: 1, Size: 7},
+		{Group: "/", Count: 1, Size: 5},
+	}
+	if got := a.GroupByDepth(2); !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
@@ -0,0 +1,294 @@
+package backblaze
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// DefaultETAWindow is the number of recent days the upload rate is estimated from
+const DefaultETAWindow = 7
+
+// ETAReport estimates when the backlog will be uploaded:
+// Done are the files in both the filelists and the fileids,
+// Remaining are those only in the filelists, which no exclusion rule explains,
+// and the rate comes from the daily bytes transmitted over the last Window days, up to today:
+// the days since the last transmission count as nothing transmitted.
+type ETAReport struct {
+	Window int        `json:"window"` // days
+	Today  time.Time  `json:"today"`  // the last day of the window, the ETAs are counted from its end
+	Last   time.Time  `json:"last"`   // day of the last transmission
+	Idle   int        `json:"idle"`   // days from Last to Today, uploads stalled if more than 1
+	Total  ETAGroup   `json:"total"`
+	Groups []ETAGroup `json:"groups"`
+
+	Now func() time.Time `json:"-"` // time.Now if nil
+
+	rules   ExclusionRules
+	grouper Grouper
+	groups  map[string]*ETAGroup
+	agg     *Aggregator
+}
+
+// ETAGroup is the backlog of a group (e.g. a volume or top level directory)
+type ETAGroup struct {
+	Group     string    `json:"group"`
+	Done      FileTotal `json:"done"`
+	Remaining FileTotal `json:"remaining"`
+	Excluded  FileTotal `json:"excluded"`
+	Rate      DailyRate `json:"rate"`
+	ETA       ETARange  `json:"eta"`
+}
+
+// DailyRate is the distribution of bytes transmitted per day: Low and High are the 10th and 90th percentiles
+type DailyRate struct {
+	Mean int64 `json:"mean"`
+	Low  int64 `json:"low"`
+	High int64 `json:"high"`
+}
+
+// ETARange is the number of days left, at the mean rate, and the confidence range:
+// Earliest at the High rate, Latest at the Low rate (or the mean, if it is outside them).
+// Negative means never, at that rate.
+type ETARange struct {
+	Days     float64 `json:"days"`
+	Earliest float64 `json:"earliest"`
+	Latest   float64 `json:"latest"`
+}
+
+// NewETAReport returns an empty report, grouping paths (and transmissions) with g
+func NewETAReport(rules ExclusionRules, g Grouper, window int) *ETAReport {
+	agg, _ := NewAggregator(Day, nil, g)
+	agg.StampLocation = time.UTC // only whole days matter
+	return &ETAReport{
+		Window:  window,
+		Groups:  make([]ETAGroup, 0),
+		rules:   rules,
+		grouper: g,
+		groups:  make(map[string]*ETAGroup),
+		agg:     agg,
+	}
+}
+
+func (report *ETAReport) group(path string) *ETAGroup {
+	key := report.grouper.Group(path)
+	eg, ok := report.groups[key]
+	if !ok {
+		eg = &ETAGroup{Group: key}
+		report.groups[key] = eg
+	}
+	return eg
+}
+
+// AddDone counts a file which is backed up
+func (report *ETAReport) AddDone(path string, size int64) {
+	report.Total.Done.add(size)
+	report.group(path).Done.add(size)
+}
+
+// AddNotBackedUp counts a file which is not backed up (yet):
+// it is remaining, unless an exclusion rule explains it
+func (report *ETAReport) AddNotBackedUp(path string, size int64) {
+	if len(report.rules.Explain(path)) > 0 {
+		report.Total.Excluded.add(size)
+		report.group(path).Excluded.add(size)
+		return
+	}
+	report.Total.Remaining.add(size)
+	report.group(path).Remaining.add(size)
+}
+
+// AddTransmitted counts a transmission towards the daily rates
+func (report *ETAReport) AddTransmitted(tx Transmitted) {
+	report.agg.Add(tx)
+}
+
+// Estimate computes the rates over the last Window days up to today, and the ETAs.
+// Groups are sorted by remaining bytes, largest first.
+func (report *ETAReport) Estimate() {
+	now := time.Now()
+	if report.Now != nil {
+		now = report.Now()
+	}
+	// as the buckets: the wall clock day, in UTC
+	report.Today = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	buckets := report.agg.Buckets()
+	if len(buckets) > 0 {
+		report.Last = buckets[len(buckets)-1].Start
+		if report.Today.Before(report.Last) {
+			report.Today = report.Last
+		}
+		report.Idle = int(report.Today.Sub(report.Last).Hours()/24 + 0.5)
+	}
+	since := report.Today.AddDate(0, 0, -report.Window+1)
+	total := make(map[int64]int)
+	daily := make(map[string][]int)
+	for _, b := range buckets {
+		if b.Start.Before(since) {
+			continue
+		}
+		total[b.Start.Unix()] += int(b.Bytes)
+		daily[b.Group] = append(daily[b.Group], int(b.Bytes))
+	}
+	// the buckets end with the last transmission, the idle days of the window since are zero filled
+	for day := report.Last.AddDate(0, 0, 1); len(buckets) > 0 && !day.After(report.Today); day = day.AddDate(0, 0, 1) {
+		if day.Before(since) {
+			continue
+		}
+		total[day.Unix()] = 0
+		for group := range daily {
+			daily[group] = append(daily[group], 0)
+		}
+	}
+	totals := make([]int, 0, len(total))
+	for _, bytes := range total {
+		totals = append(totals, bytes)
+	}
+	report.Total.Group = "total"
+	report.Total.estimate(totals)
+
+	report.Groups = make([]ETAGroup, 0, len(report.groups))
+	for key, eg := range report.groups {
+		eg.estimate(daily[key])
+		report.Groups = append(report.Groups, *eg)
+	}
+	sort.Slice(report.Groups, func(i, j int) bool {
+		if report.Groups[i].Remaining.Bytes == report.Groups[j].Remaining.Bytes {
+			return report.Groups[i].Group < report.Groups[j].Group
+		}
+		return report.Groups[i].Remaining.Bytes > report.Groups[j].Remaining.Bytes
+	})
+}
+
+func (eg *ETAGroup) estimate(daily []int) {
+	sort.Ints(daily)
+	sum := 0
+	for _, bytes := range daily {
+		sum += bytes
+	}
+	if len(daily) > 0 {
+		eg.Rate = DailyRate{
+			Mean: int64(sum / len(daily)),
+			Low:  int64(percentile(daily, 10)),
+			High: int64(percentile(daily, 90)),
+		}
+	}
+	// with few active days, the percentiles can miss the mean
+	high, low := eg.Rate.High, eg.Rate.Low
+	if high < eg.Rate.Mean {
+		high = eg.Rate.Mean
+	}
+	if low > eg.Rate.Mean {
+		low = eg.Rate.Mean
+	}
+	eg.ETA = ETARange{
+		Days:     daysAt(eg.Remaining.Bytes, eg.Rate.Mean),
+		Earliest: daysAt(eg.Remaining.Bytes, high),
+		Latest:   daysAt(eg.Remaining.Bytes, low),
+	}
+}
+
+// daysAt is the number of days to transmit remaining bytes at rate bytes/day, -1 for never
+func daysAt(remaining, rate int64) float64 {
+	if remaining == 0 {
+		return 0
+	}
+	if rate <= 0 {
+		return -1
+	}
+	return float64(remaining) / float64(rate)
+}
+
+// WriteFormat writes the report in one of the Format* formats
+func (report *ETAReport) WriteFormat(w io.Writer, format string) error {
+	switch format {
+	case FormatText:
+		return report.WriteText(w)
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	case FormatJSONL:
+		return report.WriteJSONL(w)
+	case FormatCSV:
+		return report.WriteCSV(w)
+	}
+	return fmt.Errorf("unknown format: %q", format)
+}
+
+// WriteJSONL writes the total, then one line per group, each with a "record" field (total,group)
+func (report *ETAReport) WriteJSONL(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	enc.Encode(struct {
+		Record string    `json:"record"`
+		Window int       `json:"window"`
+		Today  time.Time `json:"today"`
+		Last   time.Time `json:"last"`
+		Idle   int       `json:"idle"`
+		ETAGroup
+	}{"total", report.Window, report.Today, report.Last, report.Idle, report.Total})
+	for _, eg := range report.Groups {
+		enc.Encode(struct {
+			Record string `json:"record"`
+			ETAGroup
+		}{"group", eg})
+	}
+	return bw.Flush()
+}
+
+// WriteCSV writes a single table, with a header:
+// record,key,doneFiles,doneBytes,remainingFiles,remainingBytes,rateMean,rateLow,rateHigh,days,earliest,latest
+func (report *ETAReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"record", "key", "doneFiles", "doneBytes", "remainingFiles", "remainingBytes",
+		"rateMean", "rateLow", "rateHigh", "days", "earliest", "latest"})
+	days := func(d float64) string { return strconv.FormatFloat(d, 'f', 1, 64) }
+	row := func(record string, eg ETAGroup) {
+		cw.Write([]string{record, eg.Group,
+			strconv.Itoa(eg.Done.Files), strconv.FormatInt(eg.Done.Bytes, 10),
+			strconv.Itoa(eg.Remaining.Files), strconv.FormatInt(eg.Remaining.Bytes, 10),
+			strconv.FormatInt(eg.Rate.Mean, 10), strconv.FormatInt(eg.Rate.Low, 10), strconv.FormatInt(eg.Rate.High, 10),
+			days(eg.ETA.Days), days(eg.ETA.Earliest), days(eg.ETA.Latest)})
+	}
+	row("total", report.Total)
+	for _, eg := range report.Groups {
+		row("group", eg)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteText writes the report for humans, with the ETAs as dates
+func (report *ETAReport) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "ETA: rates over the %d days up to %s\n", report.Window, report.Today.Format("2006-01-02"))
+	if report.Idle > 1 {
+		fmt.Fprintf(bw, "ETA: stalled, nothing transmitted since %s (%d days)\n", report.Last.Format("2006-01-02"), report.Idle)
+	}
+	fmt.Fprintf(bw, "ETA: (done remaining : rate/day [low,high] : eta [earliest,latest])\n")
+	line := func(eg ETAGroup) {
+		fmt.Fprintf(bw, " %10s %10s : %10s [%s,%s] : %s [%s,%s] : %s\n",
+			HumanBytes(eg.Done.Bytes), HumanBytes(eg.Remaining.Bytes),
+			HumanBytes(eg.Rate.Mean), HumanBytes(eg.Rate.Low), HumanBytes(eg.Rate.High),
+			report.date(eg.ETA.Days), report.date(eg.ETA.Earliest), report.date(eg.ETA.Latest), eg.Group)
+	}
+	line(report.Total)
+	for _, eg := range report.Groups {
+		line(eg)
+	}
+	return bw.Flush()
+}
+
+func (report *ETAReport) date(days float64) string {
+	if days < 0 {
+		return "never"
+	}
+	end := report.Today.AddDate(0, 0, 1)
+	return end.Add(time.Duration(days * 24 * float64(time.Hour))).Format("2006-01-02")
+}
@@ -0,0 +1,170 @@
+package backblaze
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+// today is 2018-10-06, unless now is given
+func etaSample(now ...time.Time) *ETAReport {
+	report := NewETAReport(DefaultExclusionRules(), DepthGrouper{Depth: 1, Anchor: VolumeAnchor}, 4)
+	report.Now = func() time.Time { return time.Date(2018, 10, 6, 20, 0, 0, 0, time.Local) }
+	if len(now) > 0 {
+		report.Now = func() time.Time { return now[0] }
+	}
+	report.AddDone("/Users/daniel/a.txt", 100)
+	report.AddDone("/Volumes/Space/archive/b.jpg", 1000)
+	report.AddNotBackedUp("/Volumes/Space/archive/c.jpg", 8000)
+	report.AddNotBackedUp("/Users/daniel/d.txt", 500)
+	report.AddNotBackedUp("/Users/daniel/big.iso", 1<<30) // excluded
+	for _, tx := range []Transmitted{
+		// outside the 4 day window
+		{Stamp: "2018-10-01 10:00:00", Size: 1 << 20, FName: "/Volumes/Space/archive/x.jpg"},
+		{Stamp: "2018-10-03 10:00:00", Size: 1000, FName: "/Volumes/Space/archive/x.jpg"},
+		// 2018-10-04 nothing
+		{Stamp: "2018-10-05 10:00:00", Size: 2000, FName: "/Volumes/Space/archive/y.jpg"},
+		{Stamp: "2018-10-06 10:00:00", Size: 3000, FName: "/Volumes/Space/archive/z.jpg"},
+		{Stamp: "2018-10-06 11:00:00", Size: 2000, FName: "/Users/daniel/e.txt"},
+	} {
+		report.AddTransmitted(tx)
+	}
+	report.Estimate()
+	return report
+}
+
+func TestETAReport(t *testing.T) {
+	report := etaSample()
+	if !report.Last.Equal(time.Date(2018, 10, 6, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected last day: %v", report.Last)
+	}
+	total := report.Total
+	if total.Done != (FileTotal{2, 1100}) || total.Remaining != (FileTotal{2, 8500}) || total.Excluded != (FileTotal{1, 1 << 30}) {
+		t.Errorf("unexpected total: %+v", total)
+	}
+	// daily totals over the window: 1000, 0, 2000, 5000
+	if total.Rate != (DailyRate{Mean: 2000, Low: 0, High: 5000}) {
+		t.Errorf("unexpected total rate: %+v", total.Rate)
+	}
+	if total.ETA != (ETARange{Days: 4.25, Earliest: 1.7, Latest: -1}) {
+		t.Errorf("unexpected total eta: %+v", total.ETA)
+	}
+	if len(report.Groups) != 2 {
+		t.Fatalf("expected 2 groups, got %+v", report.Groups)
+	}
+	space := report.Groups[0]
+	if space.Group != "/Volumes/Space/archive/" || space.Remaining.Bytes != 8000 {
+		t.Errorf("unexpected first group: %+v", space)
+	}
+	// daily: 1000, 0, 2000, 3000
+	if space.Rate != (DailyRate{Mean: 1500, Low: 0, High: 3000}) {
+		t.Errorf("unexpected group rate: %+v", space.Rate)
+	}
+	users := report.Groups[1]
+	if users.Group != "/Users/" || users.Remaining.Bytes != 500 || users.Rate.Mean != 500 || users.ETA.Days != 1 {
+		t.Errorf("unexpected second group: %+v", users)
+	}
+}
+
+func TestETAEdgeCases(t *testing.T) {
+	var data = []struct {
+		name      string
+		remaining int64
+		in        []Transmitted
+		rate      DailyRate
+		eta       ETARange
+	}{
+		// nothing remaining is done now
+		{"empty", 0, nil, DailyRate{}, ETARange{}},
+		// no transmissions is never done
+		{"no history", 1000, nil, DailyRate{}, ETARange{Days: -1, Earliest: -1, Latest: -1}},
+		{"one record", 1000, []Transmitted{{Stamp: "2018-10-07 10:00:00", Size: 500, FName: "/a/x"}},
+			DailyRate{Mean: 500, Low: 500, High: 500}, ETARange{Days: 2, Earliest: 2, Latest: 2}},
+		{"unparsable stamps", 1000, []Transmitted{{Stamp: "2018-10-07", Size: 500, FName: "/a/x"}, {Stamp: "yesterday", Size: 500, FName: "/a/y"}},
+			DailyRate{}, ETARange{Days: -1, Earliest: -1, Latest: -1}},
+	}
+	for _, tt := range data {
+		report := NewETAReport(nil, DepthGrouper{Depth: 1}, DefaultETAWindow)
+		report.Now = func() time.Time { return time.Date(2018, 10, 7, 20, 0, 0, 0, time.Local) }
+		report.AddDone("/a/b", 1)
+		if tt.remaining > 0 {
+			report.AddNotBackedUp("/a/c", tt.remaining)
+		}
+		for _, tx := range tt.in {
+			report.AddTransmitted(tx)
+		}
+		report.Estimate()
+		if report.Total.Rate != tt.rate || report.Total.ETA != tt.eta {
+			t.Errorf("%s: unexpected rate %+v, eta %+v", tt.name, report.Total.Rate, report.Total.ETA)
+		}
+		if err := report.WriteFormat(ioutil.Discard, FormatText); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+}
+
+func TestETAWriteFormat(t *testing.T) {
+	report := etaSample()
+	var buf bytes.Buffer
+	if err := report.WriteFormat(&buf, FormatCSV); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	expected := []string{
+		"record,key,doneFiles,doneBytes,remainingFiles,remainingBytes,rateMean,rateLow,rateHigh,days,earliest,latest",
+		"total,total,2,1100,2,8500,2000,0,5000,4.2,1.7,-1.0",
+		"group,/Volumes/Space/archive/,1,1000,1,8000,1500,0,3000,5.3,2.7,-1.0",
+		"group,/Users/,1,100,1,500,500,0,2000,1.0,0.2,-1.0",
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected\n%s\ngot\n%s", strings.Join(expected, "\n"), buf.String())
+	}
+
+}
+
+func TestETAClampsRange(t *testing.T) {
+	// two active days out of 14: the 90th percentile is 1, below the mean
+	report := NewETAReport(nil, DepthGrouper{Depth: 1}, 14)
+	report.Now = func() time.Time { return time.Date(2018, 10, 7, 20, 0, 0, 0, time.Local) }
+	report.AddNotBackedUp("/a/b", 1000)
+	report.AddTransmitted(Transmitted{Stamp: "2018-09-24 10:00:00", Size: 1, FName: "/a/x"})
+	report.AddTransmitted(Transmitted{Stamp: "2018-10-07 10:00:00", Size: 700, FName: "/a/y"})
+	report.Estimate()
+	if report.Total.Rate != (DailyRate{Mean: 50, Low: 0, High: 1}) {
+		t.Errorf("unexpected rate: %+v", report.Total.Rate)
+	}
+	if report.Total.ETA != (ETARange{Days: 20, Earliest: 20, Latest: -1}) {
+		t.Errorf("unexpected eta: %+v", report.Total.ETA)
+	}
+}
+
+func TestETAStalled(t *testing.T) {
+	// the last transmission was on 2018-10-06, 3 days ago
+	report := etaSample(time.Date(2018, 10, 9, 8, 0, 0, 0, time.Local))
+	if !report.Today.Equal(time.Date(2018, 10, 9, 0, 0, 0, 0, time.UTC)) || report.Idle != 3 {
+		t.Errorf("unexpected today: %v, idle: %d", report.Today, report.Idle)
+	}
+	// daily totals over the window: 5000, 0, 0, 0
+	if report.Total.Rate != (DailyRate{Mean: 1250, Low: 0, High: 5000}) {
+		t.Errorf("unexpected total rate: %+v", report.Total.Rate)
+	}
+	// daily: 3000, 0, 0, 0
+	if space := report.Groups[0]; space.Rate.Mean != 750 {
+		t.Errorf("unexpected group rate: %+v", space.Rate)
+	}
+	var buf bytes.Buffer
+	if err := report.WriteFormat(&buf, FormatText); err != nil {
+		t.Fatal(err)
+	}
+	// 2018-10-09 + 1 + 6.8 days
+	for _, line := range []string{
+		"ETA: stalled, nothing transmitted since 2018-10-06 (3 days)\n",
+		"8.30 KiB :   1.22 KiB [0 B,4.88 KiB] : 2018-10-16 [2018-10-11,never] : total\n",
+	} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("expected %q in:\n%s", line, buf.String())
+		}
+	}
+}
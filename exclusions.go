@@ -0,0 +1,256 @@
+package backblaze
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Kinds of ExclusionRule
+const (
+	SuffixRule = "suffix"
+	RegexRule  = "regex"
+	DirRule    = "dir"
+)
+
+// ExclusionRule is one reason for Backblaze to skip a file
+type ExclusionRule struct {
+	Kind    string `json:"kind"`
+	Pattern string `json:"pattern"`
+
+	re *regexp.Regexp
+}
+
+// NewExclusionRule validates (and compiles) a rule of the given kind
+func NewExclusionRule(kind, pattern string) (*ExclusionRule, error) {
+	rule := &ExclusionRule{Kind: kind, Pattern: pattern}
+	switch kind {
+	case SuffixRule:
+		rule.Pattern = strings.ToLower(pattern)
+	case DirRule:
+		rule.Pattern = strings.ToLower(pattern)
+		if !strings.HasSuffix(rule.Pattern, "/") {
+			rule.Pattern += "/"
+		}
+	case RegexRule:
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		rule.re = re
+	default:
+		return nil, fmt.Errorf("unknown exclusion rule kind: %q", kind)
+	}
+	return rule, nil
+}
+
+// Match reports whether the rule excludes path
+func (rule *ExclusionRule) Match(path string) bool {
+	switch rule.Kind {
+	case SuffixRule:
+		return strings.HasSuffix(strings.ToLower(path), rule.Pattern)
+	case DirRule:
+		return strings.HasPrefix(strings.ToLower(path), rule.Pattern)
+	case RegexRule:
+		return rule.re.MatchString(path)
+	}
+	return false
+}
+
+// String is the rule's name in reports: kind:pattern
+func (rule *ExclusionRule) String() string {
+	return rule.Kind + ":" + rule.Pattern
+}
+
+// ExclusionRules is an ordered set of rules
+type ExclusionRules []*ExclusionRule
+
+// Explain returns the names of all rules matching path, empty if path is unexplained
+func (rules ExclusionRules) Explain(path string) []string {
+	reasons := make([]string, 0)
+	for _, rule := range rules {
+		if rule.Match(path) {
+			reasons = append(reasons, rule.String())
+		}
+	}
+	return reasons
+}
+
+// Apply returns a copy of rules, without the removed rules (by name), and with the added ones.
+// Removing a rule which is not in rules is an error.
+func (rules ExclusionRules) Apply(added, removed ExclusionRules) (ExclusionRules, error) {
+	drop := make(map[string]bool)
+	for _, rule := range removed {
+		drop[rule.String()] = true
+	}
+	applied := make(ExclusionRules, 0, len(rules)+len(added))
+	for _, rule := range rules {
+		if drop[rule.String()] {
+			delete(drop, rule.String())
+			continue
+		}
+		applied = append(applied, rule)
+	}
+	for _, rule := range removed {
+		if drop[rule.String()] {
+			return nil, fmt.Errorf("cannot remove %s: no such rule", rule)
+		}
+	}
+	return append(applied, added...), nil
+}
+
+// ParseRuleChanges reads a proposed change to the rules, one per line:
+//
+//	# comments and blank lines are ignored
+//	+ suffix .vmdk
+//	- regex (?i)^/users/.*/library/caches/
+//	+ dir /Users/daniel/Downloads/
+func ParseRuleChanges(r io.Reader) (added, removed ExclusionRules, err error) {
+	added = make(ExclusionRules, 0)
+	removed = make(ExclusionRules, 0)
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) != 3 || (fields[0] != "+" && fields[0] != "-") {
+			return nil, nil, fmt.Errorf("line %d: expected '+|- kind pattern': %q", lineNo, line)
+		}
+		rule, err := NewExclusionRule(fields[1], strings.TrimSpace(fields[2]))
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		if fields[0] == "+" {
+			added = append(added, rule)
+		} else {
+			removed = append(removed, rule)
+		}
+	}
+	return added, removed, scanner.Err()
+}
+
+/*
+ParseBzInfoExclusions returns a DirRule for every excluded directory in bzinfo.xml:
+
+	<bzdirfilter dir="/users/daniel/downloads/" whattodo="exclude" />
+*/
+func ParseBzInfoExclusions(r io.Reader) (ExclusionRules, error) {
+	rc, err := Decompress(r)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	rules := make(ExclusionRules, 0)
+	dec := xml.NewDecoder(rc)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return rules, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok || se.Name.Local != "bzdirfilter" {
+			continue
+		}
+		var dir, whattodo string
+		for _, attr := range se.Attr {
+			switch attr.Name.Local {
+			case "dir":
+				dir = attr.Value
+			case "whattodo":
+				whattodo = attr.Value
+			}
+		}
+		if whattodo == "exclude" && len(dir) > 0 {
+			rule, _ := NewExclusionRule(DirRule, dir)
+			rules = append(rules, rule)
+		}
+	}
+}
+
+// see /Library/Backblaze.bzpkg/bzdata/bzexcluderules_mandatory.xml
+// see /Library/Backblaze.bzpkg/bzdata/bzexcluderules_editable.xml
+// wab~,vmc,vhd,vhdx,vdi,vo1,vo2,vsv,vud,iso,dmg,sparseimage,sys,cab,
+// exe,msi,dll,dl_,wim,ost,o,qtch,log,ithmb,vmdk,vmem,vmsd,vmsn,vmss,vmx,vmxf,
+// menudata,appicon,appinfo,pva,pvs,pvi,pvm,fdd,hds,drk,mem,nvram,hdd
+var defaultSuffixes = []string{
+	".lockn",
+	".ds_store",
+	".localized",
+	".log",
+	".exe",
+	".dmg",
+	".iso",
+	".sys",
+	".o",
+	".ithmb",
+	".dll",
+	".vmdk",
+	".vdi",
+	".msi",
+}
+
+var defaultRegexes = []string{
+	"(?i)^/(volumes/[[:alnum:]]+/)?.bzvol/(README.txt|bzvol_id.xml)$",
+	"(?i)^/.file",
+	"(?i)^/users/.*/.trash",
+	"(?i)^/users/.*/library/.*saved application state",
+	"(?i)^/users/.*/library/logs/",
+	"(?i)^/users/.*/iphoto library/thumbnails/",
+	"(?i)^/users/.*/iphoto library.migratedphotolibrary/thumbnails/",
+	"(?i)^/users/.*/photos library.photoslibrary/thumbnails/",
+	"(?i)^/users/.*/movies/.*render files/",
+	// <excludefname_rule plat="mac" osVers="*"  ruleIsOptional="f" skipFirstCharThenStartsWith="users/" contains_1="/itunes/" contains_2="*" doesNotContain="*" endsWith="*" hasFileExtension="ipsw" />                             <!-- iPod software updates -->
+	"(?i)^/users/.*/itunes/.*\\.ipsw$",
+	"(?i)^/users/.*/itunes/itunes music/podcasts/",
+	"(?i)^/users/.*/itunes/itunes media/podcasts/",
+
+	"(?i)^/users/.*/library/mail/v2/maildata/envelope index(-shm|-wal)?$",
+	"(?i)^/users/.*/library/mail/v2/maildata/availablefeeds(-shm|-wal)?$",
+	"(?i)^/users/.*/library/mail/v2/maildata/defaultcounts$",
+	"(?i)^/users/.*/library/mail/v2/maildata/lsmmap2$",
+
+	"(?i)^/users/.*/library/safari/(icons|historyindex\\.sk|webpageicons\\.db)",
+
+	"(?i)^/users/shared/blizzard",
+
+	"(?i)^/users/.*/library/application support/syncservices/local/",
+	"(?i)^/users/.*/library/application support/google/chrome/.*safe browsing",
+	"(?i)^/users/.*/library/application support/google/chrome/default/.*history",
+	"(?i)^/users/.*/library/application support/google/chrome/default/.*thumbnails",
+	"(?i)^/users/.*/library/application support/google/chrome/default/.*archived history",
+	// minus the bookmarks
+	"(?i)^/users/.*/library/application support/firefox",
+	// minus the bookmarks
+	"(?i)^/users/.*/library/cache/firefox/profiles",
+	"(?i)^/users/.*/library/caches/",
+	"(?i)^/developer",
+	"(?i)^/users/.*/library/developer/.*shared/documentation/",
+	"(?i)^/users/.*/library/developer/.*xcode/ios devicesupport/",
+}
+
+// DefaultExclusionRules are the rules we reverse engineered from Backblaze's own exclusions
+func DefaultExclusionRules() ExclusionRules {
+	rules := make(ExclusionRules, 0, len(defaultSuffixes)+len(defaultRegexes))
+	for _, suffix := range defaultSuffixes {
+		rule, _ := NewExclusionRule(SuffixRule, suffix)
+		rules = append(rules, rule)
+	}
+	for _, pattern := range defaultRegexes {
+		rule, err := NewExclusionRule(RegexRule, pattern)
+		if err != nil {
+			panic(err) // our own table, must compile
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
@@ -0,0 +1,171 @@
+package backblaze
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	var data = []struct {
+		path string
+		out  []string
+	}{
+		{
+			path: "/Users/daniel/Code/main.go",
+			out:  []string{},
+		},
+		{
+			path: "/Users/daniel/Documents/.DS_Store",
+			out:  []string{"suffix:.ds_store"},
+		},
+		{
+			path: "/Users/daniel/Library/Logs/install.log",
+			out:  []string{"suffix:.log", "regex:(?i)^/users/.*/library/logs/"},
+		},
+		{
+			path: "/Volumes/Space/.bzvol/bzvol_id.xml",
+			out:  []string{"regex:(?i)^/(volumes/[[:alnum:]]+/)?.bzvol/(README.txt|bzvol_id.xml)$"},
+		},
+		{
+			path: "/Users/daniel/Music/iTunes/iPod Software Updates/iPhone.ipsw",
+			out:  []string{"regex:(?i)^/users/.*/itunes/.*\\.ipsw$"},
+		},
+	}
+	rules := DefaultExclusionRules()
+	for _, tt := range data {
+		got := rules.Explain(tt.path)
+		if !reflect.DeepEqual(tt.out, got) {
+			t.Errorf("Test:%s\nexpected: %q\ngot: %q", tt.path, tt.out, got)
+		}
+	}
+}
+
+func TestNewExclusionRule(t *testing.T) {
+	var data = []struct {
+		kind    string
+		pattern string
+		name    string
+		isErr   bool
+	}{
+		{kind: SuffixRule, pattern: ".VMDK", name: "suffix:.vmdk"},
+		{kind: RegexRule, pattern: "(?i)^/developer", name: "regex:(?i)^/developer"},
+		{kind: RegexRule, pattern: "(", isErr: true},
+		{kind: "glob", pattern: "*.o", isErr: true},
+	}
+	for _, tt := range data {
+		rule, err := NewExclusionRule(tt.kind, tt.pattern)
+		if tt.isErr {
+			if err == nil {
+				t.Errorf("Test:%s:%s expected an error", tt.kind, tt.pattern)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test:%s:%s unexpected error: %v", tt.kind, tt.pattern, err)
+			continue
+		}
+		if rule.String() != tt.name {
+			t.Errorf("Test:%s:%s expected: %s got: %s", tt.kind, tt.pattern, tt.name, rule)
+		}
+	}
+}
+
+func TestParseRuleChanges(t *testing.T) {
+	var data = []struct {
+		name    string
+		in      string
+		added   []string
+		removed []string
+		isErr   bool
+	}{
+		{
+			name:    "Empty",
+			in:      "# nothing\n\n",
+			added:   []string{},
+			removed: []string{},
+		},
+		{
+			name:    "AddRemove",
+			in:      "+ suffix .JPG\n- regex (?i)^/users/.*/library/caches/\n  + dir /Users/daniel/Downloads  \n",
+			added:   []string{"suffix:.jpg", "dir:/users/daniel/downloads/"},
+			removed: []string{"regex:(?i)^/users/.*/library/caches/"},
+		},
+		{
+			name:  "BadOp",
+			in:    "* suffix .jpg\n",
+			isErr: true,
+		},
+		{
+			name:  "BadKind",
+			in:    "+ glob *.jpg\n",
+			isErr: true,
+		},
+	}
+	names := func(rules ExclusionRules) []string {
+		n := make([]string, 0)
+		for _, rule := range rules {
+			n = append(n, rule.String())
+		}
+		return n
+	}
+	for _, tt := range data {
+		added, removed, err := ParseRuleChanges(strings.NewReader(tt.in))
+		if tt.isErr {
+			if err == nil {
+				t.Errorf("Test:%s expected an error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test:%s unexpected error: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(tt.added, names(added)) || !reflect.DeepEqual(tt.removed, names(removed)) {
+			t.Errorf("Test:%s expected: +%q -%q got: +%q -%q", tt.name, tt.added, tt.removed, names(added), names(removed))
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	rules := DefaultExclusionRules()
+	iso, _ := NewExclusionRule(SuffixRule, ".iso")
+	jpg, _ := NewExclusionRule(SuffixRule, ".jpg")
+	applied, err := rules.Apply(ExclusionRules{jpg}, ExclusionRules{iso})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(rules) {
+		t.Errorf("expected %d rules, got %d", len(rules), len(applied))
+	}
+	if got := applied.Explain("/a/b.ISO"); len(got) != 0 {
+		t.Errorf("expected .iso to be removed, got %q", got)
+	}
+	if got := applied.Explain("/a/b.jpg"); !reflect.DeepEqual(got, []string{"suffix:.jpg"}) {
+		t.Errorf("expected .jpg to be added, got %q", got)
+	}
+	if got := rules.Explain("/a/b.iso"); len(got) != 1 {
+		t.Errorf("expected original rules to be unchanged, got %q", got)
+	}
+	if _, err := rules.Apply(nil, ExclusionRules{jpg}); err == nil {
+		t.Errorf("expected removing a rule which does not exist to fail")
+	}
+}
+
+func TestParseBzInfoExclusions(t *testing.T) {
+	infile, err := os.Open("./test/data/bzdata/bzinfo.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer infile.Close()
+	rules, err := ParseBzInfoExclusions(infile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := rules.Explain("/Users/daniel/VMs/win10.vmdk")
+	expected := []string{"dir:/users/daniel/vms/"}
+	if len(rules) != 2 || !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected 2 rules matching %q, got %d rules matching %q", expected, len(rules), got)
+	}
+}
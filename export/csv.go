@@ -0,0 +1,23 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+)
+
+// CSVHeader is the header of the exported CSV files, the timestamp is RFC3339, with its offset
+var CSVHeader = []string{"type", "timestamp", "size", "speed", "chunk", "path"}
+
+// WriteCSV writes records, with a header
+func WriteCSV(w io.Writer, records []Record) error {
+	cw := csv.NewWriter(w)
+	cw.Write(CSVHeader)
+	for _, rec := range records {
+		cw.Write([]string{rec.Type, rec.Timestamp.Format(time.RFC3339), strconv.FormatInt(rec.Size, 10),
+			strconv.Itoa(int(rec.Speed)), strconv.Itoa(int(rec.Chunk)), rec.Path})
+	}
+	cw.Flush()
+	return cw.Error()
+}
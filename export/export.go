@@ -0,0 +1,111 @@
+// Package export writes transmission records as columnar (Parquet) or CSV files,
+// partitioned by host and date, in the hive layout: <dir>/host=<host>/date=<yyyy-mm-dd>/transmitted.<ext>,
+// so months of history can be queried with DuckDB or pandas, e.g.
+//
+//	SELECT * FROM read_parquet('export/*/*/*.parquet', hive_partitioning = true)
+package export
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/daneroo/backblaze"
+)
+
+// Export formats
+const (
+	FormatCSV     = "csv"
+	FormatParquet = "parquet"
+)
+
+// Record is the schema of an exported transmission record
+type Record struct {
+	Type      string    // Normal, Chunked, Dedup, ...
+	Timestamp time.Time // the stamp, in the timezone it was logged in
+	Size      int64     // bytes
+	Speed     int32     // kBits/sec, of the whole request for batched files, 0 for dedup
+	Chunk     int32     // chunk number, negative for files batched in one request
+	Path      string
+}
+
+// NewRecord converts a parsed record, whose stamp is in loc
+func NewRecord(tx backblaze.Transmitted, loc *time.Location) (Record, error) {
+	t, err := backblaze.ParseStamp(tx.Stamp, loc)
+	if err != nil {
+		return Record{}, err
+	}
+	return Record{
+		Type:      string(tx.Type),
+		Timestamp: t,
+		Size:      int64(tx.Size),
+		Speed:     int32(tx.Speed),
+		Chunk:     int32(tx.Chunk),
+		Path:      tx.FName,
+	}, nil
+}
+
+// Exporter writes partitions under Dir, in Format
+type Exporter struct {
+	Dir      string
+	Format   string
+	Location *time.Location // of the stamps, time.Local if nil
+}
+
+// Stats counts what Export wrote
+type Stats struct {
+	Files   []string
+	Records int
+	Skipped int // unparsable stamps
+}
+
+// Export writes host's records, a file per date, replacing the files of the dates already exported
+func (e *Exporter) Export(host string, records []backblaze.Transmitted) (Stats, error) {
+	stats := Stats{Files: make([]string, 0)}
+	write, err := e.writer()
+	if err != nil {
+		return stats, err
+	}
+	loc := e.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	byDate := make(map[string][]Record)
+	for _, tx := range records {
+		rec, err := NewRecord(tx, loc)
+		if err != nil {
+			stats.Skipped++
+			continue
+		}
+		date := rec.Timestamp.Format("2006-01-02")
+		byDate[date] = append(byDate[date], rec)
+	}
+	dates := make([]string, 0, len(byDate))
+	for date := range byDate {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+	for _, date := range dates {
+		partition := byDate[date]
+		sort.SliceStable(partition, func(i, j int) bool { return partition[i].Timestamp.Before(partition[j].Timestamp) })
+		file := filepath.Join(e.Dir, "host="+host, "date="+date, "transmitted."+e.Format)
+		if err := backblaze.WriteFileAtomic(file, func(w io.Writer) error { return write(w, partition) }); err != nil {
+			return stats, fmt.Errorf("%s: %v", file, err)
+		}
+		stats.Files = append(stats.Files, file)
+		stats.Records += len(partition)
+	}
+	return stats, nil
+}
+
+func (e *Exporter) writer() (func(io.Writer, []Record) error, error) {
+	switch e.Format {
+	case FormatCSV:
+		return WriteCSV, nil
+	case FormatParquet:
+		return WriteParquet, nil
+	}
+	return nil, fmt.Errorf("unknown export format: %q", e.Format)
+}
@@ -0,0 +1,205 @@
+package export
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daneroo/backblaze"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+func sampleRecords(t *testing.T) []backblaze.Transmitted {
+	infile, err := os.Open("../test/data/transmitted-sample.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer infile.Close()
+	return backblaze.ParseTransmitedAll(infile)
+}
+
+func TestExportCSV(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	e := &Exporter{Dir: dir, Format: FormatCSV, Location: time.UTC}
+	stats, err := e.Export("galois", sampleRecords(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 11 records, on 3 days
+	if stats.Records != 11 || len(stats.Files) != 3 || stats.Skipped != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	first := filepath.Join(dir, "host=galois", "date=2018-10-01", "transmitted.csv")
+	if stats.Files[0] != first {
+		t.Errorf("expected %s, got %s", first, stats.Files[0])
+	}
+	data, err := ioutil.ReadFile(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if lines[0] != "type,timestamp,size,speed,chunk,path" {
+		t.Errorf("unexpected header: %q", lines[0])
+	}
+	if lines[1] != "CombinedContinued,2018-10-01T00:00:18Z,1645021,2632,-7,/Volumes/Space/archive/media/photo/dad/2003/2003_08_23/129-2919_IMG.JPG" {
+		t.Errorf("unexpected first record: %q", lines[1])
+	}
+
+	// exporting again replaces the partitions
+	if _, err := e.Export("galois", sampleRecords(t)); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := ioutil.ReadFile(first); string(again) != string(data) {
+		t.Errorf("expected the same partition after a second export")
+	}
+	if _, err := (&Exporter{Dir: dir, Format: "xml"}).Export("galois", nil); err == nil {
+		t.Errorf("expected an error for an unknown format")
+	}
+}
+
+// memFile is an in memory source.ParquetFile, to read back what WriteParquet wrote
+type memFile struct {
+	*bytes.Reader
+}
+
+func (f memFile) Write(p []byte) (int, error)                    { return 0, os.ErrInvalid }
+func (f memFile) Close() error                                   { return nil }
+func (f memFile) Open(name string) (source.ParquetFile, error)   { return f, nil }
+func (f memFile) Create(name string) (source.ParquetFile, error) { return nil, os.ErrInvalid }
+
+func TestWriteParquet(t *testing.T) {
+	records := make([]Record, 0)
+	for _, tx := range sampleRecords(t) {
+		rec, err := NewRecord(tx, time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, rec)
+	}
+	var buf bytes.Buffer
+	if err := WriteParquet(&buf, records); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	if !bytes.HasPrefix(data, []byte("PAR1")) || !bytes.HasSuffix(data, []byte("PAR1")) {
+		t.Fatalf("expected the parquet magic")
+	}
+	pr, err := reader.NewParquetReader(memFile{bytes.NewReader(data)}, new(parquetRecord), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.ReadStop()
+	if pr.GetNumRows() != int64(len(records)) {
+		t.Fatalf("expected %d rows, got %d", len(records), pr.GetNumRows())
+	}
+	rows := make([]parquetRecord, len(records))
+	if err := pr.Read(&rows); err != nil {
+		t.Fatal(err)
+	}
+	for i, row := range rows {
+		rec := records[i]
+		if row.Type != rec.Type || row.Timestamp != rec.Timestamp.Unix()*1000 || row.Size != rec.Size ||
+			row.Speed != rec.Speed || row.Chunk != rec.Chunk || row.Path != rec.Path {
+			t.Errorf("row %d: expected %+v, got %+v", i, rec, row)
+		}
+	}
+}
+
+func TestSQLite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := OpenDB(filepath.Join(dir, DBFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	load := func() LoadStats {
+		l, err := db.Begin("galois")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Rollback()
+		if err := l.AddTransmitted(sampleRecords(t)); err != nil {
+			t.Fatal(err)
+		}
+		files, _ := filepath.Glob("../test/data/bzdata/bzfilelists/v*filelist.dat")
+		files = append(files, "../test/data/bzdata/bzbackup/bzfileids.dat")
+		for _, file := range files {
+			infile, err := os.Open(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.HasSuffix(file, "bzfileids.dat") {
+				err = l.AddFileIds(infile)
+			} else {
+				err = l.AddFileList(infile)
+			}
+			infile.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := l.Explain(backblaze.DefaultExclusionRules()); err != nil {
+			t.Fatal(err)
+		}
+		if err := l.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		return l.Stats
+	}
+	stats := load()
+	// 6 not backed up (one unaccounted), and a duplicate fileid
+	expected := LoadStats{Transmissions: 11, FileList: 10, FileIds: 6, Skipped: 7, NotBackedUp: 6, Unaccounted: 1}
+	if stats != expected {
+		t.Errorf("expected %+v, got %+v", expected, stats)
+	}
+	// loading again replaces the host's rows
+	load()
+
+	var n int
+	if err := db.QueryRow("SELECT count(*) FROM uploads WHERE host = 'galois'").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 11 {
+		t.Errorf("expected 11 uploads, got %d", n)
+	}
+	var files, bytes, dedup int64
+	if err := db.QueryRow("SELECT files, bytes, dedup FROM daily_uploads WHERE date = '2018-10-02'").Scan(&files, &bytes, &dedup); err != nil {
+		t.Fatal(err)
+	}
+	if files != 4 || bytes != 26153736 || dedup != 2 {
+		t.Errorf("unexpected 2018-10-02 uploads: %d files, %d bytes, %d dedup", files, bytes, dedup)
+	}
+	var reasons string
+	if err := db.QueryRow("SELECT reasons FROM not_backed_up WHERE path = '/Users/daniel/VMs/win10.vmdk'").Scan(&reasons); err != nil {
+		t.Fatal(err)
+	}
+	if reasons != "suffix:.vmdk" {
+		t.Errorf("unexpected reasons: %q", reasons)
+	}
+	if err := db.QueryRow("SELECT count(*) FROM not_backed_up WHERE reasons IS NULL").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 unaccounted, got %d", n)
+	}
+	if err := db.QueryRow("SELECT files FROM rule_totals WHERE rule = 'regex:(?i)^/users/.*/library/caches/'").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 caches excluded, got %d", n)
+	}
+}
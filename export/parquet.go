@@ -0,0 +1,40 @@
+package export
+
+import (
+	"io"
+
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// parquetRecord is the Parquet schema of a Record; the timestamp is in UTC
+type parquetRecord struct {
+	Type      string `parquet:"name=type, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Timestamp int64  `parquet:"name=timestamp, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	Size      int64  `parquet:"name=size, type=INT64"`
+	Speed     int32  `parquet:"name=speed, type=INT32"`
+	Chunk     int32  `parquet:"name=chunk, type=INT32"`
+	Path      string `parquet:"name=path, type=BYTE_ARRAY, convertedtype=UTF8"`
+}
+
+// WriteParquet writes records as a single Parquet file (snappy compressed)
+func WriteParquet(w io.Writer, records []Record) error {
+	pw, err := writer.NewParquetWriterFromWriter(w, new(parquetRecord), 1)
+	if err != nil {
+		return err
+	}
+	pw.CompressionType = parquet.CompressionCodec_SNAPPY
+	for _, rec := range records {
+		if err := pw.Write(parquetRecord{
+			Type:      rec.Type,
+			Timestamp: rec.Timestamp.UnixNano() / 1e6,
+			Size:      rec.Size,
+			Speed:     rec.Speed,
+			Chunk:     rec.Chunk,
+			Path:      rec.Path,
+		}); err != nil {
+			return err
+		}
+	}
+	return pw.WriteStop()
+}
@@ -0,0 +1,358 @@
+package export
+
+import (
+	"database/sql"
+	"io"
+	"strings"
+
+	"github.com/daneroo/backblaze"
+
+	// pure Go, so the binaries stay CGO free (scratch image)
+	_ "modernc.org/sqlite"
+)
+
+// FormatSQLite loads the hosts into a single database, DBFile, rather than partitions
+const FormatSQLite = "sqlite"
+
+// DBFile is the name of the database, in the export directory
+const DBFile = "backblaze.db"
+
+// schema is normalized: hosts have volumes (their mount points), volumes have paths.
+// Transmissions, filelist and fileids entries refer to a path,
+// exclusions are the rules matching a path which is in the filelist but not in the fileids.
+// The views join them back, for ad-hoc queries, e.g. the directories under /Users/daniel
+// which uploaded more than 1 GB last week:
+//
+//	SELECT dir, sum(size) FROM uploads
+//	WHERE host = 'galois' AND dir GLOB '/Users/daniel/*' AND NOT dedup AND stamp >= datetime('now', 'localtime', '-7 days')
+//	GROUP BY dir HAVING sum(size) > 1e9 ORDER BY 2 DESC
+const schema = `
+CREATE TABLE IF NOT EXISTS hosts (
+	id   INTEGER PRIMARY KEY,
+	name TEXT NOT NULL UNIQUE
+);
+CREATE TABLE IF NOT EXISTS volumes (
+	id      INTEGER PRIMARY KEY,
+	host_id INTEGER NOT NULL REFERENCES hosts(id) ON DELETE CASCADE,
+	anchor  TEXT NOT NULL, -- mount point: /Volumes/<name>/ or /
+	UNIQUE (host_id, anchor)
+);
+CREATE TABLE IF NOT EXISTS paths (
+	id        INTEGER PRIMARY KEY,
+	volume_id INTEGER NOT NULL REFERENCES volumes(id) ON DELETE CASCADE,
+	dir       TEXT NOT NULL, -- with a trailing /
+	name      TEXT NOT NULL,
+	UNIQUE (volume_id, dir, name)
+);
+CREATE INDEX IF NOT EXISTS paths_dir ON paths(dir);
+CREATE TABLE IF NOT EXISTS transmissions (
+	path_id INTEGER NOT NULL REFERENCES paths(id) ON DELETE CASCADE,
+	stamp   TEXT NOT NULL, -- local time, as logged: yyyy-mm-dd hh:mm:ss
+	type    TEXT NOT NULL, -- Normal, Chunked, Dedup, ...
+	dedup   INTEGER NOT NULL, -- 1 if not sent
+	size    INTEGER NOT NULL, -- bytes
+	speed   INTEGER NOT NULL, -- kBits/sec
+	chunk   INTEGER NOT NULL  -- negative for files batched in one request
+);
+CREATE INDEX IF NOT EXISTS transmissions_stamp ON transmissions(stamp);
+CREATE INDEX IF NOT EXISTS transmissions_path ON transmissions(path_id);
+CREATE TABLE IF NOT EXISTS filelist (
+	path_id INTEGER PRIMARY KEY REFERENCES paths(id) ON DELETE CASCADE,
+	mtime   INTEGER NOT NULL, -- ms since epoch
+	size    INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS fileids (
+	path_id INTEGER PRIMARY KEY REFERENCES paths(id) ON DELETE CASCADE,
+	fileid  TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS rules (
+	id      INTEGER PRIMARY KEY,
+	host_id INTEGER NOT NULL REFERENCES hosts(id) ON DELETE CASCADE,
+	kind    TEXT NOT NULL, -- suffix, regex or dir
+	pattern TEXT NOT NULL,
+	UNIQUE (host_id, kind, pattern)
+);
+CREATE TABLE IF NOT EXISTS exclusions (
+	path_id INTEGER NOT NULL REFERENCES paths(id) ON DELETE CASCADE,
+	rule_id INTEGER NOT NULL REFERENCES rules(id) ON DELETE CASCADE,
+	PRIMARY KEY (path_id, rule_id)
+);
+CREATE INDEX IF NOT EXISTS exclusions_rule ON exclusions(rule_id);
+
+CREATE VIEW IF NOT EXISTS files AS
+SELECT paths.id AS path_id, hosts.name AS host, volumes.anchor AS volume, paths.dir, paths.name, paths.dir || paths.name AS path
+FROM paths
+JOIN volumes ON volumes.id = paths.volume_id
+JOIN hosts ON hosts.id = volumes.host_id;
+
+CREATE VIEW IF NOT EXISTS uploads AS
+SELECT files.host, files.volume, files.dir, files.path,
+	t.stamp, date(t.stamp) AS date, t.type, t.dedup, t.size, t.speed, t.chunk
+FROM transmissions t
+JOIN files ON files.path_id = t.path_id;
+
+CREATE VIEW IF NOT EXISTS daily_uploads AS
+SELECT host, date, count(*) - sum(dedup) AS files, sum(CASE WHEN dedup THEN 0 ELSE size END) AS bytes, sum(dedup) AS dedup
+FROM uploads
+GROUP BY host, date;
+
+CREATE VIEW IF NOT EXISTS not_backed_up AS
+SELECT files.host, files.volume, files.dir, files.path, fl.size,
+	(SELECT group_concat(rules.kind || ':' || rules.pattern, ' ')
+	 FROM exclusions JOIN rules ON rules.id = exclusions.rule_id
+	 WHERE exclusions.path_id = fl.path_id) AS reasons -- NULL when unaccounted for
+FROM filelist fl
+JOIN files ON files.path_id = fl.path_id
+LEFT JOIN fileids ON fileids.path_id = fl.path_id
+WHERE fileids.path_id IS NULL;
+
+CREATE VIEW IF NOT EXISTS rule_totals AS
+SELECT hosts.name AS host, rules.kind || ':' || rules.pattern AS rule, count(fl.path_id) AS files, coalesce(sum(fl.size), 0) AS bytes
+FROM rules
+JOIN hosts ON hosts.id = rules.host_id
+LEFT JOIN exclusions ON exclusions.rule_id = rules.id
+LEFT JOIN filelist fl ON fl.path_id = exclusions.path_id
+GROUP BY rules.id;
+`
+
+// DB is a SQLite database of the hosts' transmissions, filelists, fileids and exclusions
+type DB struct {
+	*sql.DB
+}
+
+// OpenDB opens (or creates) the database at path, and its schema
+func OpenDB(path string) (*DB, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// a single connection, so the pragma holds, and loads are serialized anyway
+	db.SetMaxOpenConns(1)
+	for _, stmt := range []string{"PRAGMA foreign_keys = ON", schema} {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return &DB{db}, nil
+}
+
+// LoadStats counts what a HostLoad inserted
+type LoadStats struct {
+	Transmissions int
+	FileList      int
+	FileIds       int
+	Skipped       int // malformed lines
+	NotBackedUp   int // in the filelist, not in the fileids
+	Unaccounted   int // not backed up, and no rule explains it
+}
+
+// HostLoad replaces a host's rows, in a transaction: nothing changes until Commit
+type HostLoad struct {
+	Stats LoadStats
+
+	tx      *sql.Tx
+	hostID  int64
+	volumes map[string]int64
+	paths   map[string]int64 // the ids of the paths inserted so far, filelists have millions
+}
+
+// Begin starts loading host, deleting its previous rows
+func (d *DB) Begin(host string) (*HostLoad, error) {
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	load := &HostLoad{tx: tx, volumes: make(map[string]int64), paths: make(map[string]int64)}
+	if _, err := tx.Exec("DELETE FROM hosts WHERE name = ?", host); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	res, err := tx.Exec("INSERT INTO hosts (name) VALUES (?)", host)
+	if err == nil {
+		load.hostID, err = res.LastInsertId()
+	}
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return load, nil
+}
+
+// Commit makes the host's new rows visible
+func (load *HostLoad) Commit() error {
+	return load.tx.Commit()
+}
+
+// Rollback abandons the load, the host's previous rows are kept
+func (load *HostLoad) Rollback() error {
+	return load.tx.Rollback()
+}
+
+// pathID returns the id of path, inserting it (and its volume) on first use
+func (load *HostLoad) pathID(path string) (int64, error) {
+	if id, ok := load.paths[path]; ok {
+		return id, nil
+	}
+	anchor := backblaze.VolumeAnchor(path)
+	volumeID, ok := load.volumes[anchor]
+	if !ok {
+		res, err := load.tx.Exec("INSERT INTO volumes (host_id, anchor) VALUES (?, ?)", load.hostID, anchor)
+		if err != nil {
+			return 0, err
+		}
+		if volumeID, err = res.LastInsertId(); err != nil {
+			return 0, err
+		}
+		load.volumes[anchor] = volumeID
+	}
+	i := strings.LastIndexByte(path, '/')
+	res, err := load.tx.Exec("INSERT INTO paths (volume_id, dir, name) VALUES (?, ?, ?)", volumeID, path[:i+1], path[i+1:])
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	load.paths[path] = id
+	return id, nil
+}
+
+// AddTransmitted inserts records, sent and dedup'd (see ParseTransmitedAll)
+func (load *HostLoad) AddTransmitted(records []backblaze.Transmitted) error {
+	stmt, err := load.tx.Prepare("INSERT INTO transmissions (path_id, stamp, type, dedup, size, speed, chunk) VALUES (?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, tx := range records {
+		id, err := load.pathID(tx.FName)
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.Exec(id, tx.Stamp, string(tx.Type), tx.Dedup(), tx.Size, tx.Speed, tx.Chunk); err != nil {
+			return err
+		}
+		load.Stats.Transmissions++
+	}
+	return nil
+}
+
+// AddFileList inserts the files of a filelist
+func (load *HostLoad) AddFileList(r io.Reader) error {
+	stmt, err := load.tx.Prepare("INSERT OR REPLACE INTO filelist (path_id, mtime, size) VALUES (?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	var insertErr error
+	skipped, err := backblaze.ParseFileList(r, func(entry backblaze.FileListEntry) {
+		if insertErr != nil {
+			return
+		}
+		var id int64
+		if id, insertErr = load.pathID(entry.Path); insertErr != nil {
+			return
+		}
+		if _, insertErr = stmt.Exec(id, entry.ModTime, entry.Size); insertErr == nil {
+			load.Stats.FileList++
+		}
+	})
+	load.Stats.Skipped += skipped
+	if insertErr != nil {
+		return insertErr
+	}
+	return err
+}
+
+// AddFileIds inserts the fileids (what is backed up)
+func (load *HostLoad) AddFileIds(r io.Reader) error {
+	stmt, err := load.tx.Prepare("INSERT OR REPLACE INTO fileids (path_id, fileid) VALUES (?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	var insertErr error
+	skipped, err := backblaze.ParseFileIds(r, func(fileid, path string) {
+		if insertErr != nil {
+			return
+		}
+		var id int64
+		if id, insertErr = load.pathID(path); insertErr != nil {
+			return
+		}
+		if _, insertErr = stmt.Exec(id, fileid); insertErr == nil {
+			load.Stats.FileIds++
+		}
+	})
+	load.Stats.Skipped += skipped
+	if insertErr != nil {
+		return insertErr
+	}
+	return err
+}
+
+// Explain inserts the rules, and which of them match each file not backed up,
+// so it must follow the filelists and fileids
+func (load *HostLoad) Explain(rules backblaze.ExclusionRules) error {
+	ruleIDs := make([]int64, len(rules))
+	for i, rule := range rules {
+		if _, err := load.tx.Exec("INSERT OR IGNORE INTO rules (host_id, kind, pattern) VALUES (?, ?, ?)", load.hostID, rule.Kind, rule.Pattern); err != nil {
+			return err
+		}
+		if err := load.tx.QueryRow("SELECT id FROM rules WHERE host_id = ? AND kind = ? AND pattern = ?", load.hostID, rule.Kind, rule.Pattern).Scan(&ruleIDs[i]); err != nil {
+			return err
+		}
+	}
+
+	type file struct {
+		id   int64
+		path string
+	}
+	// read them all first: the connection can't insert while the rows are open
+	notBackedUp := make([]file, 0)
+	rows, err := load.tx.Query(`SELECT paths.id, paths.dir || paths.name FROM filelist fl
+		JOIN paths ON paths.id = fl.path_id
+		JOIN volumes ON volumes.id = paths.volume_id
+		LEFT JOIN fileids ON fileids.path_id = fl.path_id
+		WHERE volumes.host_id = ? AND fileids.path_id IS NULL`, load.hostID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var f file
+		if err := rows.Scan(&f.id, &f.path); err != nil {
+			rows.Close()
+			return err
+		}
+		notBackedUp = append(notBackedUp, f)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	stmt, err := load.tx.Prepare("INSERT OR IGNORE INTO exclusions (path_id, rule_id) VALUES (?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, f := range notBackedUp {
+		explained := false
+		for i, rule := range rules {
+			if !rule.Match(f.path) {
+				continue
+			}
+			explained = true
+			if _, err := stmt.Exec(f.id, ruleIDs[i]); err != nil {
+				return err
+			}
+		}
+		load.Stats.NotBackedUp++
+		if !explained {
+			load.Stats.Unaccounted++
+		}
+	}
+	return nil
+}
@@ -0,0 +1,334 @@
+package backblaze
+
+import (
+	"bufio"
+	"container/heap"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// DefaultMemoryBudget is the number of bytes of lines a Sorter holds before spilling
+const DefaultMemoryBudget = 64 << 20
+
+// lineOverhead approximates the per line cost of a string header in the buffer
+const lineOverhead = 16
+
+// Sorter is an external merge sort for lines of text.
+//
+// Lines are buffered in memory until MemoryBudget is exceeded, at which point the
+// buffer is sorted and spilled to a temporary file (a run). Sort merges all
+// runs back into a single ascending stream, so only one line per run is held
+// in memory while merging.
+//
+// Lines are ordered by their full text, but compared for uniqueness by KeyOf,
+// so a record like "path\tsize" sorts and dedups on its path.
+// (This holds as long as keys contain no control characters below tab.)
+type Sorter struct {
+	MemoryBudget int    // bytes of lines kept in memory before spilling a run
+	TempDir      string // where runs are written, "" means os.TempDir()
+
+	buf      []string
+	bufBytes int
+	runs     []string
+	added    int
+}
+
+// NewSorter returns a Sorter which spills to tempDir beyond memoryBudget bytes
+func NewSorter(memoryBudget int, tempDir string) *Sorter {
+	if memoryBudget <= 0 {
+		memoryBudget = DefaultMemoryBudget
+	}
+	return &Sorter{MemoryBudget: memoryBudget, TempDir: tempDir}
+}
+
+// KeyOf returns the part of a line used for comparison: everything before the first tab
+func KeyOf(line string) string {
+	if i := strings.IndexByte(line, '\t'); i >= 0 {
+		return line[:i]
+	}
+	return line
+}
+
+// Add buffers a line, spilling a sorted run to disk if the budget is exceeded
+func (s *Sorter) Add(line string) error {
+	s.buf = append(s.buf, line)
+	s.bufBytes += len(line) + lineOverhead
+	s.added++
+	if s.bufBytes >= s.MemoryBudget {
+		return s.spill()
+	}
+	return nil
+}
+
+// Added returns the number of lines added so far
+func (s *Sorter) Added() int {
+	return s.added
+}
+
+// Runs returns the number of runs spilled to disk so far
+func (s *Sorter) Runs() int {
+	return len(s.runs)
+}
+
+func (s *Sorter) spill() error {
+	if len(s.buf) == 0 {
+		return nil
+	}
+	sort.Strings(s.buf)
+
+	outfile, err := os.CreateTemp(s.TempDir, "bzsort-*.run")
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, outfile.Name())
+
+	bw := bufio.NewWriter(outfile)
+	for _, line := range s.buf {
+		bw.WriteString(line)
+		bw.WriteByte('\n')
+	}
+	if err := bw.Flush(); err != nil {
+		outfile.Close()
+		return err
+	}
+	if err := outfile.Close(); err != nil {
+		return err
+	}
+
+	s.buf = s.buf[:0]
+	s.bufBytes = 0
+	return nil
+}
+
+// Sort returns all added lines in ascending order, keeping only the first line for each key.
+// If nothing was spilled, the lines are merged straight from memory.
+// The returned SortedLines must be closed, which removes the runs.
+func (s *Sorter) Sort() (*SortedLines, error) {
+	sl := &SortedLines{}
+	if len(s.runs) > 0 {
+		// spill the remainder, so that every source is a file
+		if err := s.spill(); err != nil {
+			return nil, err
+		}
+		sl.runs = s.runs
+		for _, name := range sl.runs {
+			f, err := os.Open(name)
+			if err != nil {
+				sl.Close()
+				return nil, err
+			}
+			sl.files = append(sl.files, f)
+			src := &runSource{r: bufio.NewReaderSize(f, 64<<10)}
+			if src.advance() {
+				sl.heap = append(sl.heap, src)
+			} else if src.err != nil {
+				sl.Close()
+				return nil, src.err
+			}
+		}
+	} else {
+		sort.Strings(s.buf)
+		src := &runSource{lines: s.buf, inMemory: true}
+		if src.advance() {
+			sl.heap = append(sl.heap, src)
+		}
+	}
+	heap.Init(&sl.heap)
+
+	s.buf = nil
+	s.bufBytes = 0
+	s.runs = nil
+	return sl, nil
+}
+
+// SortedLines is the merged output of a Sorter, iterated like a bufio.Scanner
+type SortedLines struct {
+	heap  runHeap
+	files []*os.File
+	runs  []string
+
+	line       string
+	prevKey    string
+	started    bool
+	err        error
+	count      int
+	duplicates int
+}
+
+// Scan advances to the next unique line, returning false at the end or on error
+func (sl *SortedLines) Scan() bool {
+	for sl.err == nil && len(sl.heap) > 0 {
+		src := sl.heap[0]
+		line := src.line
+		if src.advance() {
+			heap.Fix(&sl.heap, 0)
+		} else {
+			if src.err != nil {
+				sl.err = src.err
+				return false
+			}
+			heap.Pop(&sl.heap)
+		}
+
+		key := KeyOf(line)
+		if sl.started && key == sl.prevKey {
+			sl.duplicates++
+			continue
+		}
+		sl.started = true
+		sl.prevKey = key
+		sl.line = line
+		sl.count++
+		return true
+	}
+	return false
+}
+
+// Text returns the current line
+func (sl *SortedLines) Text() string {
+	return sl.line
+}
+
+// Err returns the first error encountered while reading runs
+func (sl *SortedLines) Err() error {
+	return sl.err
+}
+
+// Count returns the number of unique lines returned so far
+func (sl *SortedLines) Count() int {
+	return sl.count
+}
+
+// Duplicates returns the number of lines dropped because their key was already seen
+func (sl *SortedLines) Duplicates() int {
+	return sl.duplicates
+}
+
+// Close releases and removes the runs
+func (sl *SortedLines) Close() error {
+	var first error
+	for _, f := range sl.files {
+		if err := f.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	for _, name := range sl.runs {
+		if err := os.Remove(name); err != nil && first == nil {
+			first = err
+		}
+	}
+	sl.files = nil
+	sl.runs = nil
+	sl.heap = nil
+	return first
+}
+
+// runSource is one sorted input of the merge: a run file, or the in-memory buffer
+type runSource struct {
+	r        *bufio.Reader
+	lines    []string
+	inMemory bool
+	line     string
+	err      error
+}
+
+func (src *runSource) advance() bool {
+	if src.inMemory {
+		if len(src.lines) == 0 {
+			return false
+		}
+		src.line = src.lines[0]
+		src.lines = src.lines[1:]
+		return true
+	}
+	line, err := src.r.ReadString('\n')
+	if err == io.EOF && len(line) == 0 {
+		return false
+	}
+	if err != nil && err != io.EOF {
+		src.err = err
+		return false
+	}
+	src.line = strings.TrimSuffix(line, "\n")
+	return true
+}
+
+type runHeap []*runSource
+
+func (h runHeap) Len() int            { return len(h) }
+func (h runHeap) Less(i, j int) bool  { return h[i].line < h[j].line }
+func (h runHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x interface{}) { *h = append(*h, x.(*runSource)) }
+func (h *runHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	src := old[n-1]
+	*h = old[:n-1]
+	return src
+}
+
+// LineScanner is the iteration interface shared by bufio.Scanner and SortedLines
+type LineScanner interface {
+	Scan() bool
+	Text() string
+	Err() error
+}
+
+// DiffSide tells the MergeDiff callback where a key was found
+type DiffSide int
+
+const (
+	// OnlyInA means the key is only in the first stream
+	OnlyInA DiffSide = iota
+	// OnlyInB means the key is only in the second stream
+	OnlyInB
+	// InBoth means the key is in both streams
+	InBoth
+)
+
+func (side DiffSide) String() string {
+	switch side {
+	case OnlyInA:
+		return "OnlyInA"
+	case OnlyInB:
+		return "OnlyInB"
+	case InBoth:
+		return "InBoth"
+	}
+	return fmt.Sprintf("DiffSide(%d)", int(side))
+}
+
+// MergeDiff walks two streams, each sorted by KeyOf, in lockstep.
+// fn is called once per key, with the full line from each side it was found on
+// (the missing side is passed as "").
+// Only one line per stream is held in memory.
+func MergeDiff(as, bs LineScanner, fn func(side DiffSide, a, b string)) error {
+	hasA, hasB := as.Scan(), bs.Scan()
+	for hasA && hasB {
+		a, b := as.Text(), bs.Text()
+		cmp := strings.Compare(KeyOf(a), KeyOf(b))
+		if cmp == 0 {
+			fn(InBoth, a, b)
+			hasA, hasB = as.Scan(), bs.Scan()
+		} else if cmp < 0 { // a < b
+			fn(OnlyInA, a, "")
+			hasA = as.Scan()
+		} else { // a > b
+			fn(OnlyInB, "", b)
+			hasB = bs.Scan()
+		}
+	}
+	for ; hasA; hasA = as.Scan() {
+		fn(OnlyInA, as.Text(), "")
+	}
+	for ; hasB; hasB = bs.Scan() {
+		fn(OnlyInB, "", bs.Text())
+	}
+	if err := as.Err(); err != nil {
+		return err
+	}
+	return bs.Err()
+}
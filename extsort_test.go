@@ -0,0 +1,182 @@
+package backblaze
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func sortLines(t *testing.T, budget int, in []string) ([]string, *SortedLines) {
+	dir := t.TempDir()
+	sorter := NewSorter(budget, dir)
+	for _, line := range in {
+		if err := sorter.Add(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sl, err := sorter.Sort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, 0)
+	for sl.Scan() {
+		got = append(got, sl.Text())
+	}
+	if err := sl.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sl.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if runs, _ := filepath.Glob(filepath.Join(dir, "bzsort-*")); len(runs) != 0 {
+		t.Errorf("runs not removed: %v", runs)
+	}
+	return got, sl
+}
+
+func TestSorter(t *testing.T) {
+	var data = []struct {
+		name   string
+		budget int
+		in     []string
+		out    []string
+		dups   int
+	}{
+		{
+			name:   "Empty",
+			budget: 1024,
+			in:     []string{},
+			out:    []string{},
+		},
+		{
+			name:   "InMemory",
+			budget: 1024,
+			in:     []string{"/b", "/a", "/c", "/a"},
+			out:    []string{"/a", "/b", "/c"},
+			dups:   1,
+		},
+		{
+			name:   "Spilled",
+			budget: 1, // every line is a run
+			in:     []string{"/b", "/a", "/c", "/a", "/b/c", "/b.x"},
+			out:    []string{"/a", "/b", "/b.x", "/b/c", "/c"},
+			dups:   1,
+		},
+		{
+			name:   "UniqByKey",
+			budget: 40,
+			in:     []string{"/b\t2", "/a\t1", "/a b\t5", "/a\t3", "/b/c\t4"},
+			out:    []string{"/a\t1", "/a b\t5", "/b\t2", "/b/c\t4"},
+			dups:   1,
+		},
+	}
+	for _, tt := range data {
+		got, sl := sortLines(t, tt.budget, tt.in)
+		if !reflect.DeepEqual(tt.out, got) {
+			t.Errorf("Test:%s\nexpected:\n%q\ngot:\n%q", tt.name, tt.out, got)
+		}
+		if sl.Duplicates() != tt.dups || sl.Count() != len(tt.out) {
+			t.Errorf("Test:%s count:%d dups:%d expected %d,%d", tt.name, sl.Count(), sl.Duplicates(), len(tt.out), tt.dups)
+		}
+	}
+}
+
+func TestSorterMatchesInMemory(t *testing.T) {
+	rnd := rand.New(rand.NewSource(42))
+	in := make([]string, 5000)
+	for i := range in {
+		in[i] = fmt.Sprintf("/Users/daniel/%03d/file-%d", rnd.Intn(100), rnd.Intn(2000))
+	}
+	expected := append([]string{}, in...)
+	expected = sortAndUniq(expected)
+
+	got, _ := sortLines(t, 4096, in)
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("external sort differs from in memory sort: %d vs %d lines", len(expected), len(got))
+	}
+}
+
+func sortAndUniq(lines []string) []string {
+	sort.Strings(lines)
+	uniqed := make([]string, 0)
+	for i, line := range lines {
+		if i > 0 && lines[i-1] == line {
+			continue
+		}
+		uniqed = append(uniqed, line)
+	}
+	return uniqed
+}
+
+func TestMergeDiff(t *testing.T) {
+	var data = []struct {
+		name string
+		as   string
+		bs   string
+		out  []string
+	}{
+		{
+			name: "Empty",
+			out:  []string{},
+		},
+		{
+			name: "OnlyA",
+			as:   "/a\n/b",
+			out:  []string{"OnlyInA:/a:", "OnlyInA:/b:"},
+		},
+		{
+			name: "OnlyB",
+			bs:   "/a\n/b",
+			out:  []string{"OnlyInB::/a", "OnlyInB::/b"},
+		},
+		{
+			name: "Mixed",
+			as:   "/a\n/c\n/d",
+			bs:   "/b\t2\n/c\t3\n/e\t5",
+			out:  []string{"OnlyInA:/a:", "OnlyInB::/b\t2", "InBoth:/c:/c\t3", "OnlyInA:/d:", "OnlyInB::/e\t5"},
+		},
+	}
+	for _, tt := range data {
+		got := make([]string, 0)
+		as := bufio.NewScanner(strings.NewReader(tt.as))
+		bs := bufio.NewScanner(strings.NewReader(tt.bs))
+		err := MergeDiff(as, bs, func(side DiffSide, a, b string) {
+			got = append(got, fmt.Sprintf("%s:%s:%s", side, a, b))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(tt.out, got) {
+			t.Errorf("Test:%s\nexpected:\n%q\ngot:\n%q", tt.name, tt.out, got)
+		}
+	}
+}
+
+func BenchmarkSorter(b *testing.B) {
+	lines := make([]string, 100000)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("/Users/daniel/Library/Containers/%d/file-%d", i%97, i)
+	}
+	dir, err := os.MkdirTemp("", "bzsort")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sorter := NewSorter(1<<20, dir)
+		for _, line := range lines {
+			sorter.Add(line)
+		}
+		sl, _ := sorter.Sort()
+		for sl.Scan() {
+		}
+		sl.Close()
+	}
+}
@@ -0,0 +1,118 @@
+package backblaze
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+/*
+Examples of what we are parsing:
+
+bzfilelists/v*filelist.dat: (tab separated) type, modification time (ms), size (bytes), path
+# Dir: /Users/daniel/
+f	1539000000000	6148	/Users/daniel/.DS_Store
+s	1539000000000	0	/Users/daniel/link
+
+bzbackup/bzfileids.dat: (tab separated) fileid, path
+0123456789abcdef	/Users/daniel/.bash_profile
+*/
+
+// FileListEntry represents a line in the filelists
+type FileListEntry struct {
+	Type    string `json:"type"`
+	ModTime int64  `json:"mtime"`
+	Size    int64  `json:"size"`
+	Path    string `json:"path"`
+}
+
+// ParseFileList calls fn for every file ('f') in a filelist, and returns the number of lines skipped:
+// comments, symbolic links ('s') and malformed lines.
+func ParseFileList(r io.Reader, fn func(FileListEntry)) (skipped int, err error) {
+	rc, err := Decompress(r)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+	scanner := bufio.NewScanner(rc)
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Split(line, "\t")
+		if !filterFilelist(fields) {
+			skipped++
+			continue
+		}
+		entry := FileListEntry{Type: fields[0], Path: fields[3]}
+		// ignore errors, default struct values are OK
+		entry.ModTime, _ = strconv.ParseInt(strings.TrimSpace(fields[1]), 10, 64)
+		entry.Size, _ = strconv.ParseInt(strings.TrimSpace(fields[2]), 10, 64)
+		fn(entry)
+	}
+	return skipped, scanner.Err()
+}
+
+// ParseFileIds calls fn for the path of every fileid, and returns the number of malformed lines skipped
+func ParseFileIds(r io.Reader, fn func(id, path string)) (skipped int, err error) {
+	rc, err := Decompress(r)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+	scanner := bufio.NewScanner(rc)
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Split(line, "\t")
+		if !filterFileIds(fields) {
+			skipped++
+			continue
+		}
+		fn(fields[0], fields[1])
+	}
+	return skipped, scanner.Err()
+}
+
+func filterFileIds(fields []string) bool {
+	const expectedFields = 2
+	if len(fields) != expectedFields {
+		fmt.Fprintf(os.Stderr, "Err: %d!=%d %v\n", len(fields), expectedFields, fields)
+		return false
+	}
+	return true
+}
+
+func filterFilelist(fields []string) bool {
+	if strings.HasPrefix(fields[0], "#") {
+		return false
+	}
+	const expectedFields = 4
+	if len(fields) != expectedFields {
+		fmt.Fprintf(os.Stderr, "Err: %d!=%d %v\n", len(fields), expectedFields, fields)
+		return false
+	}
+	// only take 'f':files, not 's':symbolic links
+	if !strings.HasPrefix(fields[0], "f") {
+		// check for other than f,s
+		if "s" != fields[0] {
+			fmt.Fprintf(os.Stderr, "Unexpected: filetype (%s) not in [f,s]\n", fields[0])
+		}
+		return false
+	}
+	return true
+}
+
+// SortLine is how an entry is fed to a Sorter: path, then size, so it is keyed by path
+func (entry FileListEntry) SortLine() string {
+	return entry.Path + "\t" + strconv.FormatInt(entry.Size, 10)
+}
+
+// ParseSortLine is the inverse of SortLine, a line without a size has size 0
+func ParseSortLine(line string) (path string, size int64) {
+	path = KeyOf(line)
+	if len(path) < len(line) {
+		size, _ = strconv.ParseInt(line[len(path)+1:], 10, 64)
+	}
+	return path, size
+}
@@ -0,0 +1,80 @@
+package backblaze
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseFileList(t *testing.T) {
+	infile, err := os.Open("./test/data/bzdata/bzfilelists/v0009a98724006e621c1646e011f_root_filelist.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer infile.Close()
+
+	got := make([]FileListEntry, 0)
+	skipped, err := ParseFileList(infile, func(entry FileListEntry) {
+		got = append(got, entry)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []FileListEntry{
+		FileListEntry{Type: "f", ModTime: 1539000000000, Size: 6148, Path: "/Users/daniel/.DS_Store"},
+		FileListEntry{Type: "f", ModTime: 1539000000000, Size: 1200, Path: "/Users/daniel/.bash_profile"},
+		FileListEntry{Type: "f", ModTime: 1539000000000, Size: 4294967296, Path: "/Users/daniel/Downloads/ubuntu.iso"},
+		FileListEntry{Type: "f", ModTime: 1539000000000, Size: 52000, Path: "/Users/daniel/Downloads/notes.txt"},
+		FileListEntry{Type: "f", ModTime: 1539000000000, Size: 300, Path: "/Users/daniel/Library/Caches/a.db"},
+		FileListEntry{Type: "f", ModTime: 1539000000000, Size: 700, Path: "/Users/daniel/Library/Caches/b.db"},
+		FileListEntry{Type: "f", ModTime: 1539000000000, Size: 42949672960, Path: "/Users/daniel/VMs/win10.vmdk"},
+	}
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected:\n%#v\ngot:\n%#v", expected, got)
+	}
+	// 4 comments, 1 symlink, 1 bogus line
+	if skipped != 6 {
+		t.Errorf("expected 6 skipped, got %d", skipped)
+	}
+}
+
+func TestParseFileIds(t *testing.T) {
+	infile, err := os.Open("./test/data/bzdata/bzbackup/bzfileids.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer infile.Close()
+
+	got := make([]string, 0)
+	skipped, err := ParseFileIds(infile, func(id, path string) {
+		got = append(got, id+":"+path)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skipped != 0 || len(got) != 6 || got[0] != "00a1:/Users/daniel/.bash_profile" {
+		t.Errorf("unexpected fileids (skipped %d):\n%q", skipped, got)
+	}
+}
+
+func TestSortLine(t *testing.T) {
+	var data = []struct {
+		line string
+		path string
+		size int64
+	}{
+		{line: "/Users/daniel/a.txt\t1234", path: "/Users/daniel/a.txt", size: 1234},
+		{line: "/Users/daniel/a.txt", path: "/Users/daniel/a.txt", size: 0},
+		{line: "/Users/daniel/a.txt\tnan", path: "/Users/daniel/a.txt", size: 0},
+	}
+	for _, tt := range data {
+		path, size := ParseSortLine(tt.line)
+		if path != tt.path || size != tt.size {
+			t.Errorf("Test:%q expected: %s,%d got: %s,%d", tt.line, tt.path, tt.size, path, size)
+		}
+	}
+	entry := FileListEntry{Path: "/a b/c", Size: 42}
+	if path, size := ParseSortLine(entry.SortLine()); path != entry.Path || size != entry.Size {
+		t.Errorf("round trip: expected %#v, got %s,%d", entry, path, size)
+	}
+}
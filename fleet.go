@@ -0,0 +1,203 @@
+package backblaze
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// DefaultFleetDays is the period of the fleet report
+const DefaultFleetDays = 7
+
+// FleetReport compares hosts, one row per host, over the period starting on Since (a date)
+type FleetReport struct {
+	Since string      `json:"since"`
+	Hosts []FleetHost `json:"hosts"`
+
+	grouper Grouper
+	topN    int
+}
+
+// FleetHost is a host's row: what was uploaded since the start of the period,
+// its backlog (Pending, Excluded: files in the filelists, but not in the fileids),
+// and the directories which grew the most, by bytes uploaded.
+// DedupRatio is the share of the records (sent or dedup'd) which were dedup'd.
+// Error is why the row is missing or incomplete, see Fail.
+type FleetHost struct {
+	Host         string       `json:"host"`
+	Uploaded     FileTotal    `json:"uploaded"`
+	Dedup        int          `json:"dedup"`
+	DedupRatio   float64      `json:"dedupRatio"`
+	LastActivity string       `json:"lastActivity"` // stamp of the last record, empty if none
+	Pending      FileTotal    `json:"pending"`
+	Excluded     FileTotal    `json:"excluded"`
+	Growing      []GroupTotal `json:"growing"`
+	Error        string       `json:"error,omitempty"`
+}
+
+// NewFleetReport returns an empty report, the growing directories are the topN groups of g
+func NewFleetReport(since string, g Grouper, topN int) *FleetReport {
+	return &FleetReport{Since: since, Hosts: make([]FleetHost, 0), grouper: g, topN: topN}
+}
+
+// AddHost adds a host's row, from its records (sent and dedup'd, see ParseTransmitedAll) and its backlog,
+// the records with an unparsable stamp are skipped
+func (report *FleetReport) AddHost(host string, records []Transmitted, pending, excluded FileTotal) FleetHost {
+	fh := FleetHost{Host: host, Pending: pending, Excluded: excluded}
+	sent := make([]Transmitted, 0, len(records))
+	all := 0
+	for _, tx := range records {
+		if _, err := ParseStamp(tx.Stamp, time.UTC); err != nil {
+			continue
+		}
+		if tx.Stamp > fh.LastActivity {
+			fh.LastActivity = tx.Stamp
+		}
+		if tx.Stamp < report.Since {
+			continue
+		}
+		all++
+		if tx.Dedup() {
+			fh.Dedup++
+			continue
+		}
+		fh.Uploaded.add(int64(tx.Size))
+		sent = append(sent, tx)
+	}
+	if all > 0 {
+		fh.DedupRatio = float64(fh.Dedup) / float64(all)
+	}
+	fh.Growing = SummarizeBy(sent, report.grouper)
+	if len(fh.Growing) > report.topN {
+		fh.Growing = fh.Growing[:report.topN]
+	}
+	report.Hosts = append(report.Hosts, fh)
+	sort.SliceStable(report.Hosts, func(i, j int) bool { return report.Hosts[i].Host < report.Hosts[j].Host })
+	return fh
+}
+
+// Fail records why host's row could not be made, or is incomplete (e.g. its backlog),
+// adding an empty row for host if it has none
+func (report *FleetReport) Fail(host string, err error) {
+	for i := range report.Hosts {
+		if report.Hosts[i].Host == host {
+			if len(report.Hosts[i].Error) != 0 {
+				report.Hosts[i].Error += "; "
+			}
+			report.Hosts[i].Error += err.Error()
+			return
+		}
+	}
+	report.Hosts = append(report.Hosts, FleetHost{Host: host, Growing: make([]GroupTotal, 0), Error: err.Error()})
+	sort.SliceStable(report.Hosts, func(i, j int) bool { return report.Hosts[i].Host < report.Hosts[j].Host })
+}
+
+// Failed are the rows with an Error
+func (report *FleetReport) Failed() []FleetHost {
+	failed := make([]FleetHost, 0)
+	for _, fh := range report.Hosts {
+		if len(fh.Error) != 0 {
+			failed = append(failed, fh)
+		}
+	}
+	return failed
+}
+
+// WriteFormat writes the report as text, json or html
+func (report *FleetReport) WriteFormat(w io.Writer, format string) error {
+	switch format {
+	case FormatText:
+		return report.WriteText(w)
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	case FormatHTML:
+		return report.WriteHTML(w)
+	}
+	return fmt.Errorf("unknown format: %q", format)
+}
+
+// WriteText writes a table, with a row per host, then the growing directories of each host
+func (report *FleetReport) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "Fleet: since %s\n", report.Since)
+	tw := tabwriter.NewWriter(bw, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "host\tuploaded\tfiles\tdedup\tpending\tfiles\texcluded\tfiles\tlast activity\t\n")
+	for _, fh := range report.Hosts {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%.1f%%\t%s\t%d\t%s\t%d\t%s\t\n", fh.Host,
+			HumanBytes(fh.Uploaded.Bytes), fh.Uploaded.Files, 100*fh.DedupRatio,
+			HumanBytes(fh.Pending.Bytes), fh.Pending.Files,
+			HumanBytes(fh.Excluded.Bytes), fh.Excluded.Files, fh.LastActivity)
+	}
+	tw.Flush()
+	for _, fh := range report.Failed() {
+		fmt.Fprintf(bw, "Failed: %s: %s\n", fh.Host, fh.Error)
+	}
+	for _, fh := range report.Hosts {
+		if len(fh.Growing) == 0 {
+			continue
+		}
+		fmt.Fprintf(bw, "Growing: %s\n", fh.Host)
+		for _, g := range fh.Growing {
+			fmt.Fprintf(bw, " %10s %6d : %s\n", HumanBytes(int64(g.Size)), g.Count, g.Group)
+		}
+	}
+	return bw.Flush()
+}
+
+var fleetTemplate = template.Must(template.New("fleet").Funcs(template.FuncMap{
+	"bytes":   HumanBytes,
+	"percent": func(ratio float64) string { return fmt.Sprintf("%.1f%%", 100*ratio) },
+	"size":    func(size int) string { return HumanBytes(int64(size)) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Backblaze fleet since {{.Since}}</title>
+<style>
+body { font: 12px sans-serif; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { padding: 4px 8px; border-bottom: 1px solid #ddd; text-align: right; }
+th:first-child, td:first-child, td.path { text-align: left; }
+</style>
+</head>
+<body>
+<h1>Backblaze fleet since {{.Since}}</h1>
+<table>
+<tr><th>host</th><th>uploaded</th><th>files</th><th>dedup</th><th>pending</th><th>files</th><th>excluded</th><th>files</th><th>last activity</th></tr>
+{{- range .Hosts}}
+<tr><td>{{.Host}}</td><td>{{bytes .Uploaded.Bytes}}</td><td>{{.Uploaded.Files}}</td><td>{{percent .DedupRatio}}</td><td>{{bytes .Pending.Bytes}}</td><td>{{.Pending.Files}}</td><td>{{bytes .Excluded.Bytes}}</td><td>{{.Excluded.Files}}</td><td>{{.LastActivity}}</td></tr>
+{{- end}}
+</table>
+{{- with .Failed}}
+<h2>Failed</h2>
+<table>
+<tr><th>host</th><th>error</th></tr>
+{{- range .}}
+<tr><td>{{.Host}}</td><td class="path">{{.Error}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- range .Hosts}}{{if .Growing}}
+<h2>Growing on {{.Host}}</h2>
+<table>
+<tr><th>directory</th><th>uploaded</th><th>files</th></tr>
+{{- range .Growing}}
+<tr><td class="path">{{.Group}}</td><td>{{size .Size}}</td><td>{{.Count}}</td></tr>
+{{- end}}
+</table>
+{{- end}}{{end}}
+</body>
+</html>
+`))
+
+// WriteHTML writes a static html page
+func (report *FleetReport) WriteHTML(w io.Writer) error {
+	return fleetTemplate.Execute(w, report)
+}
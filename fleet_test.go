@@ -0,0 +1,108 @@
+package backblaze
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func fleetSample() *FleetReport {
+	report := NewFleetReport("2018-10-02", DepthGrouper{Depth: 2, Anchor: VolumeAnchor}, 1)
+	report.AddHost("galois", []Transmitted{
+		{Type: normal, Stamp: "2018-10-01 10:00:00", Size: 5000, FName: "/Volumes/Space/old/a"}, // before the period
+		{Type: normal, Stamp: "2018-10-02 10:00:00", Size: 1000, FName: "/Volumes/Space/photo/2018/a.jpg"},
+		{Type: normal, Stamp: "2018-10-02 11:00:00", Size: 3000, FName: "/Users/daniel/Documents/b.txt"},
+		{Type: dedup, Stamp: "2018-10-03 12:00:00", FName: "/Volumes/Space/photo/2018/c.jpg"},
+	}, FileTotal{Files: 10, Bytes: 10000}, FileTotal{Files: 2, Bytes: 20})
+	report.AddHost("davinci", nil, FileTotal{}, FileTotal{})
+	return report
+}
+
+func TestFleetReport(t *testing.T) {
+	report := fleetSample()
+	if len(report.Hosts) != 2 || report.Hosts[0].Host != "davinci" {
+		t.Fatalf("expected hosts sorted by name: %+v", report.Hosts)
+	}
+	galois := report.Hosts[1]
+	if galois.Uploaded != (FileTotal{Files: 2, Bytes: 4000}) || galois.Dedup != 1 {
+		t.Errorf("unexpected uploaded: %+v", galois)
+	}
+	if galois.DedupRatio < 0.33 || galois.DedupRatio > 0.34 {
+		t.Errorf("expected a dedup ratio of 1/3, got %v", galois.DedupRatio)
+	}
+	if galois.LastActivity != "2018-10-03 12:00:00" {
+		t.Errorf("unexpected last activity: %q", galois.LastActivity)
+	}
+	if len(galois.Growing) != 1 || galois.Growing[0].Group != "/Users/daniel/" || galois.Growing[0].Size != 3000 {
+		t.Errorf("unexpected growing: %+v", galois.Growing)
+	}
+	if report.Hosts[0].LastActivity != "" || report.Hosts[0].DedupRatio != 0 {
+		t.Errorf("unexpected idle host: %+v", report.Hosts[0])
+	}
+}
+
+func TestFleetReportFail(t *testing.T) {
+	report := fleetSample()
+	report.Fail("euler", errors.New("no bzdata"))
+	report.Fail("galois", errors.New("no backlog"))
+	failed := report.Failed()
+	if len(report.Hosts) != 3 || len(failed) != 2 || failed[0].Host != "euler" || failed[1].Error != "no backlog" {
+		t.Fatalf("unexpected failed hosts: %+v", failed)
+	}
+	if report.Hosts[2].Uploaded.Files != 2 {
+		t.Errorf("expected the row of galois to be kept: %+v", report.Hosts[2])
+	}
+	var buf bytes.Buffer
+	if err := report.WriteFormat(&buf, FormatText); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "Failed: euler: no bzdata\nFailed: galois: no backlog\n") {
+		t.Errorf("unexpected text:\n%s", buf.String())
+	}
+	buf.Reset()
+	if err := report.WriteFormat(&buf, FormatHTML); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `<tr><td>euler</td><td class="path">no bzdata</td></tr>`) {
+		t.Errorf("unexpected html:\n%s", buf.String())
+	}
+}
+
+func TestFleetWriteFormat(t *testing.T) {
+	var buf bytes.Buffer
+	if err := fleetSample().WriteFormat(&buf, FormatHTML); err != nil {
+		t.Fatal(err)
+	}
+	html := buf.String()
+	if !strings.Contains(html, "<td>galois</td><td>3.91 KiB</td><td>2</td><td>33.3%</td>") || !strings.Contains(html, "<h2>Growing on galois</h2>") {
+		t.Errorf("unexpected html:\n%s", html)
+	}
+	if strings.Contains(html, "Growing on davinci") {
+		t.Errorf("expected no growing table for an idle host")
+	}
+}
+
+func TestFleetEdgeCases(t *testing.T) {
+	var data = []struct {
+		name     string
+		in       []Transmitted
+		uploaded FileTotal
+		last     string
+	}{
+		{"empty", nil, FileTotal{}, ""},
+		{"one record", []Transmitted{{Type: normal, Stamp: "2018-10-02 10:00:00", Size: 1000, FName: "/a/b"}}, FileTotal{Files: 1, Bytes: 1000}, "2018-10-02 10:00:00"},
+		{"unparsable stamps", []Transmitted{{Type: normal, Stamp: "garbage", Size: 1000, FName: "/a/b"}, {Type: normal, Stamp: "2018-10-02", Size: 1000, FName: "/a/c"}}, FileTotal{}, ""},
+	}
+	for _, tt := range data {
+		report := NewFleetReport("2018-10-02", DepthGrouper{Depth: 1}, 1)
+		fh := report.AddHost("galois", tt.in, FileTotal{}, FileTotal{})
+		if fh.Uploaded != tt.uploaded || fh.LastActivity != tt.last || fh.DedupRatio != 0 {
+			t.Errorf("%s: unexpected row: %+v", tt.name, fh)
+		}
+		if err := report.WriteFormat(ioutil.Discard, FormatText); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,358 @@
+package backblaze
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OtherGroup is the key of paths a Grouper does not recognize
+const OtherGroup = "Other"
+
+// Grouper maps a path to the key it is aggregated under
+type Grouper interface {
+	Group(path string) string
+}
+
+// DepthGrouper groups by the first Depth directories of the path
+// (from the anchor of the path, if Anchor is set),
+// e.g. Depth=2: /Users/daniel/Library/Caches/x -> /Users/daniel/
+// Files shallower than Depth are grouped by their own directory.
+type DepthGrouper struct {
+	Depth  int
+	Anchor func(path string) string
+}
+
+// Group implements Grouper
+func (g DepthGrouper) Group(path string) string {
+	anchor := "/"
+	if g.Anchor != nil {
+		anchor = g.Anchor(path)
+	}
+	end := len(anchor)
+	if end > len(path) {
+		// e.g. an empty path
+		end = len(path)
+	}
+	for d := 0; d < g.Depth; d++ {
+		i := strings.IndexByte(path[end:], '/')
+		if i < 0 {
+			break
+		}
+		end += i + 1
+	}
+	return path[:end]
+}
+
+// VolumeAnchor is the mount point of the volume holding path: /Volumes/<name>/ or /
+func VolumeAnchor(path string) string {
+	const volumes = "/Volumes/"
+	if strings.HasPrefix(path, volumes) {
+		if i := strings.IndexByte(path[len(volumes):], '/'); i >= 0 {
+			return path[:len(volumes)+i+1]
+		}
+	}
+	return "/"
+}
+
+// HomeAnchor is the home directory holding path: /Users/<name>/,
+// or the volume mount point when path is not in a home directory
+func HomeAnchor(path string) string {
+	const users = "/Users/"
+	if strings.HasPrefix(path, users) {
+		if i := strings.IndexByte(path[len(users):], '/'); i >= 0 {
+			return path[:len(users)+i+1]
+		}
+	}
+	return VolumeAnchor(path)
+}
+
+// ExtensionGrouper groups by lower cased file extension (".jpg"), or "(none)"
+type ExtensionGrouper struct{}
+
+// Group implements Grouper
+func (g ExtensionGrouper) Group(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	if len(ext) == 0 || strings.ContainsRune(ext, '/') {
+		return "(none)"
+	}
+	return ext
+}
+
+// RegexGrouper groups by the capture groups of a regular expression, joined with '/'
+// (or the whole match, if it has none), and non matching paths as OtherGroup
+type RegexGrouper struct {
+	RE *regexp.Regexp
+}
+
+// Group implements Grouper
+func (g RegexGrouper) Group(path string) string {
+	m := g.RE.FindStringSubmatch(path)
+	if m == nil {
+		return OtherGroup
+	}
+	if len(m) == 1 {
+		return m[0]
+	}
+	return strings.Join(m[1:], "/")
+}
+
+// Bucket is a named group, holding the paths matched by any of its rules
+type Bucket struct {
+	Name  string
+	Rules ExclusionRules
+}
+
+// BucketGrouper groups paths in the first matching Bucket, or OtherGroup
+type BucketGrouper []Bucket
+
+// Group implements Grouper
+func (g BucketGrouper) Group(path string) string {
+	for _, bucket := range g {
+		for _, rule := range bucket.Rules {
+			if rule.Match(path) {
+				return bucket.Name
+			}
+		}
+	}
+	return OtherGroup
+}
+
+// ParseBuckets reads named buckets, one rule per line, in order of precedence:
+//
+//	# name kind pattern (kind as in exclusion rules: suffix, regex or dir)
+//	Docker dir /Users/daniel/Library/Containers/com.docker.docker/
+//	Photos suffix .jpg
+//	Photos dir /Volumes/Space/archive/media/photo/
+//	Mail regex (?i)^/users/[^/]+/library/mail/
+func ParseBuckets(r io.Reader) (BucketGrouper, error) {
+	buckets := make(BucketGrouper, 0)
+	index := make(map[string]int)
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("line %d: expected 'name kind pattern': %q", lineNo, line)
+		}
+		rule, err := NewExclusionRule(fields[1], strings.TrimSpace(fields[2]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		i, ok := index[fields[0]]
+		if !ok {
+			i = len(buckets)
+			index[fields[0]] = i
+			buckets = append(buckets, Bucket{Name: fields[0]})
+		}
+		buckets[i].Rules = append(buckets[i].Rules, rule)
+	}
+	return buckets, scanner.Err()
+}
+
+// ParseGrouper builds a Grouper from a spec:
+//
+//	depth:N      first N directories
+//	volume:N     first N directories of the volume (/ or /Volumes/<name>/)
+//	home:N       first N directories of the home directory (/Users/<name>/), or volume
+//	ext          file extension
+//	regex:RE     capture groups of RE
+//	buckets:FILE named buckets, see ParseBuckets
+func ParseGrouper(spec string) (Grouper, error) {
+	kind, arg := spec, ""
+	if i := strings.IndexByte(spec, ':'); i >= 0 {
+		kind, arg = spec[:i], spec[i+1:]
+	}
+	depth := func() (int, error) {
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("grouping %q: expected a depth, got %q", kind, arg)
+		}
+		return n, nil
+	}
+	switch kind {
+	case "depth":
+		n, err := depth()
+		return DepthGrouper{Depth: n}, err
+	case "volume":
+		n, err := depth()
+		return DepthGrouper{Depth: n, Anchor: VolumeAnchor}, err
+	case "home":
+		n, err := depth()
+		return DepthGrouper{Depth: n, Anchor: HomeAnchor}, err
+	case "ext":
+		return ExtensionGrouper{}, nil
+	case "regex":
+		re, err := regexp.Compile(arg)
+		if err != nil {
+			return nil, err
+		}
+		return RegexGrouper{RE: re}, nil
+	case "buckets":
+		infile, err := os.Open(arg)
+		if err != nil {
+			return nil, err
+		}
+		defer infile.Close()
+		return ParseBuckets(infile)
+	}
+	return nil, fmt.Errorf("unknown grouping: %q", spec)
+}
+
+// GroupTotal is the total size (and count) of transmissions in a group, on a day
+type GroupTotal struct {
+	Group string `json:"name"`
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+	Size  int    `json:"value"`
+}
+
+// SummarizeBy totals transmissions by group, largest first, for all days (Date is "")
+func SummarizeBy(xfrs []Transmitted, g Grouper) []GroupTotal {
+	totals := make(map[string]*GroupTotal)
+	for _, tx := range xfrs {
+		key := g.Group(tx.FName)
+		total, ok := totals[key]
+		if !ok {
+			total = &GroupTotal{Group: key}
+			totals[key] = total
+		}
+		total.Count++
+		total.Size += tx.Size
+	}
+	return largestFirst(totals)
+}
+
+// largestFirst lists totals by size, largest first, then by group
+func largestFirst(totals map[string]*GroupTotal) []GroupTotal {
+	list := make([]GroupTotal, 0, len(totals))
+	for _, total := range totals {
+		list = append(list, *total)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Size == list[j].Size {
+			return list[i].Group < list[j].Group
+		}
+		return list[i].Size > list[j].Size
+	})
+	return list
+}
+
+// DailySeries totals transmissions by group and day, as the streamgraph expects:
+// every group has an entry for every day from the first to the last (zero filled),
+// sorted by group, then day
+func DailySeries(xfrs []Transmitted, g Grouper) []GroupTotal {
+	return DailySeriesUntil(xfrs, g, "")
+}
+
+// DailySeriesUntil is DailySeries, zero filled up to until (YYYY-MM-DD, e.g. today) if it is after the last day,
+// so the days since the transmissions stopped are in the series
+func DailySeriesUntil(xfrs []Transmitted, g Grouper, until string) []GroupTotal {
+	type key struct{ group, date string }
+	totals := make(map[key]*GroupTotal)
+	groups := make(map[string]bool)
+	first, last := "", ""
+	for _, tx := range xfrs {
+		k := key{g.Group(tx.FName), tx.Stamp[0:10]}
+		groups[k.group] = true
+		if first == "" || k.date < first {
+			first = k.date
+		}
+		if k.date > last {
+			last = k.date
+		}
+		total, ok := totals[k]
+		if !ok {
+			total = &GroupTotal{Group: k.group, Date: k.date}
+			totals[k] = total
+		}
+		total.Count++
+		total.Size += tx.Size
+	}
+	if until > last {
+		last = until
+	}
+	dates := calendarDays(first, last)
+	series := make([]GroupTotal, 0, len(groups)*len(dates))
+	for _, group := range sortedKeys(groups) {
+		for _, date := range dates {
+			if total, ok := totals[key{group, date}]; ok {
+				series = append(series, *total)
+			} else {
+				series = append(series, GroupTotal{Group: group, Date: date})
+			}
+		}
+	}
+	return series
+}
+
+// calendarDays returns every day from first to last (YYYY-MM-DD), inclusive
+func calendarDays(first, last string) []string {
+	days := make([]string, 0)
+	day, err := time.Parse(dateLayout, first)
+	if err != nil {
+		return days
+	}
+	for d := day.Format(dateLayout); d <= last; d = day.Format(dateLayout) {
+		days = append(days, d)
+		day = day.AddDate(0, 0, 1)
+	}
+	return days
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// SizeNode is a node of the hierarchy the sunburst expects (as in viz/data/flare.json).
+// Size is the node's own size: d3's hierarchy.sum adds its children's.
+type SizeNode struct {
+	Name     string      `json:"name"`
+	Size     int         `json:"size,omitempty"`
+	Children []*SizeNode `json:"children,omitempty"`
+}
+
+// GroupTree nests the group totals by their '/' separated components,
+// a group which is also the parent of other groups keeps its own size
+func GroupTree(xfrs []Transmitted, g Grouper) *SizeNode {
+	root := &SizeNode{Name: "/"}
+	for _, total := range SummarizeBy(xfrs, g) {
+		node := root
+		for _, part := range strings.Split(strings.Trim(total.Group, "/"), "/") {
+			if len(part) == 0 {
+				continue
+			}
+			var child *SizeNode
+			for _, c := range node.Children {
+				if c.Name == part {
+					child = c
+					break
+				}
+			}
+			if child == nil {
+				child = &SizeNode{Name: part}
+				node.Children = append(node.Children, child)
+			}
+			node = child
+		}
+		node.Size += total.Size
+	}
+	return root
+}
@@ -0,0 +1,177 @@
+package backblaze
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseGrouper(t *testing.T) {
+	var data = []struct {
+		spec string
+		path string
+		out  string
+	}{
+		{"depth:0", "/Users/daniel/Library/Caches/x", "/"},
+		{"depth:2", "/Users/daniel/Library/Caches/x", "/Users/daniel/"},
+		{"depth:9", "/Users/daniel/x", "/Users/daniel/"},
+		{"depth:2", "", ""},
+		{"volume:1", "", ""},
+		{"volume:1", "/Volumes/Space/archive/media/a.jpg", "/Volumes/Space/archive/"},
+		{"volume:1", "/Users/daniel/a.jpg", "/Users/"},
+		{"home:1", "/Users/daniel/Library/Caches/x", "/Users/daniel/Library/"},
+		{"home:1", "/Volumes/Space/archive/media/a.jpg", "/Volumes/Space/archive/"},
+		{"home:0", "/private/var/x", "/"},
+		{"ext", "/Users/daniel/IMG_0001.JPG", ".jpg"},
+		{"ext", "/Users/daniel/.bash_profile", ".bash_profile"},
+		{"ext", "/Users/daniel/Makefile", "(none)"},
+		{"ext", "/Users/dan.iel/Makefile", "(none)"},
+		{"regex:^/Users/([^/]+)/Library/([^/]+)/", "/Users/daniel/Library/Mail/V2/x", "daniel/Mail"},
+		{"regex:^/Users/([^/]+)/Library/([^/]+)/", "/Volumes/Space/x", OtherGroup},
+		{"regex:\\.[a-z]+$", "/a/b.txt", ".txt"},
+	}
+	for _, tt := range data {
+		g, err := ParseGrouper(tt.spec)
+		if err != nil {
+			t.Errorf("ParseGrouper(%q): unexpected error: %v", tt.spec, err)
+			continue
+		}
+		if got := g.Group(tt.path); got != tt.out {
+			t.Errorf("%s.Group(%q): expected %q, got %q", tt.spec, tt.path, tt.out, got)
+		}
+	}
+}
+
+func TestParseGrouperErrors(t *testing.T) {
+	for _, spec := range []string{"", "depth", "depth:x", "home:-1", "regex:(", "buckets:/no/such/file", "size:3"} {
+		if _, err := ParseGrouper(spec); err == nil {
+			t.Errorf("ParseGrouper(%q): expected an error", spec)
+		}
+	}
+}
+
+func TestParseBuckets(t *testing.T) {
+	in := `
+# name kind pattern
+Docker dir /Users/daniel/Library/Containers/com.docker.docker/
+Photos suffix .jpg
+Mail regex (?i)^/users/[^/]+/library/mail/
+Photos dir /Volumes/Space/archive/media/photo/
+`
+	buckets, err := ParseBuckets(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(buckets) != 3 || buckets[1].Name != "Photos" || len(buckets[1].Rules) != 2 {
+		t.Fatalf("unexpected buckets: %#v", buckets)
+	}
+	var data = []struct {
+		path string
+		out  string
+	}{
+		{"/Users/daniel/Library/Containers/com.docker.docker/Data/vms/0/Docker.raw", "Docker"},
+		{"/Users/daniel/Library/Containers/com.docker.docker/a.jpg", "Docker"}, // first match wins
+		{"/Users/daniel/Desktop/a.JPG", "Photos"},
+		{"/Volumes/Space/archive/media/photo/2018/a.heic", "Photos"},
+		{"/Users/daniel/Library/Mail/V6/x.emlx", "Mail"},
+		{"/Users/daniel/notes.txt", OtherGroup},
+	}
+	for _, tt := range data {
+		if got := buckets.Group(tt.path); got != tt.out {
+			t.Errorf("Group(%q): expected %q, got %q", tt.path, tt.out, got)
+		}
+	}
+
+	for _, bad := range []string{"Photos suffix", "Photos glob *.jpg", "Mail regex ("} {
+		if _, err := ParseBuckets(strings.NewReader(bad)); err == nil {
+			t.Errorf("ParseBuckets(%q): expected an error", bad)
+		}
+	}
+}
+
+var groupingXfrs = []Transmitted{
+	{Stamp: "2018-03-01 10:00:00", Size: 10, FName: "/Users/daniel/a.txt"},
+	{Stamp: "2018-03-01 11:00:00", Size: 20, FName: "/Users/daniel/Library/b.jpg"},
+	{Stamp: "2018-03-02 10:00:00", Size: 5, FName: "/Volumes/Space/c.jpg"},
+	{Stamp: "2018-03-02 12:00:00", Size: 7, FName: "/Users/daniel/d.txt"},
+}
+
+func TestSummarizeBy(t *testing.T) {
+	got := SummarizeBy(groupingXfrs, ExtensionGrouper{})
+	expected := []GroupTotal{
+		{Group: ".jpg", Count: 2, Size: 25},
+		{Group: ".txt", Count: 2, Size: 17},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %#v, got %#v", expected, got)
+	}
+}
+
+func TestDailySeries(t *testing.T) {
+	got := DailySeries(groupingXfrs, DepthGrouper{Depth: 1})
+	expected := []GroupTotal{
+		{Group: "/Users/", Date: "2018-03-01", Count: 2, Size: 30},
+		{Group: "/Users/", Date: "2018-03-02", Count: 1, Size: 7},
+		{Group: "/Volumes/", Date: "2018-03-01"},
+		{Group: "/Volumes/", Date: "2018-03-02", Count: 1, Size: 5},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %#v, got %#v", expected, got)
+	}
+}
+
+func TestGroupTree(t *testing.T) {
+	xfrs := append(groupingXfrs, Transmitted{Stamp: "2018-03-02 13:00:00", Size: 1, FName: "/Users/x"})
+	got := GroupTree(xfrs, DepthGrouper{Depth: 2, Anchor: VolumeAnchor})
+	expected := &SizeNode{Name: "/", Children: []*SizeNode{
+		{Name: "Users", Size: 1, Children: []*SizeNode{
+			{Name: "daniel", Size: 37},
+		}},
+		{Name: "Volumes", Children: []*SizeNode{
+			{Name: "Space", Size: 5},
+		}},
+	}}
+	if !reflect.DeepEqual(got, expected) {
+		e, _ := json.Marshal(expected)
+		g, _ := json.Marshal(got)
+		t.Errorf("expected %s, got %s", e, g)
+	}
+}
+
+func TestDailySeriesFillsCalendar(t *testing.T) {
+	xfrs := []Transmitted{
+		{Stamp: "2018-02-27 10:00:00", Size: 1, FName: "/a/x"},
+		{Stamp: "2018-03-02 10:00:00", Size: 2, FName: "/a/y"},
+	}
+	got := DailySeries(xfrs, DepthGrouper{Depth: 1})
+	dates := make([]string, 0)
+	for _, total := range got {
+		dates = append(dates, total.Date)
+	}
+	expected := []string{"2018-02-27", "2018-02-28", "2018-03-01", "2018-03-02"}
+	if !reflect.DeepEqual(dates, expected) {
+		t.Errorf("expected %v, got %v", expected, dates)
+	}
+}
+
+func TestDailySeriesUntilStopped(t *testing.T) {
+	// daily uploads, which stopped after 2018-10-08
+	xfrs := make([]Transmitted, 0)
+	for day := 1; day <= 8; day++ {
+		xfrs = append(xfrs, Transmitted{Stamp: fmt.Sprintf("2018-10-%02d 10:00:00", day), Size: 100, FName: "/a/x"})
+	}
+	series := DailySeriesUntil(xfrs, DepthGrouper{Depth: 0}, "2018-10-10")
+	if len(series) != 10 || series[9] != (GroupTotal{Group: "/", Date: "2018-10-10"}) {
+		t.Fatalf("expected the series to be zero filled up to 2018-10-10, got %+v", series)
+	}
+	found := DetectAnomalies(series, DefaultAnomalyWindow, DefaultAnomalyThreshold)
+	if len(found) != 2 || found[0].Date != "2018-10-09" || found[0].Kind != StoppedAnomaly {
+		t.Errorf("expected the days since the uploads stopped to be flagged, got %+v", found)
+	}
+	// until before the last day changes nothing
+	if got := DailySeriesUntil(xfrs, DepthGrouper{Depth: 0}, "2018-10-01"); len(got) != 8 {
+		t.Errorf("expected 8 days, got %d", len(got))
+	}
+}
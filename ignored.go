@@ -0,0 +1,386 @@
+package backblaze
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// IgnoredReport is the outcome of comparing the fileids (what is backed up)
+// with the filelists (what is on disk): which files are not backed up, and why
+type IgnoredReport struct {
+	Summary       IgnoredSummary `json:"summary"`
+	Rules         []RuleCount    `json:"rules"`
+	TopFiles      []NotBackedUp  `json:"topFiles"`
+	Dirs          []DirTotal     `json:"dirs"`
+	Unexplained   []DirRollup    `json:"unexplained"`
+	MissingOnDisk []string       `json:"missingOnDisk"`
+	NotBackedUp   []NotBackedUp  `json:"notBackedUp"`
+
+	rules ExclusionRules
+	tree  *DirTree
+}
+
+// IgnoredSummary holds the counts of an IgnoredReport
+type IgnoredSummary struct {
+	FileIds       int `json:"fileids"`
+	FileList      int `json:"filelist"`
+	Equal         int `json:"equal"`
+	MissingOnDisk int `json:"missingOnDisk"`
+	NotBackedUp   int `json:"notBackedUp"`
+	Unaccounted   int `json:"unaccounted"`
+
+	NotBackedUpBytes int64 `json:"notBackedUpBytes"`
+	UnaccountedBytes int64 `json:"unaccountedBytes"`
+}
+
+// RuleCount is the number (and total size) of not backed up files matched by an exclusion rule
+type RuleCount struct {
+	Rule  string `json:"rule"`
+	Kind  string `json:"kind"`
+	Count int    `json:"count"`
+	Bytes int64  `json:"bytes"`
+}
+
+// NotBackedUp is a file which is on disk, but not in the fileids.
+// Reasons are the matching exclusion rules, empty when unaccounted for.
+type NotBackedUp struct {
+	Path    string   `json:"path"`
+	Size    int64    `json:"size"`
+	Reasons []string `json:"reasons"`
+}
+
+// DirTotal is the number and total size of not backed up files directly in a directory
+type DirTotal struct {
+	Dir         string `json:"dir"`
+	Count       int    `json:"count"`
+	Bytes       int64  `json:"bytes"`
+	Unaccounted int    `json:"unaccounted"`
+}
+
+// NewIgnoredReport returns an empty report, explaining files with rules
+func NewIgnoredReport(rules ExclusionRules) *IgnoredReport {
+	report := &IgnoredReport{
+		Rules:         make([]RuleCount, len(rules)),
+		TopFiles:      make([]NotBackedUp, 0),
+		Dirs:          make([]DirTotal, 0),
+		Unexplained:   make([]DirRollup, 0),
+		MissingOnDisk: make([]string, 0),
+		NotBackedUp:   make([]NotBackedUp, 0),
+		rules:         rules,
+		tree:          NewDirTree(),
+	}
+	for i, rule := range rules {
+		report.Rules[i] = RuleCount{Rule: rule.String(), Kind: rule.Kind}
+	}
+	return report
+}
+
+// AddEqual counts a file which is both on disk and backed up
+func (report *IgnoredReport) AddEqual(path string, size int64) {
+	report.tree.Add(path, size, false)
+	report.Summary.FileIds++
+	report.Summary.FileList++
+	report.Summary.Equal++
+}
+
+// AddMissingOnDisk records a backed up file which is no longer on disk
+func (report *IgnoredReport) AddMissingOnDisk(path string) {
+	report.Summary.FileIds++
+	report.Summary.MissingOnDisk++
+	report.MissingOnDisk = append(report.MissingOnDisk, path)
+}
+
+// AddNotBackedUp records a file on disk which is not backed up, and explains it
+func (report *IgnoredReport) AddNotBackedUp(path string, size int64) NotBackedUp {
+	report.Summary.FileList++
+	report.Summary.NotBackedUp++
+	report.Summary.NotBackedUpBytes += size
+	nbu := NotBackedUp{Path: path, Size: size, Reasons: make([]string, 0)}
+	for i, rule := range report.rules {
+		if rule.Match(path) {
+			report.Rules[i].Count++
+			report.Rules[i].Bytes += size
+			nbu.Reasons = append(nbu.Reasons, report.Rules[i].Rule)
+		}
+	}
+	if len(nbu.Reasons) == 0 {
+		report.Summary.Unaccounted++
+		report.Summary.UnaccountedBytes += size
+	}
+	report.tree.Add(path, size, len(nbu.Reasons) == 0)
+	report.NotBackedUp = append(report.NotBackedUp, nbu)
+	return nbu
+}
+
+// Rank orders the rules by bytes excluded, then by count, keeping their order on a tie,
+// and fills in the topN largest not backed up files, and the directories holding them,
+// largest first, ties broken by path.
+// Unaccounted files are rolled up into (all of) the directories holding them.
+func (report *IgnoredReport) Rank(topN int) {
+	report.Unexplained = report.tree.Rollup()
+
+	sort.SliceStable(report.Rules, func(i, j int) bool {
+		if report.Rules[i].Bytes == report.Rules[j].Bytes {
+			return report.Rules[i].Count > report.Rules[j].Count
+		}
+		return report.Rules[i].Bytes > report.Rules[j].Bytes
+	})
+
+	top := make([]NotBackedUp, len(report.NotBackedUp))
+	copy(top, report.NotBackedUp)
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Size == top[j].Size {
+			return top[i].Path < top[j].Path
+		}
+		return top[i].Size > top[j].Size
+	})
+	if len(top) > topN {
+		top = top[:topN]
+	}
+	report.TopFiles = top
+
+	dirs := make(map[string]*DirTotal)
+	for _, nbu := range report.NotBackedUp {
+		dir := filepath.Dir(nbu.Path) + "/"
+		if dir == "//" {
+			dir = "/"
+		}
+		total, ok := dirs[dir]
+		if !ok {
+			total = &DirTotal{Dir: dir}
+			dirs[dir] = total
+		}
+		total.Count++
+		total.Bytes += nbu.Size
+		if len(nbu.Reasons) == 0 {
+			total.Unaccounted++
+		}
+	}
+	report.Dirs = make([]DirTotal, 0, len(dirs))
+	for _, total := range dirs {
+		report.Dirs = append(report.Dirs, *total)
+	}
+	sort.Slice(report.Dirs, func(i, j int) bool {
+		if report.Dirs[i].Bytes == report.Dirs[j].Bytes {
+			return report.Dirs[i].Dir < report.Dirs[j].Dir
+		}
+		return report.Dirs[i].Bytes > report.Dirs[j].Bytes
+	})
+	if len(report.Dirs) > topN {
+		report.Dirs = report.Dirs[:topN]
+	}
+}
+
+// Output formats for WriteFormat
+const (
+	FormatText  = "text"
+	FormatJSON  = "json"
+	FormatJSONL = "jsonl"
+	FormatCSV   = "csv"
+	FormatHTML  = "html" // only some reports
+)
+
+// Report is written in one of the Format* formats
+type Report interface {
+	WriteFormat(w io.Writer, format string) error
+}
+
+// WriteReport writes report to the file named output, or to w if output is empty
+func WriteReport(w io.Writer, report Report, format, output string) error {
+	if len(output) == 0 {
+		return report.WriteFormat(w, format)
+	}
+	outfile, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	if err := report.WriteFormat(outfile, format); err != nil {
+		outfile.Close()
+		return err
+	}
+	return outfile.Close()
+}
+
+// WriteFormat writes the report in one of the Format* formats
+func (report *IgnoredReport) WriteFormat(w io.Writer, format string) error {
+	switch format {
+	case FormatText:
+		return report.WriteText(w)
+	case FormatJSON:
+		return report.WriteJSON(w)
+	case FormatJSONL:
+		return report.WriteJSONL(w)
+	case FormatCSV:
+		return report.WriteCSV(w)
+	}
+	return fmt.Errorf("unknown format: %q", format)
+}
+
+// WriteJSON writes the report as a single JSON object
+func (report *IgnoredReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// fileRecord is a file line of the JSONL output
+type fileRecord struct {
+	Record  string   `json:"record"`
+	Path    string   `json:"path"`
+	Size    *int64   `json:"size,omitempty"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// WriteJSONL writes one JSON object per line: the summary, then one per
+// rule, top file, directory, missing on disk, and not backed up file.
+// Each object has a "record" field (summary,rule,topFile,dir,unexplained,missingOnDisk,notBackedUp)
+func (report *IgnoredReport) WriteJSONL(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	enc.Encode(struct {
+		Record string `json:"record"`
+		IgnoredSummary
+	}{"summary", report.Summary})
+	for _, rc := range report.Rules {
+		enc.Encode(struct {
+			Record string `json:"record"`
+			RuleCount
+		}{"rule", rc})
+	}
+	for i, nbu := range report.TopFiles {
+		enc.Encode(fileRecord{Record: "topFile", Path: nbu.Path, Size: &report.TopFiles[i].Size, Reasons: nbu.Reasons})
+	}
+	for _, dir := range report.Dirs {
+		enc.Encode(struct {
+			Record string `json:"record"`
+			DirTotal
+		}{"dir", dir})
+	}
+	for _, rollup := range report.Unexplained {
+		enc.Encode(struct {
+			Record string `json:"record"`
+			DirRollup
+		}{"unexplained", rollup})
+	}
+	for _, path := range report.MissingOnDisk {
+		enc.Encode(fileRecord{Record: "missingOnDisk", Path: path})
+	}
+	for i, nbu := range report.NotBackedUp {
+		enc.Encode(fileRecord{Record: "notBackedUp", Path: nbu.Path, Size: &report.NotBackedUp[i].Size, Reasons: nbu.Reasons})
+	}
+	return bw.Flush()
+}
+
+// WriteCSV writes a single table, with a header: record,key,count,bytes,reasons
+// Summary rows are keyed by the counter name, rule rows by the rule,
+// dir rows by the directory and file rows by the path, with reasons separated by ';'
+// Unexplained rows count the unaccounted files by directory, their reason is "uniform"
+// if every file in the directory is unaccounted.
+func (report *IgnoredReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"record", "key", "count", "bytes", "reasons"})
+	s := report.Summary
+	for _, kv := range []struct {
+		key   string
+		count int
+		bytes string
+	}{
+		{"fileids", s.FileIds, ""},
+		{"filelist", s.FileList, ""},
+		{"equal", s.Equal, ""},
+		{"missingOnDisk", s.MissingOnDisk, ""},
+		{"notBackedUp", s.NotBackedUp, strconv.FormatInt(s.NotBackedUpBytes, 10)},
+		{"unaccounted", s.Unaccounted, strconv.FormatInt(s.UnaccountedBytes, 10)},
+	} {
+		cw.Write([]string{"summary", kv.key, strconv.Itoa(kv.count), kv.bytes, ""})
+	}
+	for _, rc := range report.Rules {
+		cw.Write([]string{"rule", rc.Rule, strconv.Itoa(rc.Count), strconv.FormatInt(rc.Bytes, 10), ""})
+	}
+	for _, nbu := range report.TopFiles {
+		cw.Write([]string{"topFile", nbu.Path, "", strconv.FormatInt(nbu.Size, 10), strings.Join(nbu.Reasons, ";")})
+	}
+	for _, dir := range report.Dirs {
+		cw.Write([]string{"dir", dir.Dir, strconv.Itoa(dir.Count), strconv.FormatInt(dir.Bytes, 10), ""})
+	}
+	for _, rollup := range report.Unexplained {
+		uniform := ""
+		if rollup.Uniform {
+			uniform = "uniform"
+		}
+		cw.Write([]string{"unexplained", rollup.Dir, strconv.Itoa(rollup.Marked.Files), strconv.FormatInt(rollup.Marked.Bytes, 10), uniform})
+	}
+	for _, path := range report.MissingOnDisk {
+		cw.Write([]string{"missingOnDisk", path, "", "", ""})
+	}
+	for _, nbu := range report.NotBackedUp {
+		cw.Write([]string{"notBackedUp", nbu.Path, "", strconv.FormatInt(nbu.Size, 10), strings.Join(nbu.Reasons, ";")})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteText writes the report for humans, as bzWhyIgnored always has
+func (report *IgnoredReport) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	s := report.Summary
+	fmt.Fprintf(bw, "Equal: %d\n", s.Equal)
+	fmt.Fprintf(bw, "aNotInB (Missing on Disk): %d\n", s.MissingOnDisk)
+	fmt.Fprintf(bw, "bNotInA (Not Backed Up): %d\n", s.NotBackedUp)
+	if len(report.Unexplained) > 0 {
+		fmt.Fprintf(bw, "NotBackedUp: Unexplained, by directory (U: all files unexplained, likely a user exclusion)\n")
+		for _, rollup := range report.Unexplained {
+			uniform := " "
+			if rollup.Uniform {
+				uniform = "U"
+			}
+			fmt.Fprintf(bw, " %s %9d/%-9d %10s : %s\n", uniform, rollup.Marked.Files, rollup.Total.Files, HumanBytes(rollup.Marked.Bytes), rollup.Dir)
+		}
+	}
+	fmt.Fprintf(bw, "NotBackedUp: total: %d (%s)\n", s.NotBackedUp, HumanBytes(s.NotBackedUpBytes))
+	fmt.Fprintf(bw, "NotBackedUp: unaccounted: %d (%s)\n", s.Unaccounted, HumanBytes(s.UnaccountedBytes))
+	for _, kind := range []string{SuffixRule, RegexRule, DirRule} {
+		fmt.Fprintf(bw, "NotBackedUp: Ignored by %s\n", kind)
+		for _, rc := range report.Rules {
+			if rc.Kind == kind {
+				fmt.Fprintf(bw, " %9d %10s : %s\n", rc.Count, HumanBytes(rc.Bytes), strings.TrimPrefix(rc.Rule, kind+":"))
+			}
+		}
+	}
+	if len(report.TopFiles) > 0 {
+		fmt.Fprintf(bw, "NotBackedUp: Largest files\n")
+		for _, nbu := range report.TopFiles {
+			fmt.Fprintf(bw, " %10s : %s %v\n", HumanBytes(nbu.Size), nbu.Path, nbu.Reasons)
+		}
+	}
+	if len(report.Dirs) > 0 {
+		fmt.Fprintf(bw, "NotBackedUp: Largest directories (count unaccounted)\n")
+		for _, dir := range report.Dirs {
+			fmt.Fprintf(bw, " %10s %9d %9d : %s\n", HumanBytes(dir.Bytes), dir.Count, dir.Unaccounted, dir.Dir)
+		}
+	}
+	return bw.Flush()
+}
+
+// HumanBytes formats a size with binary prefixes: 512 B, 1.50 KiB
+func HumanBytes(b int64) string {
+	if b < 1024 {
+		return fmt.Sprintf("%d B", b)
+	}
+	suffixes := []string{"", "Ki", "Mi", "Gi", "Ti", "Pi", "Ei"}
+	i := 0
+	v := float64(b)
+	for v >= 1024 && i < len(suffixes)-1 {
+		v /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.2f %sB", v, suffixes[i])
+}
@@ -0,0 +1,173 @@
+package backblaze
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func testIgnoredReport() *IgnoredReport {
+	rules := ExclusionRules{}
+	for _, suffix := range []string{".log", ".dmg"} {
+		rule, _ := NewExclusionRule(SuffixRule, suffix)
+		rules = append(rules, rule)
+	}
+	rule, _ := NewExclusionRule(RegexRule, "(?i)^/users/.*/library/logs/")
+	rules = append(rules, rule)
+
+	report := NewIgnoredReport(rules)
+	report.AddEqual("/Users/daniel/Downloads/d.txt", 1)
+	report.AddEqual("/Users/daniel/e.txt", 1)
+	report.AddMissingOnDisk("/Users/daniel/gone.txt")
+	report.AddNotBackedUp("/Users/daniel/Library/Logs/a.log", 100)
+	report.AddNotBackedUp("/Users/daniel/Downloads/b.dmg", 4000)
+	report.AddNotBackedUp("/Users/daniel/Downloads/c, \"quoted\".txt", 20)
+	report.Rank(2)
+	return report
+}
+
+func TestIgnoredReport(t *testing.T) {
+	report := testIgnoredReport()
+	expected := IgnoredSummary{FileIds: 3, FileList: 5, Equal: 2, MissingOnDisk: 1, NotBackedUp: 3, Unaccounted: 1, NotBackedUpBytes: 4120, UnaccountedBytes: 20}
+	if report.Summary != expected {
+		t.Errorf("expected:\n%#v\ngot:\n%#v", expected, report.Summary)
+	}
+	// ranked by bytes
+	counts := []RuleCount{
+		{Rule: "suffix:.dmg", Kind: SuffixRule, Count: 1, Bytes: 4000},
+		{Rule: "suffix:.log", Kind: SuffixRule, Count: 1, Bytes: 100},
+		{Rule: "regex:(?i)^/users/.*/library/logs/", Kind: RegexRule, Count: 1, Bytes: 100},
+	}
+	if !reflect.DeepEqual(counts, report.Rules) {
+		t.Errorf("expected:\n%#v\ngot:\n%#v", counts, report.Rules)
+	}
+	top := []NotBackedUp{
+		{Path: "/Users/daniel/Downloads/b.dmg", Size: 4000, Reasons: []string{"suffix:.dmg"}},
+		{Path: "/Users/daniel/Library/Logs/a.log", Size: 100, Reasons: []string{"suffix:.log", "regex:(?i)^/users/.*/library/logs/"}},
+	}
+	if !reflect.DeepEqual(top, report.TopFiles) {
+		t.Errorf("expected:\n%#v\ngot:\n%#v", top, report.TopFiles)
+	}
+	dirs := []DirTotal{
+		{Dir: "/Users/daniel/Downloads/", Count: 2, Bytes: 4020, Unaccounted: 1},
+		{Dir: "/Users/daniel/Library/Logs/", Count: 1, Bytes: 100},
+	}
+	if !reflect.DeepEqual(dirs, report.Dirs) {
+		t.Errorf("expected:\n%#v\ngot:\n%#v", dirs, report.Dirs)
+	}
+	reasons := []string{"suffix:.log", "regex:(?i)^/users/.*/library/logs/"}
+	if !reflect.DeepEqual(reasons, report.NotBackedUp[0].Reasons) {
+		t.Errorf("expected:\n%q\ngot:\n%q", reasons, report.NotBackedUp[0].Reasons)
+	}
+}
+
+func TestIgnoredReportCSV(t *testing.T) {
+	report := testIgnoredReport()
+	var buf bytes.Buffer
+	if err := report.WriteFormat(&buf, FormatCSV); err != nil {
+		t.Fatal(err)
+	}
+	expected := `record,key,count,bytes,reasons
+summary,fileids,3,,
+summary,filelist,5,,
+summary,equal,2,,
+summary,missingOnDisk,1,,
+summary,notBackedUp,3,4120,
+summary,unaccounted,1,20,
+rule,suffix:.dmg,1,4000,
+rule,suffix:.log,1,100,
+rule,regex:(?i)^/users/.*/library/logs/,1,100,
+topFile,/Users/daniel/Downloads/b.dmg,,4000,suffix:.dmg
+topFile,/Users/daniel/Library/Logs/a.log,,100,suffix:.log;regex:(?i)^/users/.*/library/logs/
+dir,/Users/daniel/Downloads/,2,4020,
+dir,/Users/daniel/Library/Logs/,1,100,
+unexplained,/Users/daniel/Downloads/,1,20,
+missingOnDisk,/Users/daniel/gone.txt,,,
+notBackedUp,/Users/daniel/Library/Logs/a.log,,100,suffix:.log;regex:(?i)^/users/.*/library/logs/
+notBackedUp,/Users/daniel/Downloads/b.dmg,,4000,suffix:.dmg
+notBackedUp,"/Users/daniel/Downloads/c, ""quoted"".txt",,20,
+`
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestIgnoredReportEdgeCases(t *testing.T) {
+	var data = []struct {
+		name     string
+		paths    []string
+		expected IgnoredSummary
+	}{
+		{"empty", nil, IgnoredSummary{}},
+		{"one record", []string{"/Users/daniel/a.txt"}, IgnoredSummary{FileList: 1, NotBackedUp: 1, Unaccounted: 1, NotBackedUpBytes: 10, UnaccountedBytes: 10}},
+	}
+	for _, tt := range data {
+		report := NewIgnoredReport(DefaultExclusionRules())
+		for _, path := range tt.paths {
+			report.AddNotBackedUp(path, 10)
+		}
+		report.Rank(2)
+		if report.Summary != tt.expected || len(report.TopFiles) != len(tt.paths) {
+			t.Errorf("%s: unexpected summary %+v, top files %+v", tt.name, report.Summary, report.TopFiles)
+		}
+		if err := report.WriteFormat(ioutil.Discard, FormatText); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	var want bytes.Buffer
+	testIgnoredReport().WriteFormat(&want, FormatJSON)
+
+	var buf bytes.Buffer
+	if err := WriteReport(&buf, testIgnoredReport(), FormatJSON, ""); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != want.String() {
+		t.Errorf("expected the report on w, got:\n%s", buf.String())
+	}
+
+	dir, err := ioutil.TempDir("", "report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	output := filepath.Join(dir, "report.json")
+	buf.Reset()
+	if err := WriteReport(&buf, testIgnoredReport(), FormatJSON, output); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want.String() || buf.Len() != 0 {
+		t.Errorf("expected the report in %s only, got:\n%s", output, got)
+	}
+	if err := WriteReport(&buf, testIgnoredReport(), "xml", ""); err == nil {
+		t.Errorf("expected an error for format xml")
+	}
+}
+
+func TestHumanBytes(t *testing.T) {
+	var data = []struct {
+		in  int64
+		out string
+	}{
+		{in: 0, out: "0 B"},
+		{in: 1, out: "1 B"},
+		{in: 1023, out: "1023 B"},
+		{in: 1024, out: "1.00 KiB"},
+		{in: 1536, out: "1.50 KiB"},
+		{in: 42949672960, out: "40.00 GiB"},
+	}
+	for _, tt := range data {
+		if got := HumanBytes(tt.in); got != tt.out {
+			t.Errorf("Test:%d expected: %s got: %s", tt.in, tt.out, got)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package backblaze
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// FileError is a file which could not be (completely) parsed
+type FileError struct {
+	File string
+	Err  error
+}
+
+func (fe FileError) Error() string {
+	return fmt.Sprintf("%s: %v", fe.File, fe.Err)
+}
+
+// Ingester parses transmitted log files with a bounded pool of workers,
+// and merges their records in time order. The merge does not depend on
+// which worker finished first: Workers 1 is the sequential path, with identical results.
+type Ingester struct {
+	Workers   int // files parsed in parallel, runtime.NumCPU() if 0
+	KeepDedup bool
+	// Keep decides whether a file's records are merged, all are if nil.
+	// It is called in the order of the files, after they are all parsed, never concurrently.
+	Keep     func(file string, records []Transmitted) bool
+	Progress io.Writer // a line per parsed file, and per error, nil for none
+	FS       fs.FS     // the files are read from FS if set, are OS paths otherwise
+}
+
+// Ingested is the outcome of Ingest
+type Ingested struct {
+	Records []Transmitted // by stamp, then in the order of the files (and lines)
+	Files   []string      // merged
+	Skipped []string      // not kept
+	Errors  []FileError   // malformed lines are skipped (see MalformedError), the records before any other error are kept
+}
+
+// Ingest parses files, and merges their records
+func (in *Ingester) Ingest(files []string) Ingested {
+	type result struct {
+		records []Transmitted
+		err     error
+	}
+	results := make([]result, len(files))
+	workers := in.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > len(files) {
+		workers = len(files)
+	}
+
+	jobs := make(chan int)
+	done := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				var r result
+				if in.FS != nil {
+					r.records, r.err = ReadTransmittedFS(in.FS, files[i], in.KeepDedup)
+				} else {
+					r.records, r.err = ReadTransmitted(files[i], in.KeepDedup)
+				}
+				results[i] = r
+				done <- i
+			}
+		}()
+	}
+	go func() {
+		for i := range files {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+		close(done)
+	}()
+	parsed := 0
+	for i := range done {
+		parsed++
+		if in.Progress != nil {
+			fmt.Fprintf(in.Progress, " -- Parsed [%d/%d] %s: %d records\n", parsed, len(files), files[i], len(results[i].records))
+		}
+	}
+
+	ingested := Ingested{Records: make([]Transmitted, 0), Files: make([]string, 0), Skipped: make([]string, 0), Errors: make([]FileError, 0)}
+	for i, file := range files {
+		r := results[i]
+		if r.err != nil {
+			fe := FileError{File: file, Err: r.err}
+			ingested.Errors = append(ingested.Errors, fe)
+			if in.Progress != nil {
+				fmt.Fprintf(in.Progress, " -- Error: %v\n", fe)
+			}
+		}
+		if in.Keep != nil && !in.Keep(file, r.records) {
+			ingested.Skipped = append(ingested.Skipped, file)
+			continue
+		}
+		ingested.Files = append(ingested.Files, file)
+		ingested.Records = append(ingested.Records, r.records...)
+	}
+	sort.SliceStable(ingested.Records, func(i, j int) bool { return ingested.Records[i].Stamp < ingested.Records[j].Stamp })
+	return ingested
+}
+
+// IngestSource ingests the transmitted logs of src, compressed ones included
+func (in *Ingester) IngestSource(src DataSource) (Ingested, error) {
+	files, err := TransmittedLogs(src)
+	if err != nil {
+		return Ingested{}, err
+	}
+	fromSrc := *in
+	fromSrc.FS = src
+	return fromSrc.Ingest(files), nil
+}
+
+// IngestBzData ingests the transmitted logs of a bzdata directory, or of a tar archive of one (see OpenSource)
+func (in *Ingester) IngestBzData(path string) (Ingested, error) {
+	src, err := OpenSource(path)
+	if err != nil {
+		return Ingested{}, err
+	}
+	defer src.Close()
+	return in.IngestSource(src)
+}
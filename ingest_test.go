@@ -0,0 +1,127 @@
+package backblaze
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// ingestFiles copies the test logs as day files, in an order which is not the order of their stamps
+func ingestFiles(t *testing.T) (string, []string) {
+	dir, err := ioutil.TempDir("", "ingest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	copies := map[string]string{
+		"1.log":  "test/data/transmitted.log",
+		"10.log": "test/data/transmitted-sample.log",
+		"2.log":  "test/data/transmitted.log",
+		"3.log":  "test/data/transmitted-sample.log",
+	}
+	for name, src := range copies {
+		data, err := ioutil.ReadFile(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+	return dir, files
+}
+
+func TestIngest(t *testing.T) {
+	dir, files := ingestFiles(t)
+	defer os.RemoveAll(dir)
+
+	// the sequential way, as bzFlow did
+	expected := make([]Transmitted, 0)
+	for _, file := range files {
+		infile, err := os.Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected = append(expected, ParseTransmited(infile)...)
+		infile.Close()
+	}
+	sort.SliceStable(expected, func(i, j int) bool { return expected[i].Stamp < expected[j].Stamp })
+
+	missing := filepath.Join(dir, "missing.log")
+	for _, workers := range []int{1, 2, 8} {
+		in := &Ingester{Workers: workers}
+		got := in.Ingest(append(files, missing))
+		if !reflect.DeepEqual(expected, got.Records) {
+			t.Errorf("workers: %d: records differ from the sequential parse", workers)
+		}
+		if len(got.Files) != 5 || len(got.Skipped) != 0 {
+			t.Errorf("workers: %d: unexpected files: %v, skipped: %v", workers, got.Files, got.Skipped)
+		}
+		if len(got.Errors) != 1 || got.Errors[0].File != missing {
+			t.Errorf("workers: %d: expected an error for %s, got %v", workers, missing, got.Errors)
+		}
+	}
+}
+
+func TestIngestKeep(t *testing.T) {
+	dir, files := ingestFiles(t)
+	defer os.RemoveAll(dir)
+
+	order := make([]string, 0)
+	in := &Ingester{Workers: 4, KeepDedup: true, Keep: func(file string, records []Transmitted) bool {
+		order = append(order, filepath.Base(file))
+		return len(records) > 0 && records[0].Stamp < "2018-10-10"
+	}}
+	got := in.Ingest(files)
+	if expected := []string{"1.log", "10.log", "2.log", "3.log"}; !reflect.DeepEqual(expected, order) {
+		t.Errorf("expected Keep to be called in order %v, got %v", expected, order)
+	}
+	// transmitted.log starts on 2018-10-02, the sample on 2018-10-17
+	if len(got.Files) != 2 || len(got.Skipped) != 2 {
+		t.Errorf("unexpected files: %v, skipped: %v", got.Files, got.Skipped)
+	}
+	for i := 1; i < len(got.Records); i++ {
+		if got.Records[i].Stamp < got.Records[i-1].Stamp {
+			t.Fatalf("records not in time order at %d", i)
+		}
+	}
+}
+
+func TestIngestTruncated(t *testing.T) {
+	dir, files := ingestFiles(t)
+	defer os.RemoveAll(dir)
+
+	data, err := ioutil.ReadFile("test/data/transmitted-sample.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// cut in the middle of the fourth line, as a copy interrupted while the log was written
+	truncated := filepath.Join(dir, "4.log")
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	cut := len(lines[0]) + len(lines[1]) + len(lines[2]) + 40
+	if err := ioutil.WriteFile(truncated, data[:cut], 0644); err != nil {
+		t.Fatal(err)
+	}
+	complete := (&Ingester{Workers: 2}).Ingest(files)
+	var progress bytes.Buffer
+	got := (&Ingester{Workers: 2, Progress: &progress}).Ingest(append(files, truncated))
+	if len(got.Errors) != 1 || got.Errors[0].File != truncated {
+		t.Fatalf("expected an error for %s, got %v", truncated, got.Errors)
+	}
+	if !bytes.Contains(progress.Bytes(), []byte(" -- Error: "+got.Errors[0].Error()+"\n")) {
+		t.Errorf("expected the error in the progress, got:\n%s", progress.String())
+	}
+	var malformed *MalformedError
+	if !errors.As(got.Errors[0].Err, &malformed) || malformed.Lines != 1 {
+		t.Errorf("expected a malformed line, got %v", got.Errors[0].Err)
+	}
+	// the other files, and the complete lines of the truncated one, are merged
+	if len(got.Files) != len(files)+1 || len(got.Records) <= len(complete.Records) {
+		t.Errorf("unexpected files: %v, records: %d (%d without the truncated file)", got.Files, len(got.Records), len(complete.Records))
+	}
+}
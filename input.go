@@ -0,0 +1,116 @@
+package backblaze
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// CompressedExts are the extensions of the compressed inputs GlobInputs also matches.
+// The compression is detected by the magic bytes of the content, not by the extension.
+var CompressedExts = []string{".gz", ".zst", ".bz2"}
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	bzip2Magic = []byte("BZh")
+)
+
+// Decompress returns the content of r, decompressed if it is gzip, zstd or bzip2 compressed,
+// as is otherwise. Closing it releases the decompressor, not r.
+func Decompress(r io.Reader) (io.ReadCloser, error) {
+	rc, _, err := decompress(r)
+	return rc, err
+}
+
+func decompress(r io.Reader) (io.ReadCloser, bool, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil && err != io.EOF {
+		return nil, false, err
+	}
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		zr, err := gzip.NewReader(br)
+		return zr, true, err
+	case bytes.HasPrefix(magic, zstdMagic):
+		dec, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, true, err
+		}
+		return dec.IOReadCloser(), true, nil
+	case bytes.HasPrefix(magic, bzip2Magic):
+		return ioutil.NopCloser(bzip2.NewReader(br)), true, nil
+	}
+	return ioutil.NopCloser(br), false, nil
+}
+
+type inputFile struct {
+	io.ReadCloser
+	file fs.File
+}
+
+func (in inputFile) Close() error {
+	err := in.ReadCloser.Close()
+	if ferr := in.file.Close(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+// OpenInput opens name in fsys, decompressed (see Decompress)
+func OpenInput(fsys fs.FS, name string) (io.ReadCloser, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := Decompress(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return inputFile{rc, f}, nil
+}
+
+// GlobInputs returns the names in fsys matching pattern, or pattern with one of the CompressedExts, sorted.
+// A log may be there both as is and compressed (e.g. 13.log and 13.log.gz): only one name is returned
+// for each name without its compression extension, the uncompressed one if present.
+func GlobInputs(fsys fs.FS, pattern string) ([]string, error) {
+	byBase := make(map[string]string)
+	for _, ext := range append([]string{""}, CompressedExts...) {
+		matches, err := fs.Glob(fsys, pattern+ext)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range matches {
+			base := trimCompressedExt(name)
+			if seen, ok := byBase[base]; !ok || (seen != base && name == base) {
+				byBase[base] = name
+			}
+		}
+	}
+	names := make([]string, 0, len(byBase))
+	for _, name := range byBase {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// trimCompressedExt returns name without its compression extension, if it has one of the CompressedExts
+func trimCompressedExt(name string) string {
+	for _, ext := range CompressedExts {
+		if strings.HasSuffix(name, ext) {
+			return strings.TrimSuffix(name, ext)
+		}
+	}
+	return name
+}
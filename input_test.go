@@ -0,0 +1,100 @@
+package backblaze
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestDecompress(t *testing.T) {
+	plain, err := ioutil.ReadFile("test/data/transmitted-sample.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// there is no bzip2 writer in the standard library, the fixture was made with bzip2(1)
+	bz2, err := ioutil.ReadFile("test/data/transmitted-sample.log.bz2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(plain)
+	zw.Close()
+	var zst bytes.Buffer
+	enc, err := zstd.NewWriter(&zst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc.Write(plain)
+	enc.Close()
+
+	expected := sampleTransmitted(t)
+	inputs := map[string][]byte{"plain": plain, "gzip": gz.Bytes(), "zstd": zst.Bytes(), "bzip2": bz2}
+	for name, data := range inputs {
+		rc, err := Decompress(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil || !bytes.Equal(plain, got) {
+			t.Errorf("%s: content differs (%v)", name, err)
+		}
+		// the parsers decompress their input
+		if got := ParseTransmitedAll(bytes.NewReader(data)); !reflect.DeepEqual(expected, got) {
+			t.Errorf("%s: records differ", name)
+		}
+	}
+
+	// too short for any magic
+	rc, err := Decompress(strings.NewReader("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadAll(rc); string(got) != "x" {
+		t.Errorf("expected x, got %q", got)
+	}
+	// a truncated gzip header
+	if _, err := Decompress(bytes.NewReader(gz.Bytes()[:4])); err == nil {
+		t.Errorf("expected an error for a truncated gzip input")
+	}
+}
+
+func TestGlobInputs(t *testing.T) {
+	fsys := fstest.MapFS{
+		"logs/a.log":     {Data: []byte("a")},
+		"logs/b.log.gz":  {Data: []byte("b")},
+		"logs/c.log.zst": {Data: []byte("c")},
+		"logs/d.log.bz2": {Data: []byte("d")},
+		"logs/e.txt":     {Data: []byte("e")},
+		"logs/f.log.xz":  {Data: []byte("f")},
+	}
+	got, err := GlobInputs(fsys, "logs/*.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"logs/a.log", "logs/b.log.gz", "logs/c.log.zst", "logs/d.log.bz2"}
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	// a pattern which already matches the compressed names is not doubled
+	got, _ = GlobInputs(fsys, "logs/*")
+	if len(got) != len(fsys) {
+		t.Errorf("expected %d names, got %v", len(fsys), got)
+	}
+	// a log which is there both as is and compressed is only read once, uncompressed
+	fsys["logs/a.log.gz"] = &fstest.MapFile{Data: []byte("a")}
+	fsys["logs/b.log.zst"] = &fstest.MapFile{Data: []byte("b")}
+	for _, pattern := range []string{"logs/*.log", "logs/*"} {
+		got, _ = GlobInputs(fsys, pattern)
+		if len(got) < 4 || got[0] != "logs/a.log" || got[1] != "logs/b.log.gz" || got[2] != "logs/c.log.zst" {
+			t.Errorf("%s: expected one name per log, got %v", pattern, got)
+		}
+	}
+}
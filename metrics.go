@@ -0,0 +1,167 @@
+package backblaze
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics accumulates the transmitted records of some hosts,
+// and exposes them in the Prometheus text format (see WriteText)
+type Metrics struct {
+	Location *time.Location   // of the stamps, time.Local if nil
+	Now      func() time.Time // for the ages, time.Now if nil
+
+	mu    sync.Mutex
+	hosts map[string]*hostMetrics
+}
+
+type hostMetrics struct {
+	bytes    map[txRecordType]int64
+	records  map[txRecordType]int64
+	dedup    int64
+	rate     int // kBits/sec, of the last record sent
+	throttle string
+	level    int
+	last     time.Time // last transmission
+	lastScan time.Time // last filelist scan
+}
+
+// NewMetrics returns empty metrics
+func NewMetrics() *Metrics {
+	return &Metrics{hosts: make(map[string]*hostMetrics)}
+}
+
+func (m *Metrics) host(host string) *hostMetrics {
+	hm, ok := m.hosts[host]
+	if !ok {
+		hm = &hostMetrics{bytes: make(map[txRecordType]int64), records: make(map[txRecordType]int64)}
+		m.hosts[host] = hm
+	}
+	return hm
+}
+
+// Add counts a record (sent or dedup'd) transmitted by host
+func (m *Metrics) Add(host string, tx Transmitted) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hm := m.host(host)
+	hm.records[tx.Type]++
+	if tx.Dedup() {
+		hm.dedup++
+		return
+	}
+	hm.bytes[tx.Type] += int64(tx.Size)
+	loc := m.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	// the logs are not read in order (the day of month rolls over), keep the latest
+	t, err := ParseStamp(tx.Stamp, loc)
+	if err != nil || t.Before(hm.last) {
+		return
+	}
+	hm.last = t
+	if tx.Speed > 0 {
+		hm.rate = tx.Speed
+	}
+	if len(tx.Throttle) > 0 {
+		hm.throttle, hm.level = tx.Throttle, tx.Level
+	}
+}
+
+// SetLastScan records the time of host's last filelist scan
+func (m *Metrics) SetLastScan(host string, t time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.host(host).lastScan = t
+}
+
+// WriteText writes the metrics in the Prometheus text exposition format
+func (m *Metrics) WriteText(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if m.Now != nil {
+		now = m.Now()
+	}
+	hosts := make([]string, 0, len(m.hosts))
+	for host := range m.hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	bw := bufio.NewWriter(w)
+	metric := func(name, kind, help string, samples func(sample func(value float64, labels ...string))) {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+		samples(func(value float64, labels ...string) {
+			pairs := make([]string, 0, len(labels)/2)
+			for i := 0; i+1 < len(labels); i += 2 {
+				pairs = append(pairs, fmt.Sprintf("%s=%q", labels[i], labels[i+1]))
+			}
+			fmt.Fprintf(bw, "%s{%s} %s\n", name, strings.Join(pairs, ","), strconv.FormatFloat(value, 'f', -1, 64))
+		})
+	}
+	byType := func(counts func(hm *hostMetrics) map[txRecordType]int64) func(sample func(float64, ...string)) {
+		return func(sample func(float64, ...string)) {
+			for _, host := range hosts {
+				c := counts(m.hosts[host])
+				types := make([]string, 0, len(c))
+				for typ := range c {
+					types = append(types, string(typ))
+				}
+				sort.Strings(types)
+				for _, typ := range types {
+					sample(float64(c[txRecordType(typ)]), "host", host, "type", typ)
+				}
+			}
+		}
+	}
+	perHost := func(value func(hm *hostMetrics) (float64, bool)) func(sample func(float64, ...string)) {
+		return func(sample func(float64, ...string)) {
+			for _, host := range hosts {
+				if v, ok := value(m.hosts[host]); ok {
+					sample(v, "host", host)
+				}
+			}
+		}
+	}
+
+	metric("backblaze_transmitted_bytes_total", "counter", "Bytes sent, by record type.",
+		byType(func(hm *hostMetrics) map[txRecordType]int64 { return hm.bytes }))
+	metric("backblaze_transmitted_records_total", "counter", "Records (files, chunks or batched files) transmitted, by record type, including dedup.",
+		byType(func(hm *hostMetrics) map[txRecordType]int64 { return hm.records }))
+	metric("backblaze_dedup_records_total", "counter", "Records deduplicated, hence not sent.",
+		perHost(func(hm *hostMetrics) (float64, bool) { return float64(hm.dedup), true }))
+	metric("backblaze_upload_rate_kbits", "gauge", "Advertised rate of the last record sent, in kBits/sec.",
+		perHost(func(hm *hostMetrics) (float64, bool) { return float64(hm.rate), !hm.last.IsZero() }))
+	metric("backblaze_throttle", "gauge", "Throttle mode and level of the last record sent (always 1).",
+		func(sample func(float64, ...string)) {
+			for _, host := range hosts {
+				if hm := m.hosts[host]; len(hm.throttle) > 0 {
+					sample(1, "host", host, "mode", hm.throttle, "level", fmt.Sprint(hm.level))
+				}
+			}
+		})
+	metric("backblaze_last_transmission_timestamp_seconds", "gauge", "Time of the last record sent, in seconds since the epoch.",
+		perHost(func(hm *hostMetrics) (float64, bool) { return float64(hm.last.Unix()), !hm.last.IsZero() }))
+	metric("backblaze_filelist_scan_age_seconds", "gauge", "Time since the last filelist scan.",
+		perHost(func(hm *hostMetrics) (float64, bool) {
+			return now.Sub(hm.lastScan).Truncate(time.Second).Seconds(), !hm.lastScan.IsZero()
+		}))
+	return bw.Flush()
+}
+
+// ServeHTTP serves the metrics, e.g. on /metrics
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := m.WriteText(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
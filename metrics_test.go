@@ -0,0 +1,57 @@
+package backblaze
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics()
+	m.Location = time.UTC
+	m.Now = func() time.Time { return time.Date(2018, 10, 2, 0, 0, 0, 0, time.UTC) }
+	for _, tx := range []Transmitted{
+		{Type: normal, Stamp: "2018-10-01 10:00:10", Speed: 2000, Size: 250000, Throttle: "manual", Level: 11},
+		// read later, but logged earlier
+		{Type: normal, Stamp: "2018-10-01 10:00:00", Speed: 1000, Size: 125000, Throttle: "auto", Level: 5},
+		{Type: chunked, Stamp: "2018-10-01 09:00:00", Speed: 100, Size: 12500, Chunk: 1, Throttle: "manual", Level: 11},
+		{Type: dedup, Stamp: "2018-10-01 14:00:01", Throttle: "x"},
+	} {
+		m.Add("galois", tx)
+	}
+	m.SetLastScan("galois", time.Date(2018, 10, 1, 23, 0, 0, 0, time.UTC))
+	m.Add("davinci", Transmitted{Type: dedup, Stamp: "2018-10-01 14:00:01", Throttle: "x"})
+
+	var buf bytes.Buffer
+	if err := m.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	text := buf.String()
+	for _, expected := range []string{
+		"# TYPE backblaze_transmitted_bytes_total counter\n",
+		`backblaze_transmitted_bytes_total{host="galois",type="Normal"} 375000` + "\n",
+		`backblaze_transmitted_bytes_total{host="galois",type="Chunked"} 12500` + "\n",
+		`backblaze_transmitted_records_total{host="galois",type="Dedup"} 1` + "\n",
+		`backblaze_dedup_records_total{host="davinci"} 1` + "\n",
+		`backblaze_upload_rate_kbits{host="galois"} 2000` + "\n",
+		`backblaze_throttle{host="galois",mode="manual",level="11"} 1` + "\n",
+		`backblaze_last_transmission_timestamp_seconds{host="galois"} 1538388010` + "\n",
+		`backblaze_filelist_scan_age_seconds{host="galois"} 3600` + "\n",
+	} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("expected %q in:\n%s", expected, text)
+		}
+	}
+	// davinci has sent nothing
+	if strings.Contains(text, `backblaze_upload_rate_kbits{host="davinci"}`) {
+		t.Errorf("unexpected rate for davinci:\n%s", text)
+	}
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != 200 || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4") || rec.Body.String() != text {
+		t.Errorf("unexpected response: %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+}
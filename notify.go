@@ -0,0 +1,154 @@
+package backblaze
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Exit codes of ExitCodeNotifier, as expected by Nagios (and cron, where non zero means failure)
+const (
+	ExitOK       = 0
+	ExitCritical = 2
+)
+
+// Notifier is told about the stale checks of some hosts
+type Notifier interface {
+	Notify(reports []*StaleReport) error
+}
+
+// StdoutNotifier writes every check, stale or not, to W (e.g. os.Stdout)
+type StdoutNotifier struct {
+	W io.Writer
+}
+
+// Notify writes the checks of all reports
+func (n *StdoutNotifier) Notify(reports []*StaleReport) error {
+	for _, report := range reports {
+		if err := report.WriteText(n.W); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExitCodeNotifier sets Code to ExitCritical if any report is stale, and writes
+// a one line status to W (if not nil), in the style of a Nagios plugin
+type ExitCodeNotifier struct {
+	W    io.Writer
+	Code int
+}
+
+// Notify sets the exit code, and writes the status line
+func (n *ExitCodeNotifier) Notify(reports []*StaleReport) error {
+	stale := staleReports(reports)
+	n.Code = ExitOK
+	status := fmt.Sprintf("BACKUP OK - %d hosts", len(reports))
+	if len(stale) > 0 {
+		n.Code = ExitCritical
+		summaries := make([]string, 0, len(stale))
+		for _, report := range stale {
+			summaries = append(summaries, report.Summary())
+		}
+		status = "BACKUP CRITICAL - " + strings.Join(summaries, "; ")
+	}
+	if n.W == nil {
+		return nil
+	}
+	_, err := fmt.Fprintln(n.W, status)
+	return err
+}
+
+// SMTPNotifier mails the stale reports, if any, through the server at Addr (host:port).
+// Auth may be nil, e.g. for a local relay.
+type SMTPNotifier struct {
+	Addr string
+	Auth smtp.Auth
+	From string
+	To   []string
+}
+
+// Notify sends a single message for all the stale reports, nothing if none are stale
+func (n *SMTPNotifier) Notify(reports []*StaleReport) error {
+	stale := staleReports(reports)
+	if len(stale) == 0 {
+		return nil
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", n.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(n.To, ", "))
+	fmt.Fprintf(&msg, "Subject: Stale backup: %d of %d hosts\r\n", len(stale), len(reports))
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	for _, report := range stale {
+		fmt.Fprintln(&msg, report.Summary())
+	}
+	fmt.Fprintln(&msg)
+	for _, report := range reports {
+		report.WriteText(&msg)
+	}
+	// smtp expects CRLF line endings
+	body := strings.Replace(msg.String(), "\r\n", "\n", -1)
+	body = strings.Replace(body, "\n", "\r\n", -1)
+	if err := smtp.SendMail(n.Addr, n.Auth, n.From, n.To, []byte(body)); err != nil {
+		return fmt.Errorf("smtp notify: %v", err)
+	}
+	return nil
+}
+
+// WebhookNotifier posts the reports as json to URL, if any of them is stale:
+// {"stale":true,"summary":[...],"reports":[...]}
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client // a client with WebhookTimeout if nil
+}
+
+// WebhookTimeout bounds the post of a WebhookNotifier without a Client
+const WebhookTimeout = 10 * time.Second
+
+// Notify posts the reports, nothing if none are stale
+func (n *WebhookNotifier) Notify(reports []*StaleReport) error {
+	stale := staleReports(reports)
+	if len(stale) == 0 {
+		return nil
+	}
+	summary := make([]string, 0, len(stale))
+	for _, report := range stale {
+		summary = append(summary, report.Summary())
+	}
+	payload, err := json.Marshal(struct {
+		Stale   bool           `json:"stale"`
+		Summary []string       `json:"summary"`
+		Reports []*StaleReport `json:"reports"`
+	}{true, summary, reports})
+	if err != nil {
+		return err
+	}
+	client := n.Client
+	if client == nil {
+		client = &http.Client{Timeout: WebhookTimeout}
+	}
+	resp, err := client.Post(n.URL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("webhook notify: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook notify: %s", resp.Status)
+	}
+	return nil
+}
+
+func staleReports(reports []*StaleReport) []*StaleReport {
+	stale := make([]*StaleReport, 0)
+	for _, report := range reports {
+		if report.Stale() {
+			stale = append(stale, report)
+		}
+	}
+	return stale
+}
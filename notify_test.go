@@ -0,0 +1,155 @@
+package backblaze
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func notifySample() []*StaleReport {
+	now := time.Date(2018, 10, 2, 12, 0, 0, 0, time.UTC)
+	galois := NewStaleReport("galois", now)
+	galois.Check(TransmittedCheck, now.Add(-30*time.Hour), DefaultTransmittedMaxAge)
+	davinci := NewStaleReport("davinci", now)
+	davinci.Check(TransmittedCheck, now.Add(-time.Hour), DefaultTransmittedMaxAge)
+	return []*StaleReport{galois, davinci}
+}
+
+func TestStdoutNotifier(t *testing.T) {
+	var buf bytes.Buffer
+	if err := (&StdoutNotifier{W: &buf}).Notify(notifySample()); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 2 {
+		t.Errorf("expected a line per check, got %q", buf.String())
+	}
+}
+
+func TestExitCodeNotifier(t *testing.T) {
+	var buf bytes.Buffer
+	n := &ExitCodeNotifier{W: &buf}
+	n.Notify(notifySample())
+	if n.Code != ExitCritical {
+		t.Errorf("expected %d, got %d", ExitCritical, n.Code)
+	}
+	expected := "BACKUP CRITICAL - galois: last transmitted 30h0m0s ago (max 24h0m0s)\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+	buf.Reset()
+	n.Notify(notifySample()[1:])
+	if n.Code != ExitOK || buf.String() != "BACKUP OK - 1 hosts\n" {
+		t.Errorf("expected ok, got %d %q", n.Code, buf.String())
+	}
+}
+
+// fakeSMTP accepts a single message, and sends its DATA on the returned channel
+func fakeSMTP(t *testing.T) (addr string, data <-chan string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan string, 1)
+	go func() {
+		defer ln.Close()
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		reply("220 localhost fake")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "DATA"):
+				reply("354 go ahead")
+				var msg strings.Builder
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					msg.WriteString(line)
+				}
+				ch <- msg.String()
+				reply("250 queued")
+			case strings.HasPrefix(cmd, "QUIT"):
+				reply("221 bye")
+				return
+			default: // MAIL, RCPT, ...
+				reply("250 ok")
+			}
+		}
+	}()
+	return ln.Addr().String(), ch
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	addr, data := fakeSMTP(t)
+	n := &SMTPNotifier{Addr: addr, From: "bzcheck@example.com", To: []string{"ops@example.com"}}
+	if err := n.Notify(notifySample()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-data:
+		if !strings.Contains(msg, "Subject: Stale backup: 1 of 2 hosts\r\n") {
+			t.Errorf("unexpected subject: %q", msg)
+		}
+		if !strings.Contains(msg, "galois: last transmitted 30h0m0s ago") {
+			t.Errorf("expected the summary in the body: %q", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+	// nothing is sent when nothing is stale, so no server is needed
+	if err := (&SMTPNotifier{Addr: "127.0.0.1:1"}).Notify(notifySample()[1:]); err != nil {
+		t.Errorf("expected no message, got %v", err)
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var payload struct {
+		Stale   bool           `json:"stale"`
+		Summary []string       `json:"summary"`
+		Reports []*StaleReport `json:"reports"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Errorf("unexpected payload: %v", err)
+		}
+	}))
+	defer server.Close()
+	if err := (&WebhookNotifier{URL: server.URL}).Notify(notifySample()); err != nil {
+		t.Fatal(err)
+	}
+	if !payload.Stale || len(payload.Summary) != 1 || len(payload.Reports) != 2 || payload.Reports[0].Host != "galois" {
+		t.Errorf("unexpected payload: %+v", payload)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	if err := (&WebhookNotifier{URL: failing.URL}).Notify(notifySample()); err == nil {
+		t.Errorf("expected an error for a failing webhook")
+	}
+}
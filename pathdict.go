@@ -0,0 +1,261 @@
+package backblaze
+
+import (
+	"strings"
+	"time"
+)
+
+// PathID identifies a path interned in a PathDict
+type PathID int32
+
+// RootPath is the id of the empty path, the parent of "/" (and of relative paths)
+const RootPath PathID = 0
+
+// PathDict interns paths as a trie of their components: "/Users/daniel/notes.txt" is
+// the node "notes.txt", under "daniel/", under "Users/", under "/".
+// Paths share the nodes of their common directories, and directory names are interned too,
+// so the millions of paths under /Users/daniel/Library/Containers/... store each prefix once.
+// A parent is always interned before its children, so its id is smaller.
+type PathDict struct {
+	nodes    []pathNode
+	children map[pathKey]PathID
+	names    map[string]string
+}
+
+type pathNode struct {
+	parent PathID
+	name   string // component, with a trailing '/' for directories
+}
+
+type pathKey struct {
+	parent PathID
+	name   string
+}
+
+// NewPathDict returns a dictionary holding only the RootPath
+func NewPathDict() *PathDict {
+	return &PathDict{
+		nodes:    []pathNode{{parent: RootPath}},
+		children: make(map[pathKey]PathID),
+		names:    make(map[string]string),
+	}
+}
+
+// Intern returns the id of path, adding it (and its directories) if needed
+func (dict *PathDict) Intern(path string) PathID {
+	id := RootPath
+	for len(path) > 0 {
+		name := path
+		if i := strings.IndexByte(path, '/'); i >= 0 {
+			name = path[:i+1]
+		}
+		path = path[len(name):]
+		id = dict.child(id, name)
+	}
+	return id
+}
+
+func (dict *PathDict) child(parent PathID, name string) PathID {
+	if id, ok := dict.children[pathKey{parent, name}]; ok {
+		return id
+	}
+	// a copy, not to retain the (log) line name was sliced from;
+	// file names are seldom shared, only directory names are worth interning
+	interned := string([]byte(name))
+	if strings.HasSuffix(name, "/") {
+		if shared, ok := dict.names[name]; ok {
+			interned = shared
+		} else {
+			dict.names[interned] = interned
+		}
+	}
+	id := PathID(len(dict.nodes))
+	dict.nodes = append(dict.nodes, pathNode{parent: parent, name: interned})
+	dict.children[pathKey{parent, interned}] = id
+	return id
+}
+
+// Len is the number of nodes: interned paths and their directories, and the RootPath
+func (dict *PathDict) Len() int {
+	return len(dict.nodes)
+}
+
+// Parent returns the directory holding id, RootPath for the RootPath
+func (dict *PathDict) Parent(id PathID) PathID {
+	return dict.nodes[id].parent
+}
+
+// Name returns the last component of id, with a trailing '/' for a directory
+func (dict *PathDict) Name(id PathID) string {
+	return dict.nodes[id].name
+}
+
+// Path rebuilds the path of id
+func (dict *PathDict) Path(id PathID) string {
+	n := 0
+	for node := id; node != RootPath; node = dict.nodes[node].parent {
+		n += len(dict.nodes[node].name)
+	}
+	buf := make([]byte, n)
+	for node := id; node != RootPath; node = dict.nodes[node].parent {
+		name := dict.nodes[node].name
+		n -= len(name)
+		copy(buf[n:], name)
+	}
+	return string(buf)
+}
+
+// CompactTransmitted is a Transmitted which keeps nothing of the line it was parsed from:
+// its path is a PathID, its stamp is in seconds (of the wall clock, as logged),
+// and its class and throttle are interned
+type CompactTransmitted struct {
+	Type     txRecordType
+	Class    string
+	Throttle string
+	Stamp    int64
+	Size     int
+	Speed    int32
+	Chunk    int32
+	Level    int32
+	Path     PathID
+}
+
+// Transmissions is a compact list of records, whose paths are interned in Paths
+type Transmissions struct {
+	Paths   *PathDict
+	Records []CompactTransmitted
+
+	strs map[string]string
+}
+
+// NewTransmissions returns an empty list, with its own PathDict
+func NewTransmissions() *Transmissions {
+	return &Transmissions{Paths: NewPathDict(), Records: make([]CompactTransmitted, 0), strs: make(map[string]string)}
+}
+
+// CompactTransmissions converts records
+func CompactTransmissions(xfrs []Transmitted) *Transmissions {
+	ts := NewTransmissions()
+	ts.Records = make([]CompactTransmitted, 0, len(xfrs))
+	for _, tx := range xfrs {
+		ts.Add(tx)
+	}
+	return ts
+}
+
+// Add appends a record, a stamp which does not parse is kept as 0
+func (ts *Transmissions) Add(tx Transmitted) {
+	var stamp int64
+	if t, err := time.Parse(StampLayout, tx.Stamp); err == nil {
+		stamp = t.Unix()
+	}
+	ts.Records = append(ts.Records, CompactTransmitted{
+		Type:     tx.Type,
+		Stamp:    stamp,
+		Speed:    int32(tx.Speed),
+		Size:     tx.Size,
+		Chunk:    int32(tx.Chunk),
+		Level:    int32(tx.Level),
+		Path:     ts.Paths.Intern(tx.FName),
+		Class:    ts.intern(tx.Class),
+		Throttle: ts.intern(tx.Throttle),
+	})
+}
+
+func (ts *Transmissions) intern(s string) string {
+	interned, ok := ts.strs[s]
+	if !ok {
+		interned = string([]byte(s))
+		ts.strs[interned] = interned
+	}
+	return interned
+}
+
+// Len is the number of records
+func (ts *Transmissions) Len() int {
+	return len(ts.Records)
+}
+
+// At expands the i-th record, the units (of speed and size) are not kept
+func (ts *Transmissions) At(i int) Transmitted {
+	ct := ts.Records[i]
+	return Transmitted{
+		Type:     ct.Type,
+		Stamp:    time.Unix(ct.Stamp, 0).UTC().Format(StampLayout),
+		Speed:    int(ct.Speed),
+		Size:     ct.Size,
+		Chunk:    int(ct.Chunk),
+		FName:    ts.Paths.Path(ct.Path),
+		Class:    ct.Class,
+		Throttle: ct.Throttle,
+		Level:    int(ct.Level),
+	}
+}
+
+// Date is the date (yyyy-mm-dd) of the i-th record
+func (ts *Transmissions) Date(i int) string {
+	return time.Unix(ts.Records[i].Stamp, 0).UTC().Format("2006-01-02")
+}
+
+// SummarizeDirs totals the records in every directory (and below), as bzFlow's summary:
+// FName is the directory, Stamp the date of its first record, Size the total.
+// The totals are added up the trie, from the children (larger ids) to their parents, once per node.
+func (ts *Transmissions) SummarizeDirs() []Transmitted {
+	dict := ts.Paths
+	sizes := make([]int, dict.Len())
+	first := make([]int, dict.Len()) // index of the first record below, +1 (0 if none)
+	for i, ct := range ts.Records {
+		dir := dict.Parent(ct.Path)
+		sizes[dir] += ct.Size
+		if first[dir] == 0 {
+			first[dir] = i + 1
+		}
+	}
+	for id := PathID(dict.Len() - 1); id > RootPath; id-- {
+		if first[id] == 0 {
+			continue
+		}
+		parent := dict.Parent(id)
+		sizes[parent] += sizes[id]
+		if first[parent] == 0 || first[id] < first[parent] {
+			first[parent] = first[id]
+		}
+	}
+	list := make([]Transmitted, 0)
+	for id := PathID(1); id < PathID(dict.Len()); id++ {
+		if first[id] == 0 {
+			continue
+		}
+		list = append(list, Transmitted{FName: dict.Path(id), Stamp: ts.Date(first[id] - 1), Size: sizes[id]})
+	}
+	return list
+}
+
+// SummarizeBy is SummarizeBy for compact records: g is called once per distinct path, not per record
+func (ts *Transmissions) SummarizeBy(g Grouper) []GroupTotal {
+	slots := make([]int, ts.Paths.Len()) // index of the path's group in list, +1 (0 if not grouped yet)
+	index := make(map[string]int)
+	list := make([]*GroupTotal, 0)
+	for _, ct := range ts.Records {
+		slot := slots[ct.Path]
+		if slot == 0 {
+			key := g.Group(ts.Paths.Path(ct.Path))
+			i, ok := index[key]
+			if !ok {
+				i = len(list)
+				index[key] = i
+				list = append(list, &GroupTotal{Group: key})
+			}
+			slot = i + 1
+			slots[ct.Path] = slot
+		}
+		total := list[slot-1]
+		total.Count++
+		total.Size += ct.Size
+	}
+	totals := make(map[string]*GroupTotal, len(list))
+	for _, total := range list {
+		totals[total.Group] = total
+	}
+	return largestFirst(totals)
+}
@@ -0,0 +1,183 @@
+package backblaze
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestPathDict(t *testing.T) {
+	dict := NewPathDict()
+	paths := []string{
+		"/Users/daniel/notes.txt",
+		"/Users/daniel/Library/Caches/a.db",
+		"/Users/daniel/",
+		"/Volumes/Space/archive/x.mp3",
+		"relative/file",
+		"/",
+	}
+	ids := make([]PathID, len(paths))
+	for i, path := range paths {
+		ids[i] = dict.Intern(path)
+	}
+	for i, path := range paths {
+		if got := dict.Intern(path); got != ids[i] {
+			t.Errorf("%s: interned again as %d, expected %d", path, got, ids[i])
+		}
+		if got := dict.Path(ids[i]); got != path {
+			t.Errorf("expected %q, got %q", path, got)
+		}
+	}
+	if dict.Parent(ids[0]) != ids[2] || dict.Name(ids[0]) != "notes.txt" || dict.Name(ids[2]) != "daniel/" {
+		t.Errorf("unexpected parent of %s: %q", paths[0], dict.Path(dict.Parent(ids[0])))
+	}
+	if dict.Parent(ids[5]) != RootPath || dict.Path(RootPath) != "" {
+		t.Errorf("expected / under the root")
+	}
+	// root, /, Users/, daniel/, notes.txt, Library/, Caches/, a.db, Volumes/, Space/, archive/, x.mp3, relative/, file
+	if dict.Len() != 14 {
+		t.Errorf("expected 14 nodes, got %d", dict.Len())
+	}
+}
+
+// summarizeByParent is how bzFlow summarized, by walking up every path with its parent directory
+func summarizeByParent(xfrs []Transmitted) []Transmitted {
+	parent := func(path string) string {
+		dir, _ := filepath.Split(strings.TrimSuffix(path, "/"))
+		return dir
+	}
+	tree := make(map[string]*Transmitted)
+	for _, tx := range xfrs {
+		for dir := parent(tx.FName); len(dir) > 0; dir = parent(dir) {
+			if _, ok := tree[dir]; !ok {
+				tree[dir] = &Transmitted{FName: dir, Stamp: tx.Stamp[0:10]}
+			}
+			tree[dir].Size += tx.Size
+		}
+	}
+	list := make([]Transmitted, 0, len(tree))
+	for _, tx := range tree {
+		list = append(list, *tx)
+	}
+	return list
+}
+
+func byFName(list []Transmitted) []Transmitted {
+	sort.Slice(list, func(i, j int) bool { return list[i].FName < list[j].FName })
+	return list
+}
+
+func sampleTransmitted(t testing.TB) []Transmitted {
+	infile, err := os.Open("test/data/transmitted-sample.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer infile.Close()
+	return ParseTransmitedAll(infile)
+}
+
+func TestTransmissions(t *testing.T) {
+	xfrs := sampleTransmitted(t)
+	ts := CompactTransmissions(xfrs)
+	if ts.Len() != len(xfrs) {
+		t.Fatalf("expected %d records, got %d", len(xfrs), ts.Len())
+	}
+	for i, tx := range xfrs {
+		tx.SpeedUnit, tx.SizeUnit = "", ""
+		if got := ts.At(i); got != tx {
+			t.Errorf("expected %#v, got %#v", tx, got)
+		}
+	}
+
+	expected := byFName(summarizeByParent(xfrs))
+	got := byFName(ts.SummarizeDirs())
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected:\n%v\ngot:\n%v", expected, got)
+	}
+
+	g := DepthGrouper{Depth: 3}
+	if expected, got := SummarizeBy(xfrs, g), ts.SummarizeBy(g); !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected:\n%v\ngot:\n%v", expected, got)
+	}
+}
+
+// syntheticLines are transmitted log lines, under a few deep prefixes, as on a real host:
+// 5000 files, each sent 20 times (for n=100000)
+func syntheticLines(n int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		file := i % 5000
+		lines[i] = fmt.Sprintf("2018-10-%02d %02d:%02d:%02d -  small  - throttle manual   11 -   %4d kBits/sec - %8d bytes - "+
+			"/Users/daniel/Library/Containers/com.app%d.App/Data/Library/Application Support/cache/%d/file-%d.dat",
+			1+i%28, i%24, i%60, i%60, 100+i%900, 1000+i, file%37, file%101, file)
+	}
+	return lines
+}
+
+func parseLines(lines []string) []Transmitted {
+	return ParseTransmitedAll(strings.NewReader(strings.Join(lines, "\n")))
+}
+
+// heapPerRecord reports the live heap retained by build, per record
+func heapPerRecord(b *testing.B, n int, build func() interface{}) {
+	var before, after runtime.MemStats
+	for i := 0; i < b.N; i++ {
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		kept := build()
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		b.ReportMetric(float64(after.HeapAlloc-before.HeapAlloc)/float64(n), "heap-B/record")
+		runtime.KeepAlive(kept)
+	}
+}
+
+// each record of ParseTransmitted holds on to its whole line
+func BenchmarkMemoryTransmitted(b *testing.B) {
+	const n = 100000
+	heapPerRecord(b, n, func() interface{} { return parseLines(syntheticLines(n)) })
+}
+
+func BenchmarkMemoryCompact(b *testing.B) {
+	const n = 100000
+	heapPerRecord(b, n, func() interface{} { return CompactTransmissions(parseLines(syntheticLines(n))) })
+}
+
+func BenchmarkSummarizeByParent(b *testing.B) {
+	xfrs := parseLines(syntheticLines(100000))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		summarizeByParent(xfrs)
+	}
+}
+
+func BenchmarkSummarizeDirs(b *testing.B) {
+	ts := CompactTransmissions(parseLines(syntheticLines(100000)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ts.SummarizeDirs()
+	}
+}
+
+func BenchmarkSummarizeBy(b *testing.B) {
+	xfrs := parseLines(syntheticLines(100000))
+	g := DepthGrouper{Depth: 6}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		SummarizeBy(xfrs, g)
+	}
+}
+
+func BenchmarkSummarizeByCompact(b *testing.B) {
+	ts := CompactTransmissions(parseLines(syntheticLines(100000)))
+	g := DepthGrouper{Depth: 6}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ts.SummarizeBy(g)
+	}
+}
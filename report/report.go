@@ -0,0 +1,96 @@
+// Package report renders a self-contained html report, for a host or the fleet:
+// summary tables and inline svg charts, with the templates and stylesheet embedded in the binary.
+package report
+
+import (
+	"embed"
+	"html/template"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/daneroo/backblaze"
+)
+
+//go:embed templates
+var templates embed.FS
+
+var page = template.Must(template.New("report.html").Funcs(template.FuncMap{
+	"bytes":   backblaze.HumanBytes,
+	"size":    func(size int) string { return backblaze.HumanBytes(int64(size)) },
+	"percent": percent,
+	"columns": func(days []backblaze.GroupTotal) template.HTML { return ColumnChart(days, 720, 160) },
+	"bars":    func(totals []backblaze.GroupTotal) template.HTML { return BarChart(totals, 720) },
+	"css": func() (template.CSS, error) {
+		css, err := templates.ReadFile("templates/style.css")
+		return template.CSS(css), err
+	},
+}).ParseFS(templates, "templates/report.html"))
+
+// Page is the whole report: a section per host
+type Page struct {
+	Title     string
+	Generated time.Time
+	Since     string
+	Hosts     []Host
+}
+
+// Host is a host's section: what was uploaded since the start of the period,
+// by day and by group, the files uploaded repeatedly, and the exclusions (if any)
+type Host struct {
+	Name       string
+	Uploaded   backblaze.FileTotal
+	Daily      []backblaze.GroupTotal
+	TopDirs    []backblaze.GroupTotal
+	Churn      []backblaze.ChurnFile
+	Exclusions []backblaze.RuleCount // the rules which excluded something
+	Ignored    *backblaze.IgnoredSummary
+}
+
+// NewHost summarizes the records (sent and dedup'd, see ParseTransmitedAll) since the start of the period,
+// with the topN groups of g, and the topN files uploaded at least twice
+func NewHost(name string, records []backblaze.Transmitted, since string, g backblaze.Grouper, topN int) Host {
+	host := Host{Name: name}
+	sent := make([]backblaze.Transmitted, 0, len(records))
+	churn := backblaze.NewChurnReport(2, backblaze.DefaultSessionGap)
+	for _, tx := range records {
+		if tx.Stamp < since {
+			continue
+		}
+		churn.Add(tx)
+		if tx.Dedup() {
+			continue
+		}
+		host.Uploaded.Files++
+		host.Uploaded.Bytes += int64(tx.Size)
+		sent = append(sent, tx)
+	}
+	host.Daily = backblaze.DailySeries(sent, backblaze.DepthGrouper{Depth: 0})
+	host.TopDirs = backblaze.SummarizeBy(sent, g)
+	if len(host.TopDirs) > topN {
+		host.TopDirs = host.TopDirs[:topN]
+	}
+	churn.Rank(topN)
+	host.Churn = churn.Files
+	return host
+}
+
+// SetIgnored keeps the exclusion rules of a (ranked) IgnoredReport which excluded something, up to topN
+func (host *Host) SetIgnored(ignored *backblaze.IgnoredReport, topN int) {
+	host.Ignored = &ignored.Summary
+	host.Exclusions = make([]backblaze.RuleCount, 0)
+	for _, rule := range ignored.Rules {
+		if rule.Count > 0 && len(host.Exclusions) < topN {
+			host.Exclusions = append(host.Exclusions, rule)
+		}
+	}
+}
+
+// Write renders the page as a single html file
+func (p *Page) Write(w io.Writer) error {
+	return page.Execute(w, p)
+}
+
+func percent(ratio float64) string {
+	return strconv.FormatFloat(100*ratio, 'f', 1, 64) + "%"
+}
@@ -0,0 +1,83 @@
+package report
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daneroo/backblaze"
+)
+
+func sampleRecords(t *testing.T) []backblaze.Transmitted {
+	infile, err := os.Open("../test/data/transmitted-sample.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer infile.Close()
+	return backblaze.ParseTransmitedAll(infile)
+}
+
+func TestNewHost(t *testing.T) {
+	host := NewHost("galois", sampleRecords(t), "2018-10-02", backblaze.DepthGrouper{Depth: 2, Anchor: backblaze.VolumeAnchor}, 2)
+	if host.Uploaded.Files != 5 {
+		t.Errorf("expected 5 files uploaded since 2018-10-02, got %+v", host.Uploaded)
+	}
+	// zero filled, from 2018-10-02 to 2018-10-17
+	if len(host.Daily) != 16 || host.Daily[0].Date != "2018-10-02" {
+		t.Errorf("unexpected daily series: %+v", host.Daily)
+	}
+	if len(host.TopDirs) != 2 || host.TopDirs[0].Group != "/Volumes/Space/archive/media/" {
+		t.Errorf("unexpected top dirs: %+v", host.TopDirs)
+	}
+}
+
+func TestCharts(t *testing.T) {
+	days := []backblaze.GroupTotal{{Date: "2018-10-01", Size: 100}, {Date: "2018-10-02", Size: 0}, {Date: "2018-10-03", Size: 50}}
+	svg := string(ColumnChart(days, 300, 100))
+	if strings.Count(svg, "<rect") != 3 || !strings.Contains(svg, "2018-10-03</text>") {
+		t.Errorf("unexpected column chart: %s", svg)
+	}
+	if !strings.Contains(string(ColumnChart(nil, 300, 100)), "no uploads") {
+		t.Errorf("expected an empty chart to say so")
+	}
+	bars := string(BarChart([]backblaze.GroupTotal{{Group: "/a/<b>/", Size: 10}, {Group: "/c/", Size: 5}}, 400))
+	if strings.Count(bars, "<rect") != 2 || !strings.Contains(bars, "/a/&lt;b&gt;/") {
+		t.Errorf("unexpected (or unescaped) bar chart: %s", bars)
+	}
+	if ellipsis("/Users/daniel/Library/Containers/", 10) != "…ntainers/" {
+		t.Errorf("unexpected ellipsis: %q", ellipsis("/Users/daniel/Library/Containers/", 10))
+	}
+}
+
+func TestPageWrite(t *testing.T) {
+	galois := NewHost("galois", sampleRecords(t), "2018-10-01", backblaze.DepthGrouper{Depth: 3}, 5)
+	ignored := backblaze.NewIgnoredReport(backblaze.DefaultExclusionRules())
+	ignored.AddNotBackedUp("/Users/daniel/.Trash/big.iso", 1000)
+	ignored.Rank(5)
+	galois.SetIgnored(ignored, 5)
+	p := &Page{Title: "Backblaze weekly", Generated: time.Date(2018, 10, 20, 8, 0, 0, 0, time.UTC), Since: "2018-10-01",
+		Hosts: []Host{galois, NewHost("davinci", nil, "2018-10-01", backblaze.DepthGrouper{Depth: 3}, 5)}}
+	var buf bytes.Buffer
+	if err := p.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	html := buf.String()
+	for _, expected := range []string{
+		"<title>Backblaze weekly</title>",
+		".chart rect", // the embedded stylesheet
+		`<a href="#galois">galois</a>`,
+		`<h2 id="davinci">davinci</h2>`,
+		"<svg",
+		"1 files not backed up",
+	} {
+		if !strings.Contains(html, expected) {
+			t.Errorf("expected %q in the report", expected)
+		}
+	}
+	// self-contained
+	if strings.Contains(html, "src=") || strings.Contains(html, "http://d3js") || strings.Contains(html, `rel="stylesheet"`) {
+		t.Errorf("expected no external assets")
+	}
+}
@@ -0,0 +1,91 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+
+	"github.com/daneroo/backblaze"
+)
+
+// chart margins, for the axis labels
+const (
+	chartTop    = 16
+	chartBottom = 20
+	chartLeft   = 4
+	chartRight  = 4
+	labelWidth  = 220 // of the horizontal bar charts
+	barHeight   = 18
+	sizeWidth   = 70 // of the size, after a horizontal bar
+)
+
+// ColumnChart draws one column per day of a daily series (one group, zero filled),
+// labeled with the first and last dates, and the largest value
+func ColumnChart(days []backblaze.GroupTotal, width, height int) template.HTML {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" class="chart">`, width, height)
+	if len(days) == 0 {
+		fmt.Fprintf(&buf, `<text x="%d" y="%d">no uploads</text></svg>`, chartLeft, chartTop)
+		return template.HTML(buf.String())
+	}
+	max := 0
+	for _, d := range days {
+		if d.Size > max {
+			max = d.Size
+		}
+	}
+	plotW := float64(width - chartLeft - chartRight)
+	plotH := float64(height - chartTop - chartBottom)
+	step := plotW / float64(len(days))
+	for i, d := range days {
+		h := 0.0
+		if max > 0 {
+			h = plotH * float64(d.Size) / float64(max)
+		}
+		x := float64(chartLeft) + float64(i)*step
+		fmt.Fprintf(&buf, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f"><title>%s %s</title></rect>`,
+			x+step*0.1, float64(chartTop)+plotH-h, step*0.8, h,
+			template.HTMLEscapeString(d.Date), backblaze.HumanBytes(int64(d.Size)))
+	}
+	fmt.Fprintf(&buf, `<text x="%d" y="%d" class="max">%s</text>`, chartLeft, chartTop-4, backblaze.HumanBytes(int64(max)))
+	fmt.Fprintf(&buf, `<text x="%d" y="%d">%s</text>`, chartLeft, height-4, template.HTMLEscapeString(days[0].Date))
+	fmt.Fprintf(&buf, `<text x="%d" y="%d" text-anchor="end">%s</text>`, width-chartRight, height-4, template.HTMLEscapeString(days[len(days)-1].Date))
+	buf.WriteString(`</svg>`)
+	return template.HTML(buf.String())
+}
+
+// BarChart draws one horizontal bar per group, labeled with its name and size
+func BarChart(totals []backblaze.GroupTotal, width int) template.HTML {
+	var buf bytes.Buffer
+	height := len(totals)*barHeight + 4
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" class="chart">`, width, height)
+	max := 0
+	for _, t := range totals {
+		if t.Size > max {
+			max = t.Size
+		}
+	}
+	plotW := float64(width - labelWidth - sizeWidth)
+	for i, t := range totals {
+		w := 0.0
+		if max > 0 {
+			w = plotW * float64(t.Size) / float64(max)
+		}
+		y := i*barHeight + 2
+		fmt.Fprintf(&buf, `<text x="%d" y="%d" text-anchor="end">%s</text>`, labelWidth-4, y+barHeight-6, template.HTMLEscapeString(ellipsis(t.Group, 36)))
+		fmt.Fprintf(&buf, `<rect x="%d" y="%d" width="%.1f" height="%d"><title>%s %s</title></rect>`,
+			labelWidth, y+2, w, barHeight-4, template.HTMLEscapeString(t.Group), backblaze.HumanBytes(int64(t.Size)))
+		fmt.Fprintf(&buf, `<text x="%.1f" y="%d">%s</text>`, float64(labelWidth)+w+4, y+barHeight-6, backblaze.HumanBytes(int64(t.Size)))
+	}
+	buf.WriteString(`</svg>`)
+	return template.HTML(buf.String())
+}
+
+// ellipsis keeps the end of long paths, which is the most specific part
+func ellipsis(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return "…" + string(runes[len(runes)-n+1:])
+}
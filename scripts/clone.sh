@@ -1,4 +1,5 @@
 
+# superseded by: go run cmd/bzCollect/bzCollect.go (see inventory.txt)
 # remove -n
 # explore log rotation
 
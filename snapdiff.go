@@ -0,0 +1,538 @@
+package backblaze
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Kinds of SnapshotChange, in the order of the change log
+const (
+	SettingChange  = "setting"  // an attribute of bzinfo.xml
+	RuleChange     = "rule"     // a directory filter of bzinfo.xml, or a rule of bzexcluderules_*.xml
+	FileListChange = "filelist" // a file of the filelists
+	FileIdChange   = "fileid"   // a (path, fileid) of bzfileids.dat
+)
+
+// Ops of SnapshotChange
+const (
+	ChangeAdded    = "added"
+	ChangeRemoved  = "removed"
+	ChangeModified = "modified"
+)
+
+var changeKinds = []string{SettingChange, RuleChange, FileListChange, FileIdChange}
+
+// SnapshotChange is an entry of the change log between two snapshots of a host's bzdata
+type SnapshotChange struct {
+	Kind string `json:"kind"`
+	Op   string `json:"op"`
+	File string `json:"file,omitempty"` // for settings and rules
+	Key  string `json:"key"`            // setting, rule, or path
+	Old  string `json:"old,omitempty"`
+	New  string `json:"new,omitempty"`
+	Size int64  `json:"size,omitempty"` // of the filelist entry
+}
+
+// ChangeCount totals the changes of a kind and op
+type ChangeCount struct {
+	Kind  string `json:"kind"`
+	Op    string `json:"op"`
+	Count int    `json:"count"`
+	Bytes int64  `json:"bytes"`
+}
+
+// SnapshotDiff is the change log from the Old snapshot to the New one:
+// settings, then rules, then filelist entries, then fileids, each sorted by key.
+// The Summary counts every change, Changes holds the first MaxChanges of them (see SnapshotDiffer).
+type SnapshotDiff struct {
+	Old     string           `json:"old"`
+	New     string           `json:"new"`
+	Summary []ChangeCount    `json:"summary"`
+	Changes []SnapshotChange `json:"changes"`
+	Dropped int              `json:"dropped,omitempty"` // changes beyond MaxChanges, only counted
+	Missing []string         `json:"missing,omitempty"` // files absent from a snapshot, compared as empty
+
+	max    int
+	counts map[string]*ChangeCount // by kind and op
+}
+
+// DefaultMaxChanges is how many changes a SnapshotDiff holds, when the differ does not say
+const DefaultMaxChanges = 100000
+
+// SnapshotDiffer compares snapshots, the filelists and fileids (millions of lines) are sorted externally
+type SnapshotDiffer struct {
+	MemoryBudget int    // per sorted list, see Sorter
+	TempDir      string // for the sort runs
+	MaxChanges   int    // kept in the SnapshotDiff, the others are only counted, DefaultMaxChanges if 0
+}
+
+// Diff compares two snapshots of the same host, e.g. collected days apart
+func (d SnapshotDiffer) Diff(old, new DataSource) (*SnapshotDiff, error) {
+	diff := &SnapshotDiff{Old: old.Name(), New: new.Name(), Changes: make([]SnapshotChange, 0),
+		max: d.MaxChanges, counts: make(map[string]*ChangeCount)}
+	if diff.max == 0 {
+		diff.max = DefaultMaxChanges
+	}
+	steps := []func(old, new DataSource) error{diff.diffBzInfo, diff.diffExcludeRules, d.diffFileLists(diff), d.diffFileIds(diff)}
+	for _, step := range steps {
+		if err := step(old, new); err != nil {
+			return nil, err
+		}
+	}
+	diff.summarize()
+	return diff, nil
+}
+
+// add counts a change, and keeps it unless there are already max of them
+func (diff *SnapshotDiff) add(change SnapshotChange) {
+	key := change.Kind + "\t" + change.Op
+	count, ok := diff.counts[key]
+	if !ok {
+		count = &ChangeCount{Kind: change.Kind, Op: change.Op}
+		diff.counts[key] = count
+	}
+	count.Count++
+	count.Bytes += change.Size
+	if len(diff.Changes) >= diff.max {
+		diff.Dropped++
+		return
+	}
+	diff.Changes = append(diff.Changes, change)
+}
+
+// missing records the absent file of a snapshot, other errors are returned
+func (diff *SnapshotDiff) missing(src DataSource, err error) error {
+	var pe *fs.PathError
+	if !errors.Is(err, fs.ErrNotExist) || !errors.As(err, &pe) {
+		return err
+	}
+	diff.Missing = append(diff.Missing, src.Name()+": "+pe.Path)
+	return nil
+}
+
+func (diff *SnapshotDiff) diffBzInfo(old, new DataSource) error {
+	var infos [2]BzInfo
+	for i, src := range []DataSource{old, new} {
+		info, err := ReadBzInfo(src)
+		if err != nil {
+			if err := diff.missing(src, err); err != nil {
+				return err
+			}
+		}
+		infos[i] = info
+	}
+	diff.diffMaps(SettingChange, BzInfoFile, infos[0].Settings, infos[1].Settings)
+	diff.diffMaps(RuleChange, BzInfoFile, infos[0].DirFilters, infos[1].DirFilters)
+	return nil
+}
+
+// diffMaps adds the keys added, removed or modified from old to new, by key
+func (diff *SnapshotDiff) diffMaps(kind, file string, old, new map[string]string) {
+	keys := make([]string, 0, len(old)+len(new))
+	for key := range old {
+		keys = append(keys, key)
+	}
+	for key := range new {
+		if _, ok := old[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		o, inOld := old[key]
+		n, inNew := new[key]
+		switch {
+		case !inOld:
+			diff.add(SnapshotChange{Kind: kind, Op: ChangeAdded, File: file, Key: key, New: n})
+		case !inNew:
+			diff.add(SnapshotChange{Kind: kind, Op: ChangeRemoved, File: file, Key: key, Old: o})
+		case o != n:
+			diff.add(SnapshotChange{Kind: kind, Op: ChangeModified, File: file, Key: key, Old: o, New: n})
+		}
+	}
+}
+
+// diffExcludeRules compares the rules of each bzexcluderules_*.xml, a rule is the set of its attributes
+func (diff *SnapshotDiff) diffExcludeRules(old, new DataSource) error {
+	var rules [2]map[string]map[string]bool // file -> rule
+	files := make(map[string]bool)
+	for i, src := range []DataSource{old, new} {
+		rules[i] = make(map[string]map[string]bool)
+		names, err := ExcludeRuleFiles(src)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			parsed, err := readExcludeRules(src, name)
+			if err != nil {
+				return fmt.Errorf("%s: %s: %v", src.Name(), name, err)
+			}
+			// compressed or not, it is the same file
+			file := strings.TrimSuffix(name, path.Ext(name))
+			if path.Ext(name) == ".xml" {
+				file = name
+			}
+			rules[i][file] = make(map[string]bool, len(parsed))
+			for _, rule := range parsed {
+				rules[i][file][rule] = true
+			}
+			files[file] = true
+		}
+	}
+	for _, file := range sortedKeys(files) {
+		for _, rule := range sortedKeys(rules[0][file]) {
+			if !rules[1][file][rule] {
+				diff.add(SnapshotChange{Kind: RuleChange, Op: ChangeRemoved, File: file, Key: rule})
+			}
+		}
+		for _, rule := range sortedKeys(rules[1][file]) {
+			if !rules[0][file][rule] {
+				diff.add(SnapshotChange{Kind: RuleChange, Op: ChangeAdded, File: file, Key: rule})
+			}
+		}
+	}
+	return nil
+}
+
+func readExcludeRules(src DataSource, name string) ([]string, error) {
+	infile, err := src.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer infile.Close()
+	return ParseExcludeRules(infile)
+}
+
+// diffFileLists compares the files of all the filelists, by path: a path listed more than once
+// (in several filelists, or twice in one) is compared once, as the sorted lines are unique by path (see Sorter)
+func (d SnapshotDiffer) diffFileLists(diff *SnapshotDiff) func(old, new DataSource) error {
+	return func(old, new DataSource) error {
+		sorted, err := d.sortBoth(old, new, func(src DataSource, sorter *Sorter) error {
+			files, err := FileLists(src)
+			if err != nil {
+				return err
+			}
+			var addErr error
+			for _, file := range files {
+				_, err := ReadFileList(src, file, func(entry FileListEntry) {
+					if addErr == nil {
+						addErr = sorter.Add(entry.SortLine())
+					}
+				})
+				if err != nil {
+					return fmt.Errorf("%s: %s: %v", src.Name(), file, err)
+				}
+			}
+			return addErr
+		})
+		if err != nil {
+			return err
+		}
+		defer sorted[0].Close()
+		defer sorted[1].Close()
+		return MergeDiff(sorted[0], sorted[1], func(side DiffSide, a, b string) {
+			switch side {
+			case OnlyInA:
+				path, size := ParseSortLine(a)
+				diff.add(SnapshotChange{Kind: FileListChange, Op: ChangeRemoved, Key: path, Size: size})
+			case OnlyInB:
+				path, size := ParseSortLine(b)
+				diff.add(SnapshotChange{Kind: FileListChange, Op: ChangeAdded, Key: path, Size: size})
+			}
+		})
+	}
+}
+
+// fileIdSep separates the path and fileid of a sorted line, it sorts before any character of a path,
+// so the fileids of a path are together, and there is no tab: the line is the key (see KeyOf)
+const fileIdSep = "\x00"
+
+// diffFileIds compares the fileids of each path (a path has one per version):
+// a path with a new fileid in place of an old one was uploaded again (modified)
+func (d SnapshotDiffer) diffFileIds(diff *SnapshotDiff) func(old, new DataSource) error {
+	return func(old, new DataSource) error {
+		sorted, err := d.sortBoth(old, new, func(src DataSource, sorter *Sorter) error {
+			var addErr error
+			_, err := ReadFileIds(src, func(id, path string) {
+				if addErr == nil {
+					addErr = sorter.Add(path + fileIdSep + id)
+				}
+			})
+			if err != nil {
+				return diff.missing(src, err)
+			}
+			return addErr
+		})
+		if err != nil {
+			return err
+		}
+		defer sorted[0].Close()
+		defer sorted[1].Close()
+		// the fileids of the current path, only in the old or new snapshot, paired when it changes
+		var path string
+		var removed, added []string
+		flush := func() {
+			for len(removed) > 0 && len(added) > 0 {
+				diff.add(SnapshotChange{Kind: FileIdChange, Op: ChangeModified, Key: path, Old: removed[0], New: added[0]})
+				removed, added = removed[1:], added[1:]
+			}
+			for _, id := range removed {
+				diff.add(SnapshotChange{Kind: FileIdChange, Op: ChangeRemoved, Key: path, Old: id})
+			}
+			for _, id := range added {
+				diff.add(SnapshotChange{Kind: FileIdChange, Op: ChangeAdded, Key: path, New: id})
+			}
+			removed, added = removed[:0], added[:0]
+		}
+		err = MergeDiff(sorted[0], sorted[1], func(side DiffSide, a, b string) {
+			line := a
+			if side == OnlyInB {
+				line = b
+			}
+			i := strings.Index(line, fileIdSep)
+			if line[:i] != path {
+				flush()
+				path = line[:i]
+			}
+			switch side {
+			case OnlyInA:
+				removed = append(removed, line[i+len(fileIdSep):])
+			case OnlyInB:
+				added = append(added, line[i+len(fileIdSep):])
+			}
+		})
+		flush()
+		return err
+	}
+}
+
+// sortBoth feeds each snapshot to its own Sorter
+func (d SnapshotDiffer) sortBoth(old, new DataSource, feed func(src DataSource, sorter *Sorter) error) ([2]*SortedLines, error) {
+	var sorted [2]*SortedLines
+	for i, src := range []DataSource{old, new} {
+		sorter := NewSorter(d.MemoryBudget, d.TempDir)
+		err := feed(src, sorter)
+		if err == nil {
+			sorted[i], err = sorter.Sort()
+		}
+		if err != nil {
+			if i == 1 {
+				sorted[0].Close()
+			}
+			return sorted, err
+		}
+	}
+	return sorted, nil
+}
+
+func (diff *SnapshotDiff) summarize() {
+	diff.Summary = make([]ChangeCount, 0)
+	for _, kind := range changeKinds {
+		for _, op := range []string{ChangeAdded, ChangeRemoved, ChangeModified} {
+			if count, ok := diff.counts[kind+"\t"+op]; ok {
+				diff.Summary = append(diff.Summary, *count)
+			}
+		}
+	}
+}
+
+// Empty reports whether the snapshots are the same
+func (diff *SnapshotDiff) Empty() bool {
+	return len(diff.Changes) == 0 && diff.Dropped == 0
+}
+
+// BzInfo is what bzinfo.xml holds: its settings, and its directory filters.
+// Settings are keyed by the path of their element and attribute, e.g. bzinfo/throttle@level,
+// elements told apart by an identifying attribute (uuid) carry it, e.g. bzinfo/bzvolumes/bzvolume[uuid=...]@mount_point.
+type BzInfo struct {
+	Settings   map[string]string
+	DirFilters map[string]string // dir -> whattodo (include or exclude)
+}
+
+// ParseBzInfo returns the settings and directory filters of bzinfo.xml (see ParseBzInfoExclusions)
+func ParseBzInfo(r io.Reader) (BzInfo, error) {
+	info := BzInfo{Settings: make(map[string]string), DirFilters: make(map[string]string)}
+	rc, err := Decompress(r)
+	if err != nil {
+		return info, err
+	}
+	defer rc.Close()
+	dec := xml.NewDecoder(rc)
+	elements := make([]string, 0)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return info, nil
+		}
+		if err != nil {
+			return info, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			attrs := make(map[string]string, len(tok.Attr))
+			for _, attr := range tok.Attr {
+				attrs[attr.Name.Local] = attr.Value
+			}
+			name := tok.Name.Local
+			if name == "bzdirfilter" {
+				info.DirFilters[attrs["dir"]] = attrs["whattodo"]
+			}
+			if uuid, ok := attrs["uuid"]; ok {
+				name += "[uuid=" + uuid + "]"
+			}
+			elements = append(elements, name)
+			if tok.Name.Local == "bzdirfilter" || len(elements) == 1 {
+				continue // the filters are rules, the root has no settings
+			}
+			element := path.Join(elements[1:]...)
+			for attr, value := range attrs {
+				if attr != "uuid" {
+					info.Settings[element+"@"+attr] = value
+				}
+			}
+		case xml.EndElement:
+			elements = elements[:len(elements)-1]
+		}
+	}
+}
+
+// ReadBzInfo parses the bzinfo.xml of src (see ParseBzInfo)
+func ReadBzInfo(src DataSource) (BzInfo, error) {
+	name, err := findInput(src, BzInfoFile)
+	if err != nil {
+		return BzInfo{}, err
+	}
+	infile, err := src.Open(name)
+	if err != nil {
+		return BzInfo{}, err
+	}
+	defer infile.Close()
+	return ParseBzInfo(infile)
+}
+
+/*
+ParseExcludeRules returns the rules of bzexcluderules_mandatory.xml or bzexcluderules_editable.xml,
+each as its attributes, sorted, e.g.:
+
+	<excludefname_rule plat="mac" osVers="*" ruleIsOptional="f" skipFirstCharThenStartsWith="users/" contains_1="/itunes/" ... />
+
+is: contains_1="/itunes/" osVers="*" plat="mac" ruleIsOptional="f" skipFirstCharThenStartsWith="users/" ...
+*/
+func ParseExcludeRules(r io.Reader) ([]string, error) {
+	rc, err := Decompress(r)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	rules := make([]string, 0)
+	dec := xml.NewDecoder(rc)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return rules, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok || se.Name.Local != "excludefname_rule" {
+			continue
+		}
+		attrs := make([]string, 0, len(se.Attr))
+		for _, attr := range se.Attr {
+			attrs = append(attrs, attr.Name.Local+"="+strconv.Quote(attr.Value))
+		}
+		sort.Strings(attrs)
+		rules = append(rules, strings.Join(attrs, " "))
+	}
+}
+
+// WriteFormat writes the change log in one of the Format* formats
+func (diff *SnapshotDiff) WriteFormat(w io.Writer, format string) error {
+	switch format {
+	case FormatText:
+		return diff.WriteText(w)
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(diff)
+	case FormatJSONL:
+		return diff.WriteJSONL(w)
+	case FormatCSV:
+		return diff.WriteCSV(w)
+	}
+	return fmt.Errorf("unknown format: %q", format)
+}
+
+// WriteJSONL writes one line per change
+func (diff *SnapshotDiff) WriteJSONL(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, c := range diff.Changes {
+		if err := enc.Encode(c); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// WriteCSV writes one row per change, with a header: kind,op,file,key,old,new,size
+func (diff *SnapshotDiff) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"kind", "op", "file", "key", "old", "new", "size"})
+	for _, c := range diff.Changes {
+		cw.Write([]string{c.Kind, c.Op, c.File, c.Key, c.Old, c.New, strconv.FormatInt(c.Size, 10)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteText writes the summary, then the change log, one line per change
+func (diff *SnapshotDiff) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "SnapDiff: %s -> %s\n", diff.Old, diff.New)
+	for _, missing := range diff.Missing {
+		fmt.Fprintf(bw, "SnapDiff: missing %s\n", missing)
+	}
+	if diff.Empty() {
+		fmt.Fprintf(bw, "SnapDiff: no changes\n")
+	}
+	for _, count := range diff.Summary {
+		fmt.Fprintf(bw, "SnapDiff: %-8s %-8s %9d", count.Kind, count.Op, count.Count)
+		if count.Kind == FileListChange {
+			fmt.Fprintf(bw, " %10s", HumanBytes(count.Bytes))
+		}
+		fmt.Fprintln(bw)
+	}
+	sign := map[string]string{ChangeAdded: "+", ChangeRemoved: "-", ChangeModified: "~"}
+	for _, c := range diff.Changes {
+		fmt.Fprintf(bw, "%s %-8s ", sign[c.Op], c.Kind)
+		if len(c.File) != 0 {
+			fmt.Fprintf(bw, "%s: ", c.File)
+		}
+		fmt.Fprint(bw, c.Key)
+		switch {
+		case c.Kind == FileListChange:
+			fmt.Fprintf(bw, " (%s)", HumanBytes(c.Size))
+		case c.Op == ChangeModified:
+			fmt.Fprintf(bw, ": %s -> %s", c.Old, c.New)
+		case len(c.Old)+len(c.New) != 0:
+			fmt.Fprintf(bw, ": %s%s", c.Old, c.New)
+		}
+		fmt.Fprintln(bw)
+	}
+	if diff.Dropped > 0 {
+		fmt.Fprintf(bw, "SnapDiff: %d more changes not listed\n", diff.Dropped)
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,192 @@
+package backblaze
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const editableRules = `<?xml version="1.0" encoding="UTF-8"?>
+<excludefname_rules>
+  <excludefname_rule plat="mac" osVers="*" ruleIsOptional="f" skipFirstCharThenStartsWith="users/" contains_1="/itunes/" contains_2="*" doesNotContain="*" endsWith="*" hasFileExtension="ipsw" />
+  <excludefname_rule plat="mac" osVers="*" ruleIsOptional="t" skipFirstCharThenStartsWith="*" contains_1="*" contains_2="*" doesNotContain="*" endsWith="*" hasFileExtension="vmdk" />
+</excludefname_rules>
+`
+
+// snapshots are the test bzdata, and the same a few days later
+func snapshots(t *testing.T) (DataSource, DataSource) {
+	read := func(name string) []byte {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	const (
+		root  = "bzfilelists/v0009a98724006e621c1646e011f_root_filelist.dat"
+		space = "bzfilelists/v0009b11111111111111111111111_Space_filelist.dat"
+	)
+	old := fstest.MapFS{
+		BzInfoFile:                    {Data: read("test/data/bzdata/bzinfo.xml")},
+		"bzexcluderules_editable.xml": {Data: []byte(editableRules)},
+		FileIdsFile:                   {Data: read("test/data/bzdata/bzbackup/bzfileids.dat")},
+		root:                          {Data: read("test/data/bzdata/" + root)},
+		space:                         {Data: read("test/data/bzdata/" + space)},
+	}
+
+	replace := func(data []byte, pairs ...string) []byte {
+		return []byte(strings.NewReplacer(pairs...).Replace(string(data)))
+	}
+	new := fstest.MapFS{
+		// throttled, the VMs included again, and /Volumes/Space remounted
+		BzInfoFile: {Data: replace(old[BzInfoFile].Data,
+			`level="11"`, `level="5"`,
+			`<bzdirfilter dir="/users/daniel/vms/" whattodo="exclude" />`, `<bzdirfilter dir="/users/daniel/vms/" whattodo="include" />
+  <bzdirfilter dir="/users/daniel/downloads/" whattodo="exclude" />`,
+			`bzdirfilter_count="3"`, `bzdirfilter_count="4"`,
+			`mount_point="/Volumes/Space"`, `mount_point="/Volumes/Space 1"`)},
+		// the vmdk rule is gone, the ipsw one is unchanged, with its attributes in another order
+		"bzexcluderules_editable.xml": {Data: []byte(`<excludefname_rules>
+  <excludefname_rule osVers="*" plat="mac" ruleIsOptional="f" skipFirstCharThenStartsWith="users/" contains_1="/itunes/" contains_2="*" doesNotContain="*" endsWith="*" hasFileExtension="ipsw" />
+</excludefname_rules>`)},
+		// deleted.txt is gone, .bash_profile uploaded again
+		FileIdsFile: {Data: replace(old[FileIdsFile].Data, "00a3\t/Users/daniel/Documents/deleted.txt\n", "", "00a6\t", "00b1\t")},
+		// scratch is gone, and a new file
+		root: {Data: replace(old[root].Data, "f\t1539000000000\t52000\t/Users/daniel/Downloads/notes.txt\n",
+			"f\t1539000000000\t52000\t/Users/daniel/Downloads/notes.txt\nf\t1539100000000\t2048\t/Users/daniel/Downloads/todo.txt\n")},
+		space: {Data: replace(old[space].Data, "f\t1539000000000\t1000\t/Volumes/Space/scratch/tmp.bin\n", "")},
+	}
+	return NewSource("before", old), NewSource("after", new)
+}
+
+func TestSnapshotDiff(t *testing.T) {
+	old, new := snapshots(t)
+	diff, err := SnapshotDiffer{}.Diff(old, new)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vmdk := `contains_1="*" contains_2="*" doesNotContain="*" endsWith="*" hasFileExtension="vmdk" osVers="*" plat="mac" ruleIsOptional="t" skipFirstCharThenStartsWith="*"`
+	expected := []SnapshotChange{
+		{Kind: SettingChange, Op: ChangeModified, File: BzInfoFile, Key: "bzinfo/bzvolumes/bzvolume[uuid=b11111111111111111111111]@mount_point", Old: "/Volumes/Space", New: "/Volumes/Space 1"},
+		{Kind: SettingChange, Op: ChangeModified, File: BzInfoFile, Key: "bzinfo/do_backup@bzdirfilter_count", Old: "3", New: "4"},
+		{Kind: SettingChange, Op: ChangeModified, File: BzInfoFile, Key: "bzinfo/throttle@level", Old: "11", New: "5"},
+		{Kind: RuleChange, Op: ChangeAdded, File: BzInfoFile, Key: "/users/daniel/downloads/", New: "exclude"},
+		{Kind: RuleChange, Op: ChangeModified, File: BzInfoFile, Key: "/users/daniel/vms/", Old: "exclude", New: "include"},
+		{Kind: RuleChange, Op: ChangeRemoved, File: "bzexcluderules_editable.xml", Key: vmdk},
+		{Kind: FileListChange, Op: ChangeAdded, Key: "/Users/daniel/Downloads/todo.txt", Size: 2048},
+		{Kind: FileListChange, Op: ChangeRemoved, Key: "/Volumes/Space/scratch/tmp.bin", Size: 1000},
+		{Kind: FileIdChange, Op: ChangeModified, Key: "/Users/daniel/.bash_profile", Old: "00a6", New: "00b1"},
+		{Kind: FileIdChange, Op: ChangeRemoved, Key: "/Users/daniel/Documents/deleted.txt", Old: "00a3"},
+	}
+	if !reflect.DeepEqual(expected, diff.Changes) {
+		for _, c := range diff.Changes {
+			t.Logf("%+v", c)
+		}
+		t.Fatalf("unexpected changes")
+	}
+	if len(diff.Summary) != 8 || diff.Summary[4] != (ChangeCount{Kind: FileListChange, Op: ChangeAdded, Count: 1, Bytes: 2048}) {
+		t.Errorf("unexpected summary: %+v", diff.Summary)
+	}
+
+	// only the first changes are kept, all are counted
+	capped, err := SnapshotDiffer{MaxChanges: 2}.Diff(old, new)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(capped.Changes) != 2 || capped.Dropped != len(expected)-2 || !reflect.DeepEqual(capped.Summary, diff.Summary) {
+		t.Errorf("expected 2 changes, %d dropped, got %d, %d, %+v", len(expected)-2, len(capped.Changes), capped.Dropped, capped.Summary)
+	}
+
+	// a snapshot against itself
+	same, err := SnapshotDiffer{}.Diff(old, old)
+	if err != nil || !same.Empty() {
+		t.Errorf("expected no changes, got %v (%v)", same.Changes, err)
+	}
+	// missing files are compared as empty
+	empty := NewSource("empty", fstest.MapFS{})
+	diff, err = SnapshotDiffer{}.Diff(empty, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Missing) != 2 || len(diff.Changes) == 0 || diff.Changes[0].Op != ChangeAdded {
+		t.Errorf("unexpected missing: %v, changes: %d", diff.Missing, len(diff.Changes))
+	}
+}
+
+func TestSnapshotDiffDuplicatePaths(t *testing.T) {
+	// a path listed in two filelists of the old snapshot, in one of the new: it is neither removed nor added
+	line := "f\t1539000000000\t2048\t/Users/daniel/Downloads/twice.txt\n"
+	old := fstest.MapFS{
+		"bzfilelists/v0009a_root_filelist.dat":  {Data: []byte(line + line)},
+		"bzfilelists/v0009b_Space_filelist.dat": {Data: []byte(line)},
+	}
+	new := fstest.MapFS{
+		"bzfilelists/v0009a_root_filelist.dat": {Data: []byte(line)},
+	}
+	// spilled runs of one line each
+	diff, err := SnapshotDiffer{MemoryBudget: 1, TempDir: t.TempDir()}.Diff(NewSource("before", old), NewSource("after", new))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Changes) != 0 {
+		t.Errorf("expected no changes, got %+v", diff.Changes)
+	}
+	// and removed once
+	diff, err = SnapshotDiffer{MemoryBudget: 1, TempDir: t.TempDir()}.Diff(NewSource("before", old), NewSource("empty", fstest.MapFS{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Changes) != 1 || diff.Changes[0].Op != ChangeRemoved {
+		t.Errorf("expected one removal, got %+v", diff.Changes)
+	}
+}
+
+func TestSnapshotDiffWriteFormat(t *testing.T) {
+	old, new := snapshots(t)
+	diff, err := SnapshotDiffer{}.Diff(old, new)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := diff.WriteFormat(&buf, FormatText); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"SnapDiff: before -> after\n",
+		"~ setting  bzinfo.xml: bzinfo/throttle@level: 11 -> 5\n",
+		"+ filelist /Users/daniel/Downloads/todo.txt (2.00 KiB)\n",
+		"- fileid   /Users/daniel/Documents/deleted.txt: 00a3\n",
+	} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("expected %q in:\n%s", line, buf.String())
+		}
+	}
+
+	buf.Reset()
+	if err := diff.WriteFormat(&buf, FormatJSONL); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(diff.Changes) {
+		t.Fatalf("expected %d lines, got %d", len(diff.Changes), len(lines))
+	}
+	var change SnapshotChange
+	if err := json.Unmarshal([]byte(lines[0]), &change); err != nil || change != diff.Changes[0] {
+		t.Errorf("expected %+v, got %+v (%v)", diff.Changes[0], change, err)
+	}
+
+	buf.Reset()
+	if err := diff.WriteFormat(&buf, FormatCSV); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "kind,op,file,key,old,new,size\n") {
+		t.Errorf("unexpected csv header: %q", buf.String())
+	}
+	if err := diff.WriteFormat(&buf, "xml"); err == nil {
+		t.Errorf("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,204 @@
+package backblaze
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The files of a bzdata snapshot, relative to its root.
+// Each may also be compressed (see GlobInputs).
+const (
+	LiveBzData             = "/Library/Backblaze.bzpkg/bzdata"
+	BzInfoFile             = "bzinfo.xml"
+	FileIdsFile            = "bzbackup/bzfileids.dat"
+	FileListsPattern       = "bzfilelists/v*filelist.dat"
+	TransmittedLogsPattern = "bzlogs/bzreports_lastfilestransmitted/*.log"
+	EventLogsPattern       = "bzlogs/bzreports_eventlog/*.log"
+	ExcludeRulesPattern    = "bzexcluderules_*.xml"
+)
+
+// SnapshotExts are the archives of a bzdata directory HostSource looks for, when the directory is missing
+var SnapshotExts = []string{".tar", ".tgz", ".tar.gz", ".tar.zst", ".tar.bz2"}
+
+// DataSource is a bzdata snapshot: the live one, a copy collected by bzCollect,
+// a tar archive of one, or an in-memory fs for tests.
+// Names are relative to the snapshot's root, e.g. FileIdsFile.
+type DataSource interface {
+	fs.FS
+	// Name describes the source in messages, e.g. its path
+	Name() string
+	Close() error
+}
+
+type source struct {
+	fs.FS
+	name   string
+	closer io.Closer
+}
+
+func (s source) Name() string { return s.name }
+func (s source) Close() error { return s.closer.Close() }
+
+// NewSource is the snapshot in fsys, e.g. a fstest.MapFS, closing it does nothing
+func NewSource(name string, fsys fs.FS) DataSource {
+	return source{FS: fsys, name: name, closer: noClose{}}
+}
+
+// OpenSource opens the snapshot at path, a directory or an archive (see OpenBzData)
+func OpenSource(path string) (DataSource, error) {
+	fsys, closer, err := OpenBzData(path)
+	if err != nil {
+		return nil, err
+	}
+	return source{FS: fsys, name: path, closer: closer}, nil
+}
+
+// LiveSource opens the snapshot of the Backblaze client running on this host
+func LiveSource() (DataSource, error) {
+	return OpenSource(LiveBzData)
+}
+
+// HostSource opens the snapshot of host collected into dataDir, as <host>/bzdata,
+// or as an archive of it (e.g. <host>/bzdata.tgz, see SnapshotExts)
+func HostSource(dataDir, host string) (DataSource, error) {
+	dir := filepath.Join(dataDir, host, "bzdata")
+	src, err := OpenSource(dir)
+	if !os.IsNotExist(err) {
+		return src, err
+	}
+	for _, ext := range SnapshotExts {
+		if _, serr := os.Stat(dir + ext); serr == nil {
+			return OpenSource(dir + ext)
+		}
+	}
+	return nil, err
+}
+
+// TransmittedLogs returns the transmitted logs of src, compressed ones included
+func TransmittedLogs(src DataSource) ([]string, error) {
+	return GlobInputs(src, TransmittedLogsPattern)
+}
+
+// EventLogs returns the event logs of src, compressed ones included
+func EventLogs(src DataSource) ([]string, error) {
+	return GlobInputs(src, EventLogsPattern)
+}
+
+// FileLists returns the filelists of src, compressed ones included
+func FileLists(src DataSource) ([]string, error) {
+	return GlobInputs(src, FileListsPattern)
+}
+
+// ExcludeRuleFiles returns the exclusion rules (mandatory and editable) of src, compressed ones included
+func ExcludeRuleFiles(src DataSource) ([]string, error) {
+	return GlobInputs(src, ExcludeRulesPattern)
+}
+
+// FileIds returns the name of the fileids of src, which may be compressed
+func FileIds(src DataSource) (string, error) {
+	return findInput(src, FileIdsFile)
+}
+
+// findInput returns name, or its compressed version
+func findInput(src DataSource, name string) (string, error) {
+	if _, err := fs.Stat(src, name); err == nil {
+		return name, nil
+	}
+	names, err := GlobInputs(src, name)
+	if err != nil {
+		return "", err
+	}
+	if len(names) == 0 {
+		return "", &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return names[0], nil
+}
+
+// ReadFileList parses the filelist name of src (see ParseFileList)
+func ReadFileList(src DataSource, name string, fn func(FileListEntry)) (skipped int, err error) {
+	infile, err := src.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer infile.Close()
+	return ParseFileList(infile, fn)
+}
+
+// ReadFileIds parses the fileids of src (see ParseFileIds)
+func ReadFileIds(src DataSource, fn func(id, path string)) (skipped int, err error) {
+	name, err := FileIds(src)
+	if err != nil {
+		return 0, err
+	}
+	infile, err := src.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer infile.Close()
+	return ParseFileIds(infile, fn)
+}
+
+// ReadBzInfoExclusions parses the excluded directories of src's bzinfo.xml (see ParseBzInfoExclusions)
+func ReadBzInfoExclusions(src DataSource) (ExclusionRules, error) {
+	name, err := findInput(src, BzInfoFile)
+	if err != nil {
+		return nil, err
+	}
+	infile, err := src.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer infile.Close()
+	return ParseBzInfoExclusions(infile)
+}
+
+// ReadExclusionRules returns our default rules, and the directories excluded in src's bzinfo.xml, if it has one
+func ReadExclusionRules(src DataSource) (ExclusionRules, error) {
+	rules := DefaultExclusionRules()
+	dirs, err := ReadBzInfoExclusions(src)
+	if errors.Is(err, fs.ErrNotExist) {
+		return rules, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(rules, dirs...), nil
+}
+
+// CollectedHosts returns the hosts collected into dataDir (see HostSource), sorted
+func CollectedHosts(dataDir string) ([]string, error) {
+	set := make(map[string]bool)
+	for _, ext := range append([]string{""}, SnapshotExts...) {
+		snapshots, err := filepath.Glob(filepath.Join(dataDir, "*", "bzdata"+ext))
+		if err != nil {
+			return nil, err
+		}
+		for _, snapshot := range snapshots {
+			set[filepath.Base(filepath.Dir(snapshot))] = true
+		}
+	}
+	return sortedKeys(set), nil
+}
+
+// HostOf names the host of a bzdata directory: <host> for one collected as ./data/<host>/bzdata
+// (or archived as <host>/bzdata.tgz, see SnapshotExts), or this host, for the live one
+func HostOf(dir string) string {
+	dir = filepath.Clean(dir)
+	parent := filepath.Base(filepath.Dir(dir))
+	base := filepath.Base(dir)
+	for _, ext := range SnapshotExts {
+		base = strings.TrimSuffix(base, ext)
+	}
+	if base == "bzdata" && parent != "Backblaze.bzpkg" && parent != "." && parent != "/" {
+		return parent
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		return dir
+	}
+	return host
+}
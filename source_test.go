@@ -0,0 +1,152 @@
+package backblaze
+
+import (
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+// memSource is the test bzdata, with the sample log, also bzip2 compressed, in memory
+func memSource(t *testing.T) DataSource {
+	read := func(name string) *fstest.MapFile {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &fstest.MapFile{Data: data}
+	}
+	return NewSource("memory", fstest.MapFS{
+		BzInfoFile:  read("test/data/bzdata/bzinfo.xml"),
+		FileIdsFile: read("test/data/bzdata/bzbackup/bzfileids.dat"),
+		"bzfilelists/v0009a98724006e621c1646e011f_root_filelist.dat":   read("test/data/bzdata/bzfilelists/v0009a98724006e621c1646e011f_root_filelist.dat"),
+		"bzfilelists/v0009b11111111111111111111111_Space_filelist.dat": read("test/data/bzdata/bzfilelists/v0009b11111111111111111111111_Space_filelist.dat"),
+		"bzlogs/bzreports_lastfilestransmitted/17.log":                 read("test/data/transmitted-sample.log"),
+		"bzlogs/bzreports_lastfilestransmitted/18.log.bz2":             read("test/data/transmitted-sample.log.bz2"),
+	})
+}
+
+func TestDataSource(t *testing.T) {
+	src := memSource(t)
+	defer src.Close()
+
+	logs, err := TransmittedLogs(src)
+	if expected := []string{"bzlogs/bzreports_lastfilestransmitted/17.log", "bzlogs/bzreports_lastfilestransmitted/18.log.bz2"}; err != nil || !reflect.DeepEqual(expected, logs) {
+		t.Errorf("expected %v, got %v (%v)", expected, logs, err)
+	}
+	ingested := (&Ingester{FS: src, KeepDedup: true}).Ingest(logs)
+	if len(ingested.Errors) != 0 || len(ingested.Records) != 2*len(sampleTransmitted(t)) {
+		t.Errorf("unexpected ingest: %d records, errors: %v", len(ingested.Records), ingested.Errors)
+	}
+	if fromSrc, err := (&Ingester{KeepDedup: true}).IngestSource(src); err != nil || !reflect.DeepEqual(fromSrc, ingested) {
+		t.Errorf("expected IngestSource to ingest the same, got %d records (%v)", len(fromSrc.Records), err)
+	}
+	if none, err := (&Ingester{}).IngestBzData("test/data/bzdata"); err != nil || len(none.Records) != 0 {
+		t.Errorf("expected no transmitted logs in test/data/bzdata, got %d records (%v)", len(none.Records), err)
+	}
+	if _, err := (&Ingester{}).IngestBzData("test/data/nosuchdir"); err == nil {
+		t.Errorf("expected an error for a missing bzdata")
+	}
+
+	lists, err := FileLists(src)
+	if err != nil || len(lists) != 2 {
+		t.Fatalf("expected 2 filelists, got %v (%v)", lists, err)
+	}
+	entries := 0
+	if _, err := ReadFileList(src, lists[0], func(FileListEntry) { entries++ }); err != nil || entries == 0 {
+		t.Errorf("expected entries in %s, got %d (%v)", lists[0], entries, err)
+	}
+
+	paths := 0
+	if _, err := ReadFileIds(src, func(id, path string) { paths++ }); err != nil || paths != 6 {
+		t.Errorf("expected 6 fileids, got %d (%v)", paths, err)
+	}
+	rules, err := ReadBzInfoExclusions(src)
+	if err != nil || len(rules) != 2 {
+		t.Errorf("expected 2 excluded directories, got %v (%v)", rules, err)
+	}
+
+	if all, err := ReadExclusionRules(src); err != nil || len(all) != len(DefaultExclusionRules())+2 {
+		t.Errorf("expected the default rules and 2 excluded directories, got %d (%v)", len(all), err)
+	}
+
+	empty := NewSource("empty", fstest.MapFS{})
+	if _, err := ReadBzInfoExclusions(empty); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected a not exist error, got %v", err)
+	}
+	if all, err := ReadExclusionRules(empty); err != nil || len(all) != len(DefaultExclusionRules()) {
+		t.Errorf("expected the default rules without bzinfo.xml, got %d (%v)", len(all), err)
+	}
+	if _, err := ReadFileIds(empty, func(id, path string) {}); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected a not exist error, got %v", err)
+	}
+}
+
+func TestHostSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// galois is collected as a directory, davinci as an archive
+	if err := os.MkdirAll(filepath.Join(dir, "galois", "bzdata", "bzbackup"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile("test/data/bzdata/bzbackup/bzfileids.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "galois", "bzdata", FileIdsFile), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "davinci"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeSnapshot(t, filepath.Join(dir, "davinci"), "bzdata.tgz", true)
+
+	for _, host := range []string{"galois", "davinci"} {
+		src, err := HostSource(dir, host)
+		if err != nil {
+			t.Fatalf("%s: %v", host, err)
+		}
+		paths := 0
+		if _, err := ReadFileIds(src, func(id, path string) { paths++ }); err != nil || paths != 6 {
+			t.Errorf("%s: expected 6 fileids, got %d (%v)", host, paths, err)
+		}
+		src.Close()
+	}
+	if _, err := HostSource(dir, "missing"); !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error, got %v", err)
+	}
+	if hosts, err := CollectedHosts(dir); err != nil || !reflect.DeepEqual(hosts, []string{"davinci", "galois"}) {
+		t.Errorf("expected davinci and galois, got %v (%v)", hosts, err)
+	}
+}
+
+func TestHostOf(t *testing.T) {
+	local, err := os.Hostname()
+	if err != nil {
+		t.Skip(err)
+	}
+	var data = []struct {
+		dir  string
+		host string
+	}{
+		{"./data/galois/bzdata", "galois"},
+		{"data/davinci/bzdata/", "davinci"},
+		{"data/euler/bzdata.tar.zst", "euler"},
+		{LiveBzData, local},
+		{"bzdata", local},
+		{"./data/galois", local},
+	}
+	for _, tt := range data {
+		if got := HostOf(tt.dir); got != tt.host {
+			t.Errorf("HostOf(%q): expected %q, got %q", tt.dir, tt.host, got)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package backblaze
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Names of the checks in a StaleReport
+const (
+	TransmittedCheck = "transmitted" // time since the last transmission
+	FilelistCheck    = "filelist"    // time since the last filelist scan, from the event log
+	ReadCheck        = "read"        // the host's bzdata could be read, see Fail
+)
+
+// Defaults for the stale checks
+const (
+	DefaultTransmittedMaxAge = 24 * time.Hour
+	DefaultFilelistMaxAge    = 48 * time.Hour
+)
+
+// DefaultScanPattern matches the event log lines which record a filelist scan
+const DefaultScanPattern = `(?i)filelist`
+
+// StaleCheck is the age of the last occurrence of something (e.g. a transmission),
+// which is stale when older than MaxAge, or when it never occurred
+type StaleCheck struct {
+	Name   string        `json:"name"`
+	Last   time.Time     `json:"last"` // zero if never
+	Age    time.Duration `json:"age"`
+	MaxAge time.Duration `json:"maxAge"`
+	Stale  bool          `json:"stale"`
+	Error  string        `json:"error,omitempty"` // why the check failed, see Fail
+}
+
+// StaleReport holds the checks for a host, as of Now
+type StaleReport struct {
+	Host   string       `json:"host"`
+	Now    time.Time    `json:"now"`
+	Checks []StaleCheck `json:"checks"`
+}
+
+// NewStaleReport returns a report for host, without any checks
+func NewStaleReport(host string, now time.Time) *StaleReport {
+	return &StaleReport{Host: host, Now: now, Checks: make([]StaleCheck, 0)}
+}
+
+// Check adds a check named name, for something which last occurred at last (zero if never)
+func (report *StaleReport) Check(name string, last time.Time, maxAge time.Duration) StaleCheck {
+	check := StaleCheck{Name: name, Last: last, MaxAge: maxAge, Stale: true}
+	if !last.IsZero() {
+		check.Age = report.Now.Sub(last)
+		check.Stale = check.Age > maxAge
+	}
+	report.Checks = append(report.Checks, check)
+	return check
+}
+
+// Fail adds a check named name which could not be made, it is stale:
+// a host whose data cannot be read is as critical as one which stopped backing up
+func (report *StaleReport) Fail(name string, err error) StaleCheck {
+	check := StaleCheck{Name: name, Stale: true, Error: err.Error()}
+	report.Checks = append(report.Checks, check)
+	return check
+}
+
+// Stale is true if any of the checks is stale
+func (report *StaleReport) Stale() bool {
+	for _, check := range report.Checks {
+		if check.Stale {
+			return true
+		}
+	}
+	return false
+}
+
+// Summary is a one line description of the stale checks, or "ok"
+func (report *StaleReport) Summary() string {
+	stale := make([]string, 0)
+	for _, check := range report.Checks {
+		if check.Stale {
+			stale = append(stale, check.String())
+		}
+	}
+	if len(stale) == 0 {
+		return fmt.Sprintf("%s: ok", report.Host)
+	}
+	return fmt.Sprintf("%s: %s", report.Host, strings.Join(stale, ", "))
+}
+
+func (check StaleCheck) String() string {
+	if len(check.Error) != 0 {
+		return fmt.Sprintf("%s failed: %s", check.Name, check.Error)
+	}
+	if check.Last.IsZero() {
+		return fmt.Sprintf("no %s ever", check.Name)
+	}
+	return fmt.Sprintf("last %s %s ago (max %s)", check.Name, check.Age.Round(time.Minute), check.MaxAge)
+}
+
+// WriteText writes the checks for humans
+func (report *StaleReport) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, check := range report.Checks {
+		if len(check.Error) != 0 {
+			fmt.Fprintf(bw, "%-5s %s %-11s %s\n", "FAIL", report.Host, check.Name, check.Error)
+			continue
+		}
+		status := "ok"
+		if check.Stale {
+			status = "STALE"
+		}
+		last := "never"
+		if !check.Last.IsZero() {
+			last = check.Last.Format(StampLayout)
+		}
+		fmt.Fprintf(bw, "%-5s %s %-11s last: %s age: %s max: %s\n",
+			status, report.Host, check.Name, last, check.Age.Round(time.Minute), check.MaxAge)
+	}
+	return bw.Flush()
+}
+
+// WriteJSON writes the report as indented json
+func (report *StaleReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// LastTransmitted returns the time of the latest transmission, in loc, zero if there are none
+func LastTransmitted(xfrs []Transmitted, loc *time.Location) time.Time {
+	var last time.Time
+	for _, tx := range xfrs {
+		t, err := ParseStamp(tx.Stamp, loc)
+		if err != nil {
+			continue
+		}
+		if t.After(last) {
+			last = t
+		}
+	}
+	return last
+}
+
+// EventLogEntry is a line of the event log (bzreports_eventlog/DD.log)
+type EventLogEntry struct {
+	Stamp   string
+	Message string
+}
+
+// ParseEventLog calls fn for each line of an event log which starts with a stamp (see StampLayout).
+// The message is what follows the stamp, without the " - " separator.
+func ParseEventLog(r io.Reader, fn func(EventLogEntry)) (skipped int, err error) {
+	rc, err := Decompress(r)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+	scanner := bufio.NewScanner(rc)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) < len(StampLayout) {
+			skipped++
+			continue
+		}
+		stamp := line[:len(StampLayout)]
+		if _, err := ParseStamp(stamp, time.UTC); err != nil {
+			skipped++
+			continue
+		}
+		message := strings.TrimSpace(line[len(StampLayout):])
+		message = strings.TrimSpace(strings.TrimPrefix(message, "-"))
+		fn(EventLogEntry{Stamp: stamp, Message: message})
+	}
+	return skipped, scanner.Err()
+}
+
+// LastEvent returns the time of the latest event log entry matching re, in loc, zero if there are none
+func LastEvent(r io.Reader, re *regexp.Regexp, loc *time.Location) (time.Time, error) {
+	var last time.Time
+	_, err := ParseEventLog(r, func(entry EventLogEntry) {
+		if !re.MatchString(entry.Message) {
+			return
+		}
+		if t, err := ParseStamp(entry.Stamp, loc); err == nil && t.After(last) {
+			last = t
+		}
+	})
+	return last, err
+}
@@ -0,0 +1,94 @@
+package backblaze
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStaleReport(t *testing.T) {
+	now := time.Date(2018, 10, 2, 12, 0, 0, 0, time.UTC)
+	report := NewStaleReport("galois", now)
+	fresh := report.Check(TransmittedCheck, now.Add(-time.Hour), DefaultTransmittedMaxAge)
+	if fresh.Stale || fresh.Age != time.Hour {
+		t.Errorf("unexpected fresh check: %+v", fresh)
+	}
+	if report.Stale() || report.Summary() != "galois: ok" {
+		t.Errorf("expected ok, got %q", report.Summary())
+	}
+	old := report.Check(FilelistCheck, now.Add(-72*time.Hour), DefaultFilelistMaxAge)
+	if !old.Stale {
+		t.Errorf("expected stale check: %+v", old)
+	}
+	never := report.Check("other", time.Time{}, time.Hour)
+	if !never.Stale {
+		t.Errorf("expected a check that never occurred to be stale: %+v", never)
+	}
+	expected := "galois: last filelist 72h0m0s ago (max 48h0m0s), no other ever"
+	if !report.Stale() || report.Summary() != expected {
+		t.Errorf("expected %q, got %q", expected, report.Summary())
+	}
+	var buf bytes.Buffer
+	report.WriteText(&buf)
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 3 || !strings.HasPrefix(lines[1], "STALE galois filelist") {
+		t.Errorf("unexpected text: %q", buf.String())
+	}
+}
+
+func TestStaleReportFail(t *testing.T) {
+	report := NewStaleReport("galois", time.Date(2018, 10, 2, 12, 0, 0, 0, time.UTC))
+	report.Check(TransmittedCheck, report.Now.Add(-time.Hour), DefaultTransmittedMaxAge)
+	report.Fail(ReadCheck, errors.New("bzdata: no such file or directory"))
+	expected := "galois: read failed: bzdata: no such file or directory"
+	if !report.Stale() || report.Summary() != expected {
+		t.Errorf("expected %q, got %q", expected, report.Summary())
+	}
+	var buf bytes.Buffer
+	report.WriteText(&buf)
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 2 || lines[1] != "FAIL  galois read        bzdata: no such file or directory" {
+		t.Errorf("unexpected text: %q", buf.String())
+	}
+}
+
+func TestLastTransmitted(t *testing.T) {
+	xfrs := []Transmitted{
+		{Stamp: "2018-10-01 10:00:00"},
+		{Stamp: "2018-10-01 14:00:00"},
+		{Stamp: "bad stamp"},
+		{Stamp: "2018-10-01 12:00:00"},
+	}
+	expected := time.Date(2018, 10, 1, 14, 0, 0, 0, time.UTC)
+	if last := LastTransmitted(xfrs, time.UTC); !last.Equal(expected) {
+		t.Errorf("expected %v, got %v", expected, last)
+	}
+	if last := LastTransmitted(nil, time.UTC); !last.IsZero() {
+		t.Errorf("expected zero, got %v", last)
+	}
+}
+
+func TestLastEvent(t *testing.T) {
+	eventlog := `2018-10-01 09:00:00 - bzfilelist: scanning filelist for volume /
+2018-10-01 09:10:00 - Backup started
+not a stamped line
+2018-10-01 11:00:00 - bzfilelist: finished filelist for volume /Volumes/Space
+2018-10-01 12:00:00 - Backup completed
+`
+	var entries []EventLogEntry
+	skipped, err := ParseEventLog(strings.NewReader(eventlog), func(entry EventLogEntry) {
+		entries = append(entries, entry)
+	})
+	if err != nil || skipped != 1 || len(entries) != 4 {
+		t.Fatalf("expected 4 entries, 1 skipped, got %d, %d, %v", len(entries), skipped, err)
+	}
+	if entries[1].Message != "Backup started" {
+		t.Errorf("unexpected message: %q", entries[1].Message)
+	}
+	last, err := LastEvent(strings.NewReader(eventlog), regexp.MustCompile(DefaultScanPattern), time.UTC)
+	expected := time.Date(2018, 10, 1, 11, 0, 0, 0, time.UTC)
+	if err != nil || !last.Equal(expected) {
+		t.Errorf("expected %v, got %v, %v", expected, last, err)
+	}
+}
@@ -0,0 +1,205 @@
+package backblaze
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Tailer follows the transmitted logs matching a glob pattern
+// (e.g. bzdata/bzlogs/bzreports_lastfilestransmitted/*.log), and parses
+// the lines appended to them since the previous Poll.
+// The logs are named by day of the month, so a file which shrinks, whose first line changed,
+// or which is older than when it was last read, was rewritten, and is read again from the start.
+// Its state is the Offsets, Marks and Batches, which can be saved as json, to resume from where it was.
+type Tailer struct {
+	Pattern string                       `json:"pattern"`
+	Offsets map[string]int64             `json:"offsets"`           // by file
+	Marks   map[string]TailFingerprint   `json:"marks,omitempty"`   // by file, when its offset was saved
+	Batches map[string]TransmittedRecord `json:"batches,omitempty"` // by file, the header of a combined batch whose files are not all read yet
+
+	Progress io.Writer `json:"-"` // a line per log with malformed lines (which are skipped), nil for none
+}
+
+// TailFingerprint identifies the content of a log, to tell a rewrite from an append
+type TailFingerprint struct {
+	First   string    `json:"first"` // the first complete line which is not blank, empty if none yet
+	ModTime time.Time `json:"modTime"`
+}
+
+// Rewritten reports whether the file with fingerprint now is not the one fp was taken of
+func (fp TailFingerprint) Rewritten(now TailFingerprint) bool {
+	return (len(fp.First) != 0 && now.First != fp.First) || now.ModTime.Before(fp.ModTime)
+}
+
+// NewTailer returns a Tailer, whose first Poll reads the logs from the start
+func NewTailer(pattern string) *Tailer {
+	return &Tailer{Pattern: pattern, Offsets: make(map[string]int64), Marks: make(map[string]TailFingerprint), Batches: make(map[string]TransmittedRecord)}
+}
+
+// Clone returns a copy of t, which polls on from where t is, without moving t on
+func (t *Tailer) Clone() *Tailer {
+	clone := NewTailer(t.Pattern)
+	clone.Progress = t.Progress
+	for file, offset := range t.Offsets {
+		clone.Offsets[file] = offset
+	}
+	for file, mark := range t.Marks {
+		clone.Marks[file] = mark
+	}
+	for file, header := range t.Batches {
+		clone.Batches[file] = header
+	}
+	return clone
+}
+
+// Poll calls fn with every record (sent or dedup'd) in the complete lines appended since the last Poll
+func (t *Tailer) Poll(fn func(Transmitted)) error {
+	files, err := filepath.Glob(t.Pattern)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := t.poll(file, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Tailer) poll(file string, fn func(Transmitted)) error {
+	infile, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer infile.Close()
+	info, err := infile.Stat()
+	if err != nil {
+		return err
+	}
+	mark, err := Fingerprint(infile, info)
+	if err != nil {
+		return err
+	}
+	offset := t.Offsets[file]
+	combined := Transmitted(t.Batches[file])
+	if info.Size() < offset || t.Marks[file].Rewritten(mark) {
+		offset = 0
+		combined = Transmitted{}
+		delete(t.Batches, file)
+	}
+	// a partial first line (the offset is not at the start of a line) is skipped,
+	// a partial last line will be read on the next Poll
+	start, err := nextLine(infile, offset, info.Size())
+	if err != nil {
+		return err
+	}
+	lines, err := CompleteLines(infile, start, info.Size())
+	if err != nil {
+		return err
+	}
+	if t.Marks == nil {
+		t.Marks = make(map[string]TailFingerprint)
+	}
+	if t.Batches == nil {
+		t.Batches = make(map[string]TransmittedRecord)
+	}
+	t.Marks[file] = mark
+	if lines.Size() == 0 {
+		t.Offsets[file] = start
+		return nil
+	}
+	// a batch may be listed across polls
+	err = continueTransmitted(lines, true, &combined, fn)
+	if combined.Type == combinedHeader && combined.Chunk > 0 {
+		t.Batches[file] = TransmittedRecord(combined)
+	} else {
+		delete(t.Batches, file)
+	}
+	if err != nil {
+		var malformed *MalformedError
+		if !errors.As(err, &malformed) {
+			return err
+		}
+		if t.Progress != nil {
+			fmt.Fprintf(t.Progress, "-= Skipped %s: %v\n", file, err)
+		}
+	}
+	t.Offsets[file] = start + lines.Size()
+	return nil
+}
+
+// Fingerprint reads the first line of a log, see TailFingerprint
+func Fingerprint(infile *os.File, info os.FileInfo) (TailFingerprint, error) {
+	fp := TailFingerprint{ModTime: info.ModTime()}
+	head := make([]byte, 4096)
+	n, err := infile.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return fp, err
+	}
+	head = head[:n]
+	for {
+		i := bytes.IndexByte(head, '\n')
+		if i < 0 {
+			return fp, nil
+		}
+		if line := bytes.TrimSpace(head[:i]); len(line) != 0 {
+			fp.First = string(line)
+			return fp, nil
+		}
+		head = head[i+1:]
+	}
+}
+
+// nextLine is offset if it starts a line of r, or else the start of the next line, size if there is none
+func nextLine(r io.ReaderAt, offset, size int64) (int64, error) {
+	if offset == 0 || offset >= size {
+		return offset, nil
+	}
+	block := make([]byte, 4096)
+	if _, err := r.ReadAt(block[:1], offset-1); err != nil {
+		return 0, err
+	}
+	if block[0] == '\n' {
+		return offset, nil
+	}
+	for start := offset; start < size; {
+		n, err := r.ReadAt(block, start)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if i := bytes.IndexByte(block[:n], '\n'); i >= 0 {
+			return start + int64(i) + 1, nil
+		}
+		if n == 0 {
+			break
+		}
+		start += int64(n)
+	}
+	return size, nil
+}
+
+// CompleteLines is the section of r from offset up to its last newline before size,
+// empty if there is none, found by reading backwards from size, block by block.
+func CompleteLines(r io.ReaderAt, offset, size int64) (*io.SectionReader, error) {
+	block := make([]byte, 4096)
+	for end := size; end > offset; {
+		start := end - int64(len(block))
+		if start < offset {
+			start = offset
+		}
+		n, err := r.ReadAt(block[:end-start], start)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if i := bytes.LastIndexByte(block[:n], '\n'); i >= 0 {
+			return io.NewSectionReader(r, offset, start+int64(i)+1-offset), nil
+		}
+		end = start
+	}
+	return io.NewSectionReader(r, offset, 0), nil
+}
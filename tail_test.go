@@ -0,0 +1,198 @@
+package backblaze
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTailer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sample, err := ioutil.ReadFile("test/data/transmitted-sample.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := filepath.Join(dir, "01.log")
+	// the (empty) first line, the second, and part of the third
+	half := 1 + len("2018-10-17 18:39:45 -  small  - throttle auto     11 -     8 kBits/sec - 1 bytes - /Volumes/Space/fake_filename_to_refresh_volume_dashboard.txt\n") + 20
+	if err := ioutil.WriteFile(log, sample[:half], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tailer := NewTailer(filepath.Join(dir, "*.log"))
+	count := 0
+	poll := func() int {
+		count = 0
+		if err := tailer.Poll(func(tx Transmitted) { count++ }); err != nil {
+			t.Fatal(err)
+		}
+		return count
+	}
+	if n := poll(); n != 1 {
+		t.Errorf("expected the first complete line, got %d", n)
+	}
+	if n := poll(); n != 0 {
+		t.Errorf("expected nothing new, got %d", n)
+	}
+	if err := ioutil.WriteFile(log, sample, 0644); err != nil {
+		t.Fatal(err)
+	}
+	all := len(ParseTransmitedAll(bytes.NewReader(sample)))
+	if n := poll(); n != all-1 {
+		t.Errorf("expected the remaining %d records, got %d", all-1, n)
+	}
+	// rewritten (next month), shorter
+	if err := ioutil.WriteFile(log, sample[:half], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if n := poll(); n != 1 {
+		t.Errorf("expected a rewritten log to be read from the start, got %d", n)
+	}
+}
+
+func TestCompleteLines(t *testing.T) {
+	long := strings.Repeat("x", 5000)
+	var tests = []struct {
+		text   string
+		offset int64
+		want   string
+	}{
+		{"", 0, ""},
+		{"partial", 0, ""},
+		{"one\n", 0, "one\n"},
+		{"one\ntwo\npart", 0, "one\ntwo\n"},
+		{"one\ntwo\npart", 4, "two\n"},
+		{"one\ntwo\n", 8, ""},
+		{"one\n" + long, 0, "one\n"}, // the newline is blocks before the end
+		{long + "\n" + long, 0, long + "\n"},
+	}
+	for _, tt := range tests {
+		r := strings.NewReader(tt.text)
+		lines, err := CompleteLines(r, tt.offset, r.Size())
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(lines)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("CompleteLines(%.20q, %d): got %.20q, want %.20q", tt.text, tt.offset, got, tt.want)
+		}
+	}
+}
+
+func TestTailerRewritten(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sample, err := ioutil.ReadFile("test/data/transmitted-sample.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := len(ParseTransmitedAll(bytes.NewReader(sample)))
+	log := filepath.Join(dir, "17.log")
+	if err := ioutil.WriteFile(log, sample, 0644); err != nil {
+		t.Fatal(err)
+	}
+	tailer := NewTailer(filepath.Join(dir, "*.log"))
+	poll := func() int {
+		count := 0
+		if err := tailer.Poll(func(tx Transmitted) { count++ }); err != nil {
+			t.Fatal(err)
+		}
+		return count
+	}
+	if n := poll(); n != all {
+		t.Fatalf("expected %d records, got %d", all, n)
+	}
+	// rewritten (next month), as long, but with another first line
+	next := bytes.Replace(sample, []byte("2018-10-17"), []byte("2018-11-17"), 1)
+	if err := ioutil.WriteFile(log, next, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if n := poll(); n != all {
+		t.Errorf("expected a rewritten log to be read from the start, got %d", n)
+	}
+	// a saved offset in the middle of the first record: its partial line is skipped
+	tailer.Offsets[log] = 5
+	if n := poll(); n != all-1 {
+		t.Errorf("expected the partial line to be skipped, got %d", n)
+	}
+}
+
+func TestTailerCombinedAcrossPolls(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sample, err := ioutil.ReadFile("test/data/transmitted-sample.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// up to the header of a combined batch, whose files are listed after the first poll
+	header := bytes.Index(sample, []byte("2018-10-01 00:00:22"))
+	cut := header + bytes.IndexByte(sample[header:], '\n') + 1
+	log := filepath.Join(dir, "01.log")
+	if err := ioutil.WriteFile(log, sample[:cut], 0644); err != nil {
+		t.Fatal(err)
+	}
+	tailer := NewTailer(filepath.Join(dir, "*.log"))
+	got := make([]Transmitted, 0)
+	poll := func() {
+		if err := tailer.Poll(func(tx Transmitted) { got = append(got, tx) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	poll()
+	if len(tailer.Batches) != 1 {
+		t.Errorf("expected the unfinished batch to be kept, got %v", tailer.Batches)
+	}
+	if err := ioutil.WriteFile(log, sample, 0644); err != nil {
+		t.Fatal(err)
+	}
+	poll()
+	if want := ParseTransmitedAll(bytes.NewReader(sample)); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the records of a single read:\n%v\ngot:\n%v", want, got)
+	}
+}
+
+func TestTailerProgress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sample, err := ioutil.ReadFile("test/data/transmitted-sample.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := filepath.Join(dir, "01.log")
+	if err := ioutil.WriteFile(log, append(sample, "not a transmitted line\n"...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tailer := NewTailer(filepath.Join(dir, "*.log"))
+	var progress bytes.Buffer
+	tailer.Progress = &progress
+	count := 0
+	if err := tailer.Poll(func(tx Transmitted) { count++ }); err != nil {
+		t.Fatal(err)
+	}
+	if all := len(ParseTransmitedAll(bytes.NewReader(sample))); count != all {
+		t.Errorf("expected the %d records around the malformed line, got %d", all, count)
+	}
+	if !strings.HasPrefix(progress.String(), "-= Skipped "+log+": 1 malformed lines") {
+		t.Errorf("unexpected progress: %q", progress.String())
+	}
+}
@@ -0,0 +1,247 @@
+package backblaze
+
+import (
+	"archive/tar"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TarFS is a tar archive as a read-only fs.FS, e.g. of a bzdata snapshot:
+//
+//	tar czf galois-bzdata.tgz -C /Library/Backblaze.bzpkg bzdata
+//
+// Only the archive's index is kept in memory, its files are read from the archive when opened.
+// A compressed archive (see Decompress) is first decompressed to a temporary file.
+type TarFS struct {
+	file    *os.File
+	tmp     string // the decompressed copy, removed by Close
+	entries map[string]*tarEntry
+}
+
+// OpenTar indexes the archive at path
+func OpenTar(path string) (*TarFS, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	tfs := &TarFS{file: f, entries: map[string]*tarEntry{".": {name: ".", mode: fs.ModeDir | 0555}}}
+	rc, compressed, err := decompress(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if compressed {
+		err = tfs.decompressTo(rc)
+		rc.Close()
+		f.Close()
+		if err != nil {
+			tfs.Close()
+			return nil, err
+		}
+	} else if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := tfs.index(); err != nil {
+		tfs.Close()
+		return nil, err
+	}
+	return tfs, nil
+}
+
+func (tfs *TarFS) decompressTo(r io.Reader) error {
+	tmp, err := ioutil.TempFile("", "bztar-")
+	tfs.file = tmp
+	if err != nil {
+		return err
+	}
+	tfs.tmp = tmp.Name()
+	if _, err := io.Copy(tmp, r); err != nil {
+		return err
+	}
+	_, err = tmp.Seek(0, io.SeekStart)
+	return err
+}
+
+// Close releases the archive
+func (tfs *TarFS) Close() error {
+	var err error
+	if tfs.file != nil {
+		err = tfs.file.Close()
+	}
+	if len(tfs.tmp) != 0 {
+		os.Remove(tfs.tmp)
+	}
+	return err
+}
+
+// offsetReader tracks the offset of the archive, so the content of each file can be located.
+// It is a Seeker, so tar skips the content instead of reading it.
+type offsetReader struct {
+	f      *os.File
+	offset int64
+}
+
+func (r *offsetReader) Read(p []byte) (int, error) {
+	n, err := r.f.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *offsetReader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := r.f.Seek(offset, whence)
+	if err == nil {
+		r.offset = pos
+	}
+	return pos, err
+}
+
+func (tfs *TarFS) index() error {
+	r := &offsetReader{f: tfs.file}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "/"))
+		if name == "." || !fs.ValidPath(name) {
+			continue
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			dir := tfs.dir(name)
+			dir.modTime = hdr.ModTime
+		case tar.TypeReg, tar.TypeRegA:
+			parent := tfs.dir(path.Dir(name))
+			entry := &tarEntry{name: path.Base(name), mode: fs.FileMode(hdr.Mode).Perm(), size: hdr.Size, modTime: hdr.ModTime, offset: r.offset}
+			tfs.entries[name] = entry
+			parent.children = append(parent.children, entry)
+		}
+		// links and devices are not part of a snapshot
+	}
+}
+
+// dir returns the directory entry of name, adding it (and its parents) if needed
+func (tfs *TarFS) dir(name string) *tarEntry {
+	if entry, ok := tfs.entries[name]; ok {
+		return entry
+	}
+	entry := &tarEntry{name: path.Base(name), mode: fs.ModeDir | 0555}
+	tfs.entries[name] = entry
+	parent := tfs.dir(path.Dir(name))
+	parent.children = append(parent.children, entry)
+	return entry
+}
+
+// Open implements fs.FS
+func (tfs *TarFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	entry, ok := tfs.entries[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if entry.IsDir() {
+		children := append([]*tarEntry(nil), entry.children...)
+		sort.Slice(children, func(i, j int) bool { return children[i].name < children[j].name })
+		return &tarDir{entry: entry, children: children}, nil
+	}
+	return &tarFile{entry: entry, SectionReader: io.NewSectionReader(tfs.file, entry.offset, entry.size)}, nil
+}
+
+// tarEntry is both the fs.FileInfo and the fs.DirEntry of a file or directory
+type tarEntry struct {
+	name     string
+	mode     fs.FileMode
+	size     int64
+	modTime  time.Time
+	offset   int64
+	children []*tarEntry
+}
+
+func (e *tarEntry) Name() string               { return e.name }
+func (e *tarEntry) Size() int64                { return e.size }
+func (e *tarEntry) Mode() fs.FileMode          { return e.mode }
+func (e *tarEntry) ModTime() time.Time         { return e.modTime }
+func (e *tarEntry) IsDir() bool                { return e.mode.IsDir() }
+func (e *tarEntry) Sys() interface{}           { return nil }
+func (e *tarEntry) Type() fs.FileMode          { return e.mode.Type() }
+func (e *tarEntry) Info() (fs.FileInfo, error) { return e, nil }
+
+type tarFile struct {
+	*io.SectionReader
+	entry *tarEntry
+}
+
+func (f *tarFile) Stat() (fs.FileInfo, error) { return f.entry, nil }
+func (f *tarFile) Close() error               { return nil }
+
+type tarDir struct {
+	entry    *tarEntry
+	children []*tarEntry
+	read     int
+}
+
+func (d *tarDir) Stat() (fs.FileInfo, error) { return d.entry, nil }
+func (d *tarDir) Close() error               { return nil }
+func (d *tarDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.entry.name, Err: fs.ErrInvalid}
+}
+
+// ReadDir implements fs.ReadDirFile
+func (d *tarDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.children[d.read:]
+	if n > 0 && len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > 0 && n < len(rest) {
+		rest = rest[:n]
+	}
+	d.read += len(rest)
+	entries := make([]fs.DirEntry, len(rest))
+	for i, e := range rest {
+		entries[i] = e
+	}
+	return entries, nil
+}
+
+// OpenBzData opens a bzdata snapshot: a directory (the live one, or one collected by bzCollect),
+// or a tar archive of one, possibly compressed. An archive holding a single directory
+// (e.g. bzdata/) is opened at that directory. Close the returned Closer when done.
+func OpenBzData(name string) (fs.FS, io.Closer, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.IsDir() {
+		return os.DirFS(name), noClose{}, nil
+	}
+	tfs, err := OpenTar(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if root := tfs.entries["."].children; len(root) == 1 && root[0].IsDir() {
+		sub, err := fs.Sub(tfs, root[0].name)
+		if err != nil {
+			tfs.Close()
+			return nil, nil, err
+		}
+		return sub, tfs, nil
+	}
+	return tfs, tfs, nil
+}
+
+type noClose struct{}
+
+func (noClose) Close() error { return nil }
@@ -0,0 +1,99 @@
+package backblaze
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+// writeSnapshot archives the test bzdata, and the sample log, as bzdata/... in dir
+func writeSnapshot(t *testing.T, dir, name string, compress bool) string {
+	archive := filepath.Join(dir, name)
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var w io.Writer = f
+	if compress {
+		zw := gzip.NewWriter(f)
+		defer zw.Close()
+		w = zw
+	}
+	tw := tar.NewWriter(w)
+	defer tw.Close()
+	add := func(name, src string) {
+		data, err := ioutil.ReadFile(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write(data)
+	}
+	tw.WriteHeader(&tar.Header{Name: "bzdata/", Mode: 0755, Typeflag: tar.TypeDir})
+	add("bzdata/bzinfo.xml", "test/data/bzdata/bzinfo.xml")
+	add("bzdata/bzbackup/bzfileids.dat", "test/data/bzdata/bzbackup/bzfileids.dat")
+	add("bzdata/bzlogs/bzreports_lastfilestransmitted/2018-10-17.log", "test/data/transmitted-sample.log")
+	add("bzdata/bzlogs/bzreports_lastfilestransmitted/2018-10-02.log.bz2", "test/data/transmitted-sample.log.bz2")
+	return archive
+}
+
+func TestOpenBzData(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tarfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	expected, err := ioutil.ReadFile("test/data/bzdata/bzbackup/bzfileids.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, archive := range []string{writeSnapshot(t, dir, "bzdata.tar", false), writeSnapshot(t, dir, "bzdata.tgz", true)} {
+		bzdata, closer, err := OpenBzData(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// opened at bzdata/
+		if err := fstest.TestFS(bzdata, "bzinfo.xml", "bzbackup/bzfileids.dat"); err != nil {
+			t.Errorf("%s: %v", archive, err)
+		}
+		if got, err := fs.ReadFile(bzdata, "bzbackup/bzfileids.dat"); err != nil || !reflect.DeepEqual(expected, got) {
+			t.Errorf("%s: unexpected bzfileids.dat (%v)", archive, err)
+		}
+		files, err := GlobInputs(bzdata, "bzlogs/bzreports_lastfilestransmitted/*.log")
+		if err != nil || len(files) != 2 {
+			t.Fatalf("%s: expected 2 logs, got %v (%v)", archive, files, err)
+		}
+		ingested := (&Ingester{FS: bzdata, KeepDedup: true}).Ingest(files)
+		if len(ingested.Errors) != 0 || len(ingested.Records) != 2*len(sampleTransmitted(t)) {
+			t.Errorf("%s: unexpected ingest: %d records, errors: %v", archive, len(ingested.Records), ingested.Errors)
+		}
+		if err := closer.Close(); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// a directory is opened as is
+	bzdata, closer, err := OpenBzData("test/data/bzdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closer.Close()
+	if got, err := fs.ReadFile(bzdata, "bzbackup/bzfileids.dat"); err != nil || !reflect.DeepEqual(expected, got) {
+		t.Errorf("unexpected bzfileids.dat (%v)", err)
+	}
+	if _, _, err := OpenBzData(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error, got %v", err)
+	}
+}
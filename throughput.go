@@ -0,0 +1,240 @@
+package backblaze
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// DefaultIdleGap is the longest pause between transmissions still counted as busy time
+const DefaultIdleGap = 2 * time.Minute
+
+// RateStats compares the advertised rates (kBits/sec, as logged for each transmission)
+// with the effective rate: the bytes transmitted over the busy (wall clock) time.
+type RateStats struct {
+	Key           string     `json:"key"`
+	Transmissions int        `json:"transmissions"`
+	Bytes         int64      `json:"bytes"`
+	Seconds       float64    `json:"seconds"`
+	Effective     int        `json:"effective"`
+	Advertised    Throughput `json:"advertised"`
+
+	rates []int
+}
+
+func (rs *RateStats) add(sample rateSample, seconds float64) {
+	rs.Bytes += int64(sample.size)
+	rs.Seconds += seconds
+	if sample.rated {
+		rs.Transmissions++
+		rs.rates = append(rs.rates, sample.speed)
+	}
+}
+
+func (rs *RateStats) summarize() {
+	rs.Advertised = NewThroughput(rs.rates)
+	rs.rates = nil
+	if rs.Seconds > 0 {
+		rs.Effective = int(float64(rs.Bytes) * 8 / 1000 / rs.Seconds)
+	}
+}
+
+// ThroughputReport breaks the transmission rates down by hour of day (of the stamps),
+// by throttle setting ("manual 11", "auto 11") and by class (large, small)
+type ThroughputReport struct {
+	Total    RateStats   `json:"total"`
+	Hours    []RateStats `json:"hours"`
+	Throttle []RateStats `json:"throttle"`
+	Classes  []RateStats `json:"classes"`
+
+	idleGap time.Duration
+	samples []rateSample
+	skipped int
+}
+
+type rateSample struct {
+	t        time.Time
+	hour     string
+	throttle string
+	class    string
+	size     int
+	speed    int
+	rated    bool // counted as a transmission, see countsRate
+}
+
+// NewThroughputReport returns an empty report, counting pauses up to idleGap as busy
+func NewThroughputReport(idleGap time.Duration) *ThroughputReport {
+	return &ThroughputReport{
+		Hours:    make([]RateStats, 0, 24),
+		Throttle: make([]RateStats, 0),
+		Classes:  make([]RateStats, 0),
+		idleGap:  idleGap,
+		samples:  make([]rateSample, 0),
+	}
+}
+
+// Add considers a transmission, those without a rate (dedup) or a valid stamp are skipped
+func (report *ThroughputReport) Add(tx Transmitted) {
+	t, err := ParseStamp(tx.Stamp, time.UTC) // only the differences matter
+	if err != nil || tx.Speed == 0 {
+		report.skipped++
+		return
+	}
+	report.samples = append(report.samples, rateSample{
+		t:        t,
+		hour:     tx.Stamp[11:13],
+		throttle: fmt.Sprintf("%s %d", tx.Throttle, tx.Level),
+		class:    tx.Class,
+		size:     tx.Size,
+		speed:    tx.Speed,
+		rated:    countsRate(tx),
+	})
+}
+
+// Skipped is the number of transmissions without a rate, or with an unparsable stamp
+func (report *ThroughputReport) Skipped() int {
+	return report.skipped
+}
+
+// Summarize attributes the busy time to each transmission, and computes the rates.
+// Busy time is the pause since the previous transmission, unless it is longer than the idle gap,
+// then it is the transmission's own duration at its advertised rate.
+func (report *ThroughputReport) Summarize() {
+	sort.SliceStable(report.samples, func(i, j int) bool { return report.samples[i].t.Before(report.samples[j].t) })
+	hours := make(map[string]*RateStats)
+	throttle := make(map[string]*RateStats)
+	classes := make(map[string]*RateStats)
+	get := func(m map[string]*RateStats, key string) *RateStats {
+		rs, ok := m[key]
+		if !ok {
+			rs = &RateStats{Key: key}
+			m[key] = rs
+		}
+		return rs
+	}
+	report.Total = RateStats{Key: "total"}
+	for i, sample := range report.samples {
+		busy := report.idleGap + 1
+		if i > 0 {
+			busy = sample.t.Sub(report.samples[i-1].t)
+		}
+		if busy > report.idleGap {
+			busy = time.Duration(float64(sample.size) * 8 / 1000 / float64(sample.speed) * float64(time.Second))
+			if busy > report.idleGap {
+				busy = report.idleGap
+			}
+		}
+		seconds := busy.Seconds()
+		report.Total.add(sample, seconds)
+		get(hours, sample.hour).add(sample, seconds)
+		get(throttle, sample.throttle).add(sample, seconds)
+		get(classes, sample.class).add(sample, seconds)
+	}
+	report.Total.summarize()
+
+	report.Hours = report.Hours[:0]
+	for h := 0; h < 24; h++ {
+		rs := get(hours, fmt.Sprintf("%02d", h))
+		rs.summarize()
+		report.Hours = append(report.Hours, *rs)
+	}
+	report.Throttle = bySeconds(throttle)
+	report.Classes = bySeconds(classes)
+}
+
+// bySeconds returns the stats, most busy time first
+func bySeconds(m map[string]*RateStats) []RateStats {
+	list := make([]RateStats, 0, len(m))
+	for _, rs := range m {
+		rs.summarize()
+		list = append(list, *rs)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Seconds == list[j].Seconds {
+			return list[i].Key < list[j].Key
+		}
+		return list[i].Seconds > list[j].Seconds
+	})
+	return list
+}
+
+// WriteFormat writes the report in one of the Format* formats
+func (report *ThroughputReport) WriteFormat(w io.Writer, format string) error {
+	switch format {
+	case FormatText:
+		return report.WriteText(w)
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	case FormatJSONL:
+		return report.WriteJSONL(w)
+	case FormatCSV:
+		return report.WriteCSV(w)
+	}
+	return fmt.Errorf("unknown format: %q", format)
+}
+
+// each row of the report, with its record name: total,hour,throttle,class
+func (report *ThroughputReport) rows(fn func(record string, rs RateStats)) {
+	fn("total", report.Total)
+	for _, rs := range report.Hours {
+		fn("hour", rs)
+	}
+	for _, rs := range report.Throttle {
+		fn("throttle", rs)
+	}
+	for _, rs := range report.Classes {
+		fn("class", rs)
+	}
+}
+
+// WriteJSONL writes one line per row, each with a "record" field (total,hour,throttle,class)
+func (report *ThroughputReport) WriteJSONL(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	report.rows(func(record string, rs RateStats) {
+		enc.Encode(struct {
+			Record string `json:"record"`
+			RateStats
+		}{record, rs})
+	})
+	return bw.Flush()
+}
+
+// WriteCSV writes a single table, with a header: record,key,transmissions,bytes,seconds,effective,p50,p90,p99,max
+func (report *ThroughputReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"record", "key", "transmissions", "bytes", "seconds", "effective", "p50", "p90", "p99", "max"})
+	report.rows(func(record string, rs RateStats) {
+		cw.Write([]string{record, rs.Key,
+			strconv.Itoa(rs.Transmissions), strconv.FormatInt(rs.Bytes, 10),
+			strconv.FormatFloat(rs.Seconds, 'f', 0, 64), strconv.Itoa(rs.Effective),
+			strconv.Itoa(rs.Advertised.P50), strconv.Itoa(rs.Advertised.P90),
+			strconv.Itoa(rs.Advertised.P99), strconv.Itoa(rs.Advertised.Max)})
+	})
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteText writes the report for humans, rates in kBits/sec
+func (report *ThroughputReport) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	section := ""
+	report.rows(func(record string, rs RateStats) {
+		if record != section {
+			section = record
+			fmt.Fprintf(bw, "Throughput: by %s (transmissions bytes busy : effective | advertised p50 p90 p99 max)\n", record)
+		}
+		busy := time.Duration(rs.Seconds) * time.Second
+		fmt.Fprintf(bw, " %-10s %8d %10s %10s : %6d | %6d %6d %6d %6d\n",
+			rs.Key, rs.Transmissions, HumanBytes(rs.Bytes), busy, rs.Effective,
+			rs.Advertised.P50, rs.Advertised.P90, rs.Advertised.P99, rs.Advertised.Max)
+	})
+	return bw.Flush()
+}
@@ -0,0 +1,133 @@
+package backblaze
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func throughputSample() *ThroughputReport {
+	report := NewThroughputReport(DefaultIdleGap)
+	for _, tx := range []Transmitted{
+		// 1s at 1000 kBits/sec, first: busy for its own duration
+		{Type: normal, Stamp: "2018-10-01 10:00:00", Speed: 1000, Size: 125000, Class: "large", Throttle: "manual", Level: 11},
+		// 10s after the previous one
+		{Type: normal, Stamp: "2018-10-01 10:00:10", Speed: 2000, Size: 250000, Class: "large", Throttle: "manual", Level: 11},
+		// after an idle gap: busy for its own duration, 1s
+		{Type: chunked, Stamp: "2018-10-01 14:00:00", Speed: 100, Size: 12500, Class: "small", Throttle: "auto", Level: 11},
+		{Type: dedup, Stamp: "2018-10-01 14:00:01", Class: "small", Throttle: "x"},
+	} {
+		report.Add(tx)
+	}
+	report.Summarize()
+	return report
+}
+
+func TestThroughputReport(t *testing.T) {
+	report := throughputSample()
+	if report.Skipped() != 1 {
+		t.Errorf("expected 1 skipped (dedup), got %d", report.Skipped())
+	}
+	expected := RateStats{Key: "total", Transmissions: 3, Bytes: 387500, Seconds: 12, Effective: 258,
+		Advertised: Throughput{P50: 1000, P90: 2000, P99: 2000, Max: 2000}}
+	if report.Total.Key != expected.Key || report.Total.Transmissions != expected.Transmissions ||
+		report.Total.Bytes != expected.Bytes || report.Total.Seconds != expected.Seconds ||
+		report.Total.Effective != expected.Effective || report.Total.Advertised != expected.Advertised {
+		t.Errorf("expected total %+v, got %+v", expected, report.Total)
+	}
+	if len(report.Hours) != 24 {
+		t.Fatalf("expected 24 hours, got %d", len(report.Hours))
+	}
+	if h := report.Hours[10]; h.Key != "10" || h.Transmissions != 2 || h.Seconds != 11 || h.Effective != 272 {
+		t.Errorf("unexpected hour 10: %+v", h)
+	}
+	if h := report.Hours[14]; h.Transmissions != 1 || h.Effective != 100 {
+		t.Errorf("unexpected hour 14: %+v", h)
+	}
+	if h := report.Hours[0]; h.Key != "00" || h.Transmissions != 0 || h.Effective != 0 {
+		t.Errorf("unexpected hour 00: %+v", h)
+	}
+	if len(report.Throttle) != 2 || report.Throttle[0].Key != "manual 11" || report.Throttle[0].Seconds != 11 ||
+		report.Throttle[1].Key != "auto 11" || report.Throttle[1].Seconds != 1 {
+		t.Errorf("unexpected throttle: %+v", report.Throttle)
+	}
+	if len(report.Classes) != 2 || report.Classes[0].Key != "large" || report.Classes[1].Key != "small" {
+		t.Errorf("unexpected classes: %+v", report.Classes)
+	}
+}
+
+func TestThroughputCombined(t *testing.T) {
+	// a batch of 3 files is one transmission, with one rate
+	report := NewThroughputReport(DefaultIdleGap)
+	for chunk := -3; chunk < 0; chunk++ {
+		report.Add(Transmitted{Type: combinedContinued, Stamp: "2018-10-01 15:25:14", Speed: 3822, Size: 1000, Chunk: chunk, Class: "large", Throttle: "manual", Level: 11})
+	}
+	report.Summarize()
+	if report.Total.Transmissions != 1 || report.Total.Bytes != 3000 {
+		t.Errorf("unexpected total: %+v", report.Total)
+	}
+}
+
+func TestThroughputWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := throughputSample().WriteFormat(&buf, FormatCSV); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(buf.String(), "\n")
+	if lines[0] != "record,key,transmissions,bytes,seconds,effective,p50,p90,p99,max" {
+		t.Errorf("unexpected header: %q", lines[0])
+	}
+	if lines[1] != "total,total,3,387500,12,258,1000,2000,2000,2000" {
+		t.Errorf("unexpected total: %q", lines[1])
+	}
+	// total, 24 hours, 2 throttles, 2 classes, and the trailing newline
+	if len(lines) != 1+1+24+2+2+1 {
+		t.Errorf("unexpected number of lines: %d", len(lines))
+	}
+	if err := throughputSample().WriteFormat(&buf, "xml"); err == nil {
+		t.Errorf("expected an error for an unknown format")
+	}
+}
+
+func TestThroughputIdleGap(t *testing.T) {
+	// a long transmission is capped at the idle gap
+	report := NewThroughputReport(time.Second)
+	report.Add(Transmitted{Type: normal, Stamp: "2018-10-01 10:00:00", Speed: 1, Size: 1000000, Class: "large", Throttle: "auto", Level: 5})
+	report.Summarize()
+	if report.Total.Seconds != 1 {
+		t.Errorf("expected 1s, got %v", report.Total.Seconds)
+	}
+}
+
+func TestThroughputEdgeCases(t *testing.T) {
+	var data = []struct {
+		name          string
+		in            []Transmitted
+		skipped       int
+		transmissions int
+		seconds       float64
+	}{
+		{"empty", nil, 0, 0, 0},
+		// busy for its own duration: 1s at 1000 kBits/sec
+		{"one record", []Transmitted{{Type: normal, Stamp: "2018-10-01 10:00:00", Speed: 1000, Size: 125000}}, 0, 1, 1},
+		{"unparsable stamps", []Transmitted{{Type: normal, Stamp: "2018-10-01", Speed: 1000, Size: 125000}, {Type: normal, Stamp: "not a stamp", Speed: 1000}}, 2, 0, 0},
+	}
+	for _, tt := range data {
+		report := NewThroughputReport(DefaultIdleGap)
+		for _, tx := range tt.in {
+			report.Add(tx)
+		}
+		report.Summarize()
+		if report.Skipped() != tt.skipped || report.Total.Transmissions != tt.transmissions || report.Total.Seconds != tt.seconds {
+			t.Errorf("%s: unexpected skipped %d, total %+v", tt.name, report.Skipped(), report.Total)
+		}
+		if len(report.Hours) != 24 {
+			t.Errorf("%s: expected 24 hours, got %d", tt.name, len(report.Hours))
+		}
+		if err := report.WriteFormat(ioutil.Discard, FormatText); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package backblaze
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Bucket periods for an Aggregator
+const (
+	Minute = "minute"
+	Hour   = "hour"
+	Day    = "day"
+	Week   = "week" // starting on Monday
+	Month  = "month"
+)
+
+// StampLayout is the layout of Transmitted.Stamp, which has no timezone:
+// it is in the local time of the host which logged it
+const StampLayout = "2006-01-02 15:04:05"
+
+// dateLayout is the day part of a stamp
+const dateLayout = "2006-01-02"
+
+// ParseStamp parses a Transmitted.Stamp, in the timezone it was logged in
+func ParseStamp(stamp string, loc *time.Location) (time.Time, error) {
+	return time.ParseInLocation(StampLayout, stamp, loc)
+}
+
+// Truncate returns the start of the period holding t, in the timezone of t
+func Truncate(t time.Time, period string) time.Time {
+	y, m, d := t.Date()
+	switch period {
+	case Minute:
+		return time.Date(y, m, d, t.Hour(), t.Minute(), 0, 0, t.Location())
+	case Hour:
+		return time.Date(y, m, d, t.Hour(), 0, 0, 0, t.Location())
+	case Week:
+		monday := (int(t.Weekday()) + 6) % 7 // days since monday
+		return time.Date(y, m, d-monday, 0, 0, 0, 0, t.Location())
+	case Month:
+		return time.Date(y, m, 1, 0, 0, 0, 0, t.Location())
+	}
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// nextPeriod returns the start of the period following the one starting at start.
+// Minutes and hours are elapsed time, they are not truncated again: on a DST fall-back,
+// the repeated hour would resolve to the earlier one, and the period would never end.
+// Days, weeks and months are calendar dates, which always advance.
+func nextPeriod(start time.Time, period string) time.Time {
+	y, m, d := start.Date()
+	switch period {
+	case Minute:
+		return start.Add(time.Minute)
+	case Hour:
+		return start.Add(time.Hour)
+	case Week:
+		return time.Date(y, m, d+7, 0, 0, 0, 0, start.Location())
+	case Month:
+		return time.Date(y, m+1, 1, 0, 0, 0, 0, start.Location())
+	}
+	return time.Date(y, m, d+1, 0, 0, 0, 0, start.Location())
+}
+
+// Throughput is a distribution of transmission rates, in kBits/sec
+type Throughput struct {
+	P50 int `json:"p50"`
+	P90 int `json:"p90"`
+	P99 int `json:"p99"`
+	Max int `json:"max"`
+}
+
+// NewThroughput summarizes the rates, which it sorts in place
+func NewThroughput(rates []int) Throughput {
+	sort.Ints(rates)
+	if len(rates) == 0 {
+		return Throughput{}
+	}
+	return Throughput{
+		P50: percentile(rates, 50),
+		P90: percentile(rates, 90),
+		P99: percentile(rates, 99),
+		Max: rates[len(rates)-1],
+	}
+}
+
+// percentile is the nearest rank percentile p (0-100) of sorted values:
+// the smallest value which at least p% of the values are less than or equal to
+func percentile(sorted []int, p float64) int {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := nearestRank(p, len(sorted))
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+// nearestRank is the 0-based index of the percentile p (0-100) in n sorted values, below 0 for p 0
+func nearestRank(p float64, n int) int {
+	return int(math.Ceil(p/100*float64(n))) - 1
+}
+
+// BucketStats is the total of a group's transmissions in one period
+type BucketStats struct {
+	Start      time.Time  `json:"start"`
+	Group      string     `json:"group"`
+	Bytes      int64      `json:"bytes"`
+	Files      int        `json:"files"`  // distinct files
+	Chunks     int        `json:"chunks"` // chunks of large files
+	Throughput Throughput `json:"throughput"`
+}
+
+type bucketKey struct {
+	start int64 // unix seconds
+	group string
+}
+
+type bucketCell struct {
+	stats BucketStats
+	files map[string]bool
+	rates []int
+}
+
+// Aggregator buckets transmissions by period (Minute,Hour,Day,Week,Month) in a timezone,
+// and by group: every group gets every period between the first and last transmission,
+// zero filled, so stacked charts line up.
+type Aggregator struct {
+	Period        string
+	Location      *time.Location // timezone of the buckets
+	StampLocation *time.Location // timezone the stamps were logged in, default time.Local
+	Grouper       Grouper        // nil puts everything in a single "" group
+
+	cells   map[bucketKey]*bucketCell
+	groups  map[string]bool
+	first   time.Time
+	last    time.Time
+	skipped int
+}
+
+// NewAggregator validates the period; a nil loc buckets in the stamps' own timezone
+func NewAggregator(period string, loc *time.Location, g Grouper) (*Aggregator, error) {
+	switch period {
+	case Minute, Hour, Day, Week, Month:
+	default:
+		return nil, fmt.Errorf("unknown period: %q", period)
+	}
+	return &Aggregator{
+		Period:        period,
+		Location:      loc,
+		StampLocation: time.Local,
+		Grouper:       g,
+		cells:         make(map[bucketKey]*bucketCell),
+		groups:        make(map[string]bool),
+	}, nil
+}
+
+// Add counts a transmission, those with an unparsable stamp are only counted as Skipped
+func (agg *Aggregator) Add(tx Transmitted) {
+	t, err := ParseStamp(tx.Stamp, agg.StampLocation)
+	if err != nil {
+		agg.skipped++
+		return
+	}
+	if agg.Location != nil {
+		t = t.In(agg.Location)
+	}
+	start := Truncate(t, agg.Period)
+	if agg.first.IsZero() || start.Before(agg.first) {
+		agg.first = start
+	}
+	if agg.last.IsZero() || start.After(agg.last) {
+		agg.last = start
+	}
+	group := ""
+	if agg.Grouper != nil {
+		group = agg.Grouper.Group(tx.FName)
+	}
+	agg.groups[group] = true
+
+	key := bucketKey{start.Unix(), group}
+	cell, ok := agg.cells[key]
+	if !ok {
+		cell = &bucketCell{stats: BucketStats{Start: start, Group: group}, files: make(map[string]bool)}
+		agg.cells[key] = cell
+	}
+	cell.stats.Bytes += int64(tx.Size)
+	cell.files[tx.FName] = true
+	if tx.Type == chunked {
+		cell.stats.Chunks++
+	}
+	if tx.Speed > 0 && countsRate(tx) {
+		cell.rates = append(cell.rates, tx.Speed)
+	}
+}
+
+// countsRate is false for all but the last file of a batch of combined files:
+// the batch is a single transmission, its rate should be counted once
+func countsRate(tx Transmitted) bool {
+	return tx.Type != combinedContinued || tx.Chunk == -1
+}
+
+// Skipped is the number of transmissions with an unparsable stamp
+func (agg *Aggregator) Skipped() int {
+	return agg.skipped
+}
+
+// Buckets returns the stats of every period, from the first to the last transmission,
+// and every group, sorted by period, then group
+func (agg *Aggregator) Buckets() []BucketStats {
+	buckets := make([]BucketStats, 0)
+	if len(agg.cells) == 0 {
+		return buckets
+	}
+	groups := sortedKeys(agg.groups)
+	for start := agg.first; !start.After(agg.last); start = nextPeriod(start, agg.Period) {
+		for _, group := range groups {
+			cell, ok := agg.cells[bucketKey{start.Unix(), group}]
+			if !ok {
+				buckets = append(buckets, BucketStats{Start: start, Group: group})
+				continue
+			}
+			stats := cell.stats
+			stats.Files = len(cell.files)
+			stats.Throughput = NewThroughput(append([]int(nil), cell.rates...))
+			buckets = append(buckets, stats)
+		}
+	}
+	return buckets
+}
@@ -0,0 +1,161 @@
+package backblaze
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTruncate(t *testing.T) {
+	// 2018-10-03 is a Wednesday
+	ts := time.Date(2018, 10, 3, 13, 27, 18, 0, time.UTC)
+	var data = []struct {
+		period string
+		out    time.Time
+	}{
+		{Minute, time.Date(2018, 10, 3, 13, 27, 0, 0, time.UTC)},
+		{Hour, time.Date(2018, 10, 3, 13, 0, 0, 0, time.UTC)},
+		{Day, time.Date(2018, 10, 3, 0, 0, 0, 0, time.UTC)},
+		{Week, time.Date(2018, 10, 1, 0, 0, 0, 0, time.UTC)},
+		{Month, time.Date(2018, 10, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range data {
+		if got := Truncate(ts, tt.period); !got.Equal(tt.out) {
+			t.Errorf("Truncate(%s): expected %v, got %v", tt.period, tt.out, got)
+		}
+	}
+	sunday := time.Date(2018, 10, 7, 23, 0, 0, 0, time.UTC)
+	if got := Truncate(sunday, Week); !got.Equal(time.Date(2018, 10, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Truncate(sunday, week): got %v", got)
+	}
+}
+
+func TestNewAggregator(t *testing.T) {
+	if _, err := NewAggregator("fortnight", nil, nil); err == nil {
+		t.Errorf("expected an error for an unknown period")
+	}
+}
+
+func TestAggregatorBuckets(t *testing.T) {
+	xfrs := []Transmitted{
+		{Type: normal, Stamp: "2018-10-01 23:30:00", Speed: 100, Size: 10, FName: "/Users/daniel/a.txt"},
+		{Type: chunked, Stamp: "2018-10-01 23:40:00", Speed: 300, Size: 20, Chunk: 1, FName: "/Volumes/Space/big.zip"},
+		{Type: chunked, Stamp: "2018-10-01 23:41:00", Speed: 200, Size: 20, Chunk: 0, FName: "/Volumes/Space/big.zip"},
+		// a batch of 2 combined files: one rate
+		{Type: combinedContinued, Stamp: "2018-10-03 01:00:00", Speed: 50, Size: 3, Chunk: -2, FName: "/Users/daniel/b.jpg"},
+		{Type: combinedContinued, Stamp: "2018-10-03 01:00:00", Speed: 50, Size: 3, Chunk: -1, FName: "/Users/daniel/c.jpg"},
+		{Stamp: "garbage"},
+	}
+	agg, err := NewAggregator(Day, time.UTC, DepthGrouper{Depth: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	agg.StampLocation = time.UTC
+	for _, tx := range xfrs {
+		agg.Add(tx)
+	}
+	if agg.Skipped() != 1 {
+		t.Errorf("expected 1 skipped, got %d", agg.Skipped())
+	}
+	day := func(d int) time.Time { return time.Date(2018, 10, d, 0, 0, 0, 0, time.UTC) }
+	expected := []BucketStats{
+		{Start: day(1), Group: "/Users/", Bytes: 10, Files: 1, Throughput: Throughput{100, 100, 100, 100}},
+		{Start: day(1), Group: "/Volumes/", Bytes: 40, Files: 1, Chunks: 2, Throughput: Throughput{200, 300, 300, 300}},
+		{Start: day(2), Group: "/Users/"},
+		{Start: day(2), Group: "/Volumes/"},
+		{Start: day(3), Group: "/Users/", Bytes: 6, Files: 2, Throughput: Throughput{50, 50, 50, 50}},
+		{Start: day(3), Group: "/Volumes/"},
+	}
+	if got := agg.Buckets(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected\n%v\ngot\n%v", expected, got)
+	}
+}
+
+func TestAggregatorLocation(t *testing.T) {
+	// logged in Montreal (UTC-4 in October), bucketed in UTC: 23:30 is the next day
+	montreal := time.FixedZone("EDT", -4*3600)
+	agg, _ := NewAggregator(Hour, time.UTC, nil)
+	agg.StampLocation = montreal
+	agg.Add(Transmitted{Stamp: "2018-10-01 22:30:00", Size: 1, FName: "/a"})
+	agg.Add(Transmitted{Stamp: "2018-10-02 00:10:00", Size: 2, FName: "/b"})
+	got := agg.Buckets()
+	if len(got) != 3 {
+		t.Fatalf("expected 3 hours (zero filled), got %v", got)
+	}
+	if !got[0].Start.Equal(time.Date(2018, 10, 2, 2, 0, 0, 0, time.UTC)) || got[0].Bytes != 1 {
+		t.Errorf("unexpected first bucket: %v", got[0])
+	}
+	if got[1].Bytes != 0 || got[2].Bytes != 2 {
+		t.Errorf("unexpected buckets: %v", got)
+	}
+}
+
+// buckets fails the test instead of hanging, if Buckets does not return
+func buckets(t *testing.T, agg *Aggregator) []BucketStats {
+	done := make(chan []BucketStats, 1)
+	go func() { done <- agg.Buckets() }()
+	select {
+	case got := <-done:
+		return got
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Buckets did not return")
+	}
+	return nil
+}
+
+func TestAggregatorDST(t *testing.T) {
+	montreal, err := time.LoadLocation("America/Montreal")
+	if err != nil {
+		t.Skip(err)
+	}
+	var data = []struct {
+		period   string
+		from, to string
+		expected int
+	}{
+		// fall back: 01:00 is repeated, 00:00 EDT to 03:00 EST is 5 hours
+		{Hour, "2018-11-04 00:30:00", "2018-11-04 03:30:00", 5},
+		{Minute, "2018-11-04 00:30:00", "2018-11-04 03:30:00", 4*60 + 1},
+		{Day, "2018-11-03 12:00:00", "2018-11-05 12:00:00", 3},
+		// spring forward: there is no 02:00
+		{Hour, "2018-03-11 01:30:00", "2018-03-11 03:30:00", 2},
+		{Day, "2018-03-10 12:00:00", "2018-03-12 12:00:00", 3},
+	}
+	for _, tt := range data {
+		agg, _ := NewAggregator(tt.period, montreal, nil)
+		agg.StampLocation = montreal
+		agg.Add(Transmitted{Stamp: tt.from, Size: 1, FName: "/a"})
+		agg.Add(Transmitted{Stamp: tt.to, Size: 2, FName: "/b"})
+		got := buckets(t, agg)
+		if len(got) != tt.expected {
+			t.Errorf("%s %s..%s: expected %d buckets, got %d", tt.period, tt.from, tt.to, tt.expected, len(got))
+			continue
+		}
+		if got[0].Bytes != 1 || got[len(got)-1].Bytes != 2 {
+			t.Errorf("%s %s..%s: unexpected first or last bucket: %v %v", tt.period, tt.from, tt.to, got[0], got[len(got)-1])
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	values := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	var data = []struct {
+		p   float64
+		out int
+	}{
+		{0, 1}, {50, 5}, {90, 9}, {99, 10}, {100, 10},
+	}
+	for _, tt := range data {
+		if got := percentile(values, tt.p); got != tt.out {
+			t.Errorf("percentile(%v): expected %d, got %d", tt.p, tt.out, got)
+		}
+	}
+	// 90% of 16 values is 14.4, ranked 15th
+	values = []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	if got := percentile(values, 90); got != 15 {
+		t.Errorf("percentile(90) of 16 values: expected 15, got %d", got)
+	}
+	if percentile(nil, 50) != 0 {
+		t.Errorf("expected 0 for no values")
+	}
+}
@@ -2,11 +2,14 @@ package backblaze
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"os"
 	"strings"
+	"sync"
 )
 
 // Transmitted represent a line in the transmitted logs
@@ -19,6 +22,26 @@ type Transmitted struct {
 	SizeUnit  string       `json:"-"`
 	Chunk     int          `json:"chunk"`
 	FName     string       `json:"fname"`
+	Class     string       `json:"-"` // large or small
+	Throttle  string       `json:"-"` // manual, auto (or x for dedup)
+	Level     int          `json:"-"` // throttle level
+}
+
+// TransmittedRecord is a Transmitted with all of its fields in json, rates included,
+// for the state and the storage which keep them (Transmitted leaves them out, to keep the viz data small).
+// The two convert to one another: TransmittedRecord(tx), Transmitted(rec).
+type TransmittedRecord struct {
+	Type      txRecordType `json:"type"`
+	Stamp     string       `json:"stamp"`
+	Speed     int          `json:"speed"`
+	SpeedUnit string       `json:"speedUnit"`
+	Size      int          `json:"size"`
+	SizeUnit  string       `json:"sizeUnit"`
+	Chunk     int          `json:"chunk"`
+	FName     string       `json:"fname"`
+	Class     string       `json:"class"`
+	Throttle  string       `json:"throttle"`
+	Level     int          `json:"level"`
 }
 
 /*
@@ -57,20 +80,98 @@ Chunked (1 file split into multiple chunks)
 
 */
 
-// ParseTransmited parses transmitted logs
+// ParseTransmited parses transmitted logs, keeping only what was actually sent
 func ParseTransmited(r io.Reader) []Transmitted {
+	return parseTransmitted(r, false)
+}
+
+// ParseTransmitedAll parses transmitted logs, also keeping the dedup records (not sent)
+func ParseTransmitedAll(r io.Reader) []Transmitted {
+	return parseTransmitted(r, true)
+}
+
+// Dedup reports whether the record was deduplicated (not sent)
+func (tx Transmitted) Dedup() bool {
+	return tx.Type == dedup || tx.Type == dedupChunked
+}
 
-	scanner := bufio.NewScanner(r)
+// Chunked reports whether the record is a chunk of a large file
+func (tx Transmitted) Chunked() bool {
+	return tx.Type == chunked || tx.Type == dedupChunked
+}
+
+// ReadTransmitted parses a transmitted log file, keeping the dedup records if keepDedup,
+// and returns the errors rather than exiting
+func ReadTransmitted(file string, keepDedup bool) ([]Transmitted, error) {
+	infile, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer infile.Close()
+	return scanTransmitted(infile, keepDedup)
+}
+
+// ReadTransmittedFS is ReadTransmitted of a file in fsys, e.g. of a tar snapshot (see OpenBzData)
+func ReadTransmittedFS(fsys fs.FS, file string, keepDedup bool) ([]Transmitted, error) {
+	infile, err := fsys.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer infile.Close()
+	return scanTransmitted(infile, keepDedup)
+}
+
+// parseTransmitted exits on a read error, malformed lines are skipped with a warning
+func parseTransmitted(r io.Reader, keepDedup bool) []Transmitted {
+	list, err := scanTransmitted(r, keepDedup)
+	var malformed *MalformedError
+	if errors.As(err, &malformed) {
+		fmt.Fprintf(os.Stderr, "-= Skipped %v\n", err)
+	} else if err != nil {
+		log.Fatal(err)
+	}
+	return list
+}
+
+func scanTransmitted(r io.Reader, keepDedup bool) ([]Transmitted, error) {
 	list := make([]Transmitted, 0, 1000)
+	err := eachTransmitted(r, keepDedup, func(tx Transmitted) {
+		list = append(list, tx)
+	})
+	return list, err
+}
+
+// eachTransmitted streams the records of r to fn, see scanTransmitted
+func eachTransmitted(r io.Reader, keepDedup bool, fn func(Transmitted)) error {
+	var combined Transmitted
+	return continueTransmitted(r, keepDedup, &combined, fn)
+}
+
+// continueTransmitted is eachTransmitted, for the lines of a log after those already read:
+// combined is the header of the last combined batch read, whose files may be listed in r,
+// it is updated as they are, and as new batches start
+func continueTransmitted(r io.Reader, keepDedup bool, combined *Transmitted, fn func(Transmitted)) error {
+	rc, err := Decompress(r)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	scanner := bufio.NewScanner(rc)
+	counts := make(map[txRecordType]int)
 	skipped := 0
 
 	compare := false
 	var tx2, tx3 Transmitted
 	lastCombined2 := Transmitted{}
-	lastCombined3 := Transmitted{}
+	lastCombined3 := *combined
+	defer func() { *combined = lastCombined3 }()
 
+	var malformed MalformedError
+	lineNo := 0
 	for scanner.Scan() {
 		line := scanner.Text()
+		lineNo++
 
 		// Orig 8.1s : Fast 5.3 : both 9.6
 
@@ -78,8 +179,12 @@ func ParseTransmited(r io.Reader) []Transmitted {
 			tx2 = splitFields(line, &lastCombined2)
 		}
 		// tx3, txtyp3 = splitFields(line, &lastCombined3)
-		tx3 = splitFieldsFast(line, &lastCombined3)
-		countType(tx3.Type, line)
+		tx3, err = splitFieldsFast(line, &lastCombined3)
+		if err != nil {
+			malformed.add(lineNo, line, err)
+			continue
+		}
+		countType(counts, tx3.Type, line)
 
 		if tx3.Type == empty {
 			skipped++
@@ -95,24 +200,28 @@ func ParseTransmited(r io.Reader) []Transmitted {
 		if compare && (tx2 != tx3) {
 			fmt.Fprintf(os.Stderr, "UnMatched-2,3\n%#v\n%#v\n%s\n", tx2, tx3, line)
 		}
-		if tx3.Type == dedup || tx3.Type == dedupChunked || tx3.Type == combinedHeader {
+		if (!keepDedup && tx3.Dedup()) || tx3.Type == combinedHeader {
 			skipped++
 			continue
 		}
 
-		list = append(list, tx3)
+		fn(tx3)
 	}
 	// fmt.Fprintf(os.Stderr, "-= Parsed %d lines (%d skipped)\n", len(list), skipped)
 
+	addTypeCounts(counts)
 	if err := scanner.Err(); err != nil {
-		log.Fatal(err)
+		return err
+	}
+	if malformed.Lines > 0 {
+		return &malformed
 	}
 
 	// Print Counts, and optionally reset
 	// fmt.Fprintf(os.Stderr, "|countTypes|=%d %#v\n", len(countTypes), countTypes)
 	// countTypes = make(map[txRecordType]int)
 
-	return list
+	return nil
 }
 
 type txRecordType string
@@ -146,6 +255,7 @@ func splitFields(line string, lastCombined *Transmitted) Transmitted {
 
 	tx.Stamp = fields[0]
 	if len(fields) == 6 {
+		splitThrottle(fields[1]+" - "+fields[2], &tx)
 		// ignore errors, default struct values are OK
 		fmt.Sscanf(strings.TrimSpace(fields[3]), "%d %s", &tx.Speed, &tx.SpeedUnit)
 		fmt.Sscanf(strings.TrimSpace(fields[4]), "%d %s", &tx.Size, &tx.SizeUnit)
@@ -188,6 +298,9 @@ func splitFields(line string, lastCombined *Transmitted) Transmitted {
 		tx.SizeUnit = lastCombined.SizeUnit
 		tx.Speed = lastCombined.Speed
 		tx.SpeedUnit = lastCombined.SpeedUnit
+		tx.Class = lastCombined.Class
+		tx.Throttle = lastCombined.Throttle
+		tx.Level = lastCombined.Level
 
 		lastCombined.Chunk-- // combined chunks are numbered -7,-6,..,-1
 		tx.Type = combinedContinued
@@ -196,24 +309,95 @@ func splitFields(line string, lastCombined *Transmitted) Transmitted {
 	return tx
 }
 
+// splitThrottle parses the class and throttle fields: " large  - throttle manual   11"
+func splitThrottle(mid string, tx *Transmitted) {
+	fields := strings.SplitN(mid, " - ", 3)
+	if len(fields) < 2 {
+		return
+	}
+	tx.Class = strings.TrimSpace(fields[0])
+	// ignore errors, default struct values are OK ("throttle x" has no level)
+	fmt.Sscanf(strings.TrimSpace(fields[1]), "throttle %s %d", &tx.Throttle, &tx.Level)
+}
+
+// countTypes is only for debugging, files may be parsed concurrently (see Ingester)
 var countTypes map[txRecordType]int
+var countTypesMu sync.Mutex
 
-func countType(typ txRecordType, line string) {
+func countType(counts map[txRecordType]int, typ txRecordType, line string) {
+	counts[typ] = counts[typ] + 1
+	// if counts[typ] < 3 {
+	// 	fmt.Printf("--%s:%d--\n%s\n", typ, counts[typ], line)
+	// }
+}
+
+func addTypeCounts(counts map[txRecordType]int) {
+	countTypesMu.Lock()
+	defer countTypesMu.Unlock()
 	if countTypes == nil {
 		countTypes = make(map[txRecordType]int)
 	}
-	countTypes[typ] = countTypes[typ] + 1
-	// if countTypes[typ] < 3 {
-	// 	fmt.Printf("--%s:%d--\n%s\n", typ, countTypes[typ], line)
-	// }
+	for typ, n := range counts {
+		countTypes[typ] += n
+	}
+}
+
+// errMalformed is a line which is not a transmitted record, e.g. truncated
+var errMalformed = errors.New("malformed line")
+
+// MalformedError counts the lines of a log which could not be parsed, and were skipped.
+// The first one is kept, for the message.
+type MalformedError struct {
+	Lines int    // malformed
+	Line  int    // number of the first one, from 1
+	Text  string // of the first one
+	Err   error
+}
+
+func (me *MalformedError) Error() string {
+	return fmt.Sprintf("%d malformed lines, first at line %d: %v: %q", me.Lines, me.Line, me.Err, me.Text)
+}
+
+func (me *MalformedError) add(line int, text string, err error) {
+	if me.Lines == 0 {
+		me.Line, me.Text, me.Err = line, text, err
+	}
+	me.Lines++
+}
+
+// parseChunk parses "Chunk 00505 of /path", into the chunk number and the path
+func parseChunk(fname string) (int, string, error) {
+	var chunk int
+	if _, err := fmt.Sscanf(fname, "Chunk %x of", &chunk); err != nil || len(fname) < 15 {
+		return 0, "", fmt.Errorf("%w: chunk: %q", errMalformed, fname)
+	}
+	return chunk, fname[15:], nil
+}
+
+// scanSpeedSize parses the speed and size fields of mid (class - throttle - speed - size)
+func scanSpeedSize(mid string, tx *Transmitted) error {
+	fields := strings.SplitN(mid, " - ", 4)
+	if len(fields) < 4 {
+		return fmt.Errorf("%w: %d fields", errMalformed, len(fields))
+	}
+	// ignore errors, default struct values are OK
+	fmt.Sscanf(strings.TrimSpace(fields[2]), "%d %s", &tx.Speed, &tx.SpeedUnit)
+	fmt.Sscanf(strings.TrimSpace(fields[3]), "%d %s", &tx.Size, &tx.SizeUnit)
+	return nil
 }
 
-func splitFieldsFast(line string, lastCombined *Transmitted) Transmitted {
+// splitFieldsFast parses a line by the positions of its fields,
+// it returns an error for a line which does not have them (e.g. truncated)
+func splitFieldsFast(line string, lastCombined *Transmitted) (Transmitted, error) {
 	tx := Transmitted{}
 
 	if 0 == len(strings.TrimSpace(line)) {
 		tx.Type = empty
-		return tx
+		return tx, nil
+	}
+	const minLength = 83 // up to the path of a dedup record
+	if len(line) < minLength {
+		return tx, fmt.Errorf("%w: too short", errMalformed)
 	}
 
 	tx.Type = normal
@@ -222,88 +406,83 @@ func splitFieldsFast(line string, lastCombined *Transmitted) Transmitted {
 		tx.FName = line[83:len(line)]
 		tx.SizeUnit = "bytes" // just to conform, but 0 is 0!
 		tx.Type = dedup
+		splitThrottle(line[22:65], &tx)
 		//  No other (non-default) fields required
 		if strings.HasPrefix(tx.FName, "Chunk") {
-			_, err := fmt.Sscanf(tx.FName, "Chunk %x of", &tx.Chunk)
-			tx.FName = tx.FName[15:len(tx.FName)]
+			chunk, fname, err := parseChunk(tx.FName)
 			if err != nil {
-				log.Printf("Unable to parse dedup-chunked record:\n%s", line)
-				log.Fatal(err)
+				return tx, err
 			}
+			tx.Chunk, tx.FName = chunk, fname
 			tx.Type = dedupChunked
 		}
-		// fmt.Printf("|%s|%s|%s|\n", tx.Stamp, mid, tx.FName)
-	} else {
-		preBeginOfPath := strings.Index(line, " - /")
-		if preBeginOfPath == -1 {
-			preBeginOfPath = strings.Index(line, " - Chunk")
+		return tx, nil
+	}
+
+	preBeginOfPath := strings.Index(line, " - /")
+	if preBeginOfPath == -1 {
+		preBeginOfPath = strings.Index(line, " - Chunk")
+	}
+	if preBeginOfPath == -1 {
+		preBeginOfPath = strings.Index(line, " - Multiple")
+	}
+	if preBeginOfPath < 22 {
+		return tx, fmt.Errorf("%w: no path", errMalformed)
+	}
+	// flaky because numerical fields sometime skew things
+	if preBeginOfPath != 87 && preBeginOfPath != 88 && preBeginOfPath != 89 && preBeginOfPath != 80 {
+		fmt.Fprintf(os.Stderr, "-= Unexpected line structure (might be ok)\n")
+		fmt.Fprintf(os.Stderr, "-begin: %d |%s|\n", preBeginOfPath, line)
+		fmt.Fprintf(os.Stderr, "+begin: %d |%s|\n", preBeginOfPath, line[preBeginOfPath+3:])
+	}
+	mid := line[22:preBeginOfPath]
+	tx.FName = line[preBeginOfPath+3:]
+	splitThrottle(mid, &tx)
+
+	if len(strings.TrimSpace(mid)) == 0 {
+		// combinedContinued
+		tx.Type = combinedContinued
+		//  No other (non-default) fields required
+		tx.Chunk = -lastCombined.Chunk
+		tx.Size = lastCombined.Size
+		tx.SizeUnit = lastCombined.SizeUnit
+		tx.Speed = lastCombined.Speed
+		tx.SpeedUnit = lastCombined.SpeedUnit
+		tx.Class = lastCombined.Class
+		tx.Throttle = lastCombined.Throttle
+		tx.Level = lastCombined.Level
+
+		lastCombined.Chunk-- // combined chunks are numbered -7,-6,..,-1
+	} else if strings.HasPrefix(tx.FName, "Multiple small files batched in one request") {
+		// combinedHeader
+		tx.Type = combinedHeader
+		_, err := fmt.Sscanf(tx.FName, "Multiple small files batched in one request, the %d files are listed below:", &tx.Chunk)
+		if err != nil || tx.Chunk <= 0 {
+			return tx, fmt.Errorf("%w: combined header: %q", errMalformed, tx.FName)
 		}
-		if preBeginOfPath == -1 {
-			preBeginOfPath = strings.Index(line, " - Multiple")
+		if err := scanSpeedSize(mid, &tx); err != nil {
+			return tx, err
 		}
-		// flaky because numerical fields sometime skew things
-		if preBeginOfPath != -1 && preBeginOfPath != 87 && preBeginOfPath != 88 && preBeginOfPath != 89 && preBeginOfPath != 80 {
-			fmt.Fprintf(os.Stderr, "-= Unexpected line structure (might be ok)\n")
-			fmt.Fprintf(os.Stderr, "-begin: %d |%s|\n", preBeginOfPath, line)
-			fmt.Fprintf(os.Stderr, "+begin: %d |%s|\n", preBeginOfPath, line[preBeginOfPath+3:])
+		// now spread the size into tx.chunk parts!
+		tx.Size = tx.Size / tx.Chunk
+		tx.SizeUnit = "bytes*" //estimated
+	} else if strings.HasPrefix(tx.FName, "Chunk") {
+		// chunked
+		tx.Type = chunked
+		chunk, fname, err := parseChunk(tx.FName)
+		if err != nil {
+			return tx, err
 		}
-		mid := line[22:preBeginOfPath]
-		tx.FName = line[preBeginOfPath+3:]
-
-		if len(strings.TrimSpace(mid)) == 0 {
-			// combinedContinued
-			tx.Type = combinedContinued
-			//  No other (non-default) fields required
-			tx.Chunk = -lastCombined.Chunk
-			tx.Size = lastCombined.Size
-			tx.SizeUnit = lastCombined.SizeUnit
-			tx.Speed = lastCombined.Speed
-			tx.SpeedUnit = lastCombined.SpeedUnit
-
-			lastCombined.Chunk-- // combined chunks are numbered -7,-6,..,-1
-		} else if strings.HasPrefix(tx.FName, "Multiple small files batched in one request") {
-			// combinedHeader
-			tx.Type = combinedHeader
-			_, err := fmt.Sscanf(tx.FName, "Multiple small files batched in one request, the %d files are listed below:", &tx.Chunk)
-			if err != nil {
-				log.Printf("Unable to parse combinedHeader record:\n%s", line)
-				log.Fatal(err)
-			}
-			fields := strings.SplitN(mid, " - ", 4)
-			// ignore errors, default struct values are OK
-			fmt.Sscanf(strings.TrimSpace(fields[2]), "%d %s", &tx.Speed, &tx.SpeedUnit)
-			fmt.Sscanf(strings.TrimSpace(fields[3]), "%d %s", &tx.Size, &tx.SizeUnit)
-			// now spread the size into tx.chunk parts!
-			tx.Size = tx.Size / tx.Chunk
-			tx.SizeUnit = "bytes*" //estimated
-		} else if strings.HasPrefix(tx.FName, "Chunk") {
-			// chunked
-			tx.Type = chunked
-			_, err := fmt.Sscanf(tx.FName, "Chunk %x of", &tx.Chunk)
-			tx.FName = tx.FName[15:len(tx.FName)]
-			if err != nil {
-				log.Printf("Unable to parse chunked record:\n%s", line)
-				log.Fatal(err)
-			}
-			fields := strings.SplitN(mid, " - ", 4)
-			// ignore errors, default struct values are OK
-			fmt.Sscanf(strings.TrimSpace(fields[2]), "%d %s", &tx.Speed, &tx.SpeedUnit)
-			fmt.Sscanf(strings.TrimSpace(fields[3]), "%d %s", &tx.Size, &tx.SizeUnit)
-			// fmt.Printf("chunked:%d: %s\n", txtyp, line)
-			// fmt.Printf("|%s|%s|%s|\n", tx.Stamp, mid, tx.FName)
-			// fmt.Printf("chunked:%d: %#v\n", txtyp, tx)
-		} else {
-			// normal
-			tx.Type = normal
-			fields := strings.SplitN(mid, " - ", 4)
-			// ignore errors, default struct values are OK
-			fmt.Sscanf(strings.TrimSpace(fields[2]), "%d %s", &tx.Speed, &tx.SpeedUnit)
-			fmt.Sscanf(strings.TrimSpace(fields[3]), "%d %s", &tx.Size, &tx.SizeUnit)
-			// fmt.Printf("normal:%d: %s\n", txtyp, line)
-			// fmt.Printf("|%s|%s|%s|\n", tx.Stamp, mid, tx.FName)
-			// fmt.Printf("normal:%d: %#v\n", txtyp, tx)
+		tx.Chunk, tx.FName = chunk, fname
+		if err := scanSpeedSize(mid, &tx); err != nil {
+			return tx, err
+		}
+	} else {
+		// normal
+		tx.Type = normal
+		if err := scanSpeedSize(mid, &tx); err != nil {
+			return tx, err
 		}
-
 	}
-	return tx
+	return tx, nil
 }
@@ -2,7 +2,9 @@ package backblaze
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 	"reflect"
@@ -98,10 +100,10 @@ func TestSplitFieldsByType(t *testing.T) {
 			name: "Empty",
 			in:   "\n  \n \t \n",
 			out: []Transmitted{
-				Transmitted{Type: "Empty", Stamp: "", Speed: 0, SpeedUnit: "", Size: 0, SizeUnit: "", Chunk: 0, FName: ""},
-				Transmitted{Type: "Empty", Stamp: "", Speed: 0, SpeedUnit: "", Size: 0, SizeUnit: "", Chunk: 0, FName: ""},
-				Transmitted{Type: "Empty", Stamp: "", Speed: 0, SpeedUnit: "", Size: 0, SizeUnit: "", Chunk: 0, FName: ""},
-				Transmitted{Type: "Empty", Stamp: "", Speed: 0, SpeedUnit: "", Size: 0, SizeUnit: "", Chunk: 0, FName: ""},
+				Transmitted{Type: "Empty", Stamp: "", Speed: 0, SpeedUnit: "", Size: 0, SizeUnit: "", Chunk: 0, FName: "", Class: "", Throttle: "", Level: 0},
+				Transmitted{Type: "Empty", Stamp: "", Speed: 0, SpeedUnit: "", Size: 0, SizeUnit: "", Chunk: 0, FName: "", Class: "", Throttle: "", Level: 0},
+				Transmitted{Type: "Empty", Stamp: "", Speed: 0, SpeedUnit: "", Size: 0, SizeUnit: "", Chunk: 0, FName: "", Class: "", Throttle: "", Level: 0},
+				Transmitted{Type: "Empty", Stamp: "", Speed: 0, SpeedUnit: "", Size: 0, SizeUnit: "", Chunk: 0, FName: "", Class: "", Throttle: "", Level: 0},
 			},
 		},
 		{
@@ -111,10 +113,10 @@ func TestSplitFieldsByType(t *testing.T) {
 2018-10-02 02:39:30 -  large  - throttle manual   11 -  3450 kBits/sec -  7827914 bytes - /Volumes/Space/archive/media/mp3/creative/Binye (Respect)/08-Seourouba.mp3
 2018-10-02 02:39:36 -  large  - throttle manual   11 -  4972 kBits/sec -  7832042 bytes - /Volumes/Space/archive/media/mp3/peered/Brazil-Rodrigo/Cantoria 1 - Elomar, Geraldo Azevedo, Vital Faria e Xangai - 1984/09 Cantiga do Estradar.mp3`,
 			out: []Transmitted{
-				Transmitted{Type: "Normal", Stamp: "2018-10-02 13:27:18", Speed: 3112, SpeedUnit: "kBits/sec", Size: 30460266, SizeUnit: "bytes", Chunk: 0, FName: "/Volumes/Space/archive/media/video/PMB/12-23-2008(1)/20081219122438.mpg"},
-				Transmitted{Type: "Normal", Stamp: "2018-10-17 18:39:45", Speed: 8, SpeedUnit: "kBits/sec", Size: 1, SizeUnit: "bytes", Chunk: 0, FName: "/Volumes/Space/fake_filename_to_refresh_volume_dashboard.txt"},
-				Transmitted{Type: "Normal", Stamp: "2018-10-02 02:39:30", Speed: 3450, SpeedUnit: "kBits/sec", Size: 7827914, SizeUnit: "bytes", Chunk: 0, FName: "/Volumes/Space/archive/media/mp3/creative/Binye (Respect)/08-Seourouba.mp3"},
-				Transmitted{Type: "Normal", Stamp: "2018-10-02 02:39:36", Speed: 4972, SpeedUnit: "kBits/sec", Size: 7832042, SizeUnit: "bytes", Chunk: 0, FName: "/Volumes/Space/archive/media/mp3/peered/Brazil-Rodrigo/Cantoria 1 - Elomar, Geraldo Azevedo, Vital Faria e Xangai - 1984/09 Cantiga do Estradar.mp3"},
+				Transmitted{Type: "Normal", Stamp: "2018-10-02 13:27:18", Speed: 3112, SpeedUnit: "kBits/sec", Size: 30460266, SizeUnit: "bytes", Chunk: 0, FName: "/Volumes/Space/archive/media/video/PMB/12-23-2008(1)/20081219122438.mpg", Class: "large", Throttle: "manual", Level: 11},
+				Transmitted{Type: "Normal", Stamp: "2018-10-17 18:39:45", Speed: 8, SpeedUnit: "kBits/sec", Size: 1, SizeUnit: "bytes", Chunk: 0, FName: "/Volumes/Space/fake_filename_to_refresh_volume_dashboard.txt", Class: "small", Throttle: "auto", Level: 11},
+				Transmitted{Type: "Normal", Stamp: "2018-10-02 02:39:30", Speed: 3450, SpeedUnit: "kBits/sec", Size: 7827914, SizeUnit: "bytes", Chunk: 0, FName: "/Volumes/Space/archive/media/mp3/creative/Binye (Respect)/08-Seourouba.mp3", Class: "large", Throttle: "manual", Level: 11},
+				Transmitted{Type: "Normal", Stamp: "2018-10-02 02:39:36", Speed: 4972, SpeedUnit: "kBits/sec", Size: 7832042, SizeUnit: "bytes", Chunk: 0, FName: "/Volumes/Space/archive/media/mp3/peered/Brazil-Rodrigo/Cantoria 1 - Elomar, Geraldo Azevedo, Vital Faria e Xangai - 1984/09 Cantiga do Estradar.mp3", Class: "large", Throttle: "manual", Level: 11},
 			},
 		},
 		{
@@ -122,8 +124,8 @@ func TestSplitFieldsByType(t *testing.T) {
 			in: `2018-10-01 03:35:31 -  small  - throttle x           -           dedup - 0 bytes - /Users/daniel/.bash_sessions/34D616D0-93F6-4AF2-AD60-9A5D4B83C76A.historynew
 2018-10-01 03:35:48 -  small  - throttle x           -           dedup - 0 bytes - /Volumes/Space/archive/media/photo/dadSulbalcon/200308/Catherine35Ans2003/130-3052_IMG.JPG`,
 			out: []Transmitted{
-				Transmitted{Type: "Dedup", Stamp: "2018-10-01 03:35:31", Speed: 0, SpeedUnit: "", Size: 0, SizeUnit: "bytes", Chunk: 0, FName: "/Users/daniel/.bash_sessions/34D616D0-93F6-4AF2-AD60-9A5D4B83C76A.historynew"},
-				Transmitted{Type: "Dedup", Stamp: "2018-10-01 03:35:48", Speed: 0, SpeedUnit: "", Size: 0, SizeUnit: "bytes", Chunk: 0, FName: "/Volumes/Space/archive/media/photo/dadSulbalcon/200308/Catherine35Ans2003/130-3052_IMG.JPG"},
+				Transmitted{Type: "Dedup", Stamp: "2018-10-01 03:35:31", Speed: 0, SpeedUnit: "", Size: 0, SizeUnit: "bytes", Chunk: 0, FName: "/Users/daniel/.bash_sessions/34D616D0-93F6-4AF2-AD60-9A5D4B83C76A.historynew", Class: "small", Throttle: "x", Level: 0},
+				Transmitted{Type: "Dedup", Stamp: "2018-10-01 03:35:48", Speed: 0, SpeedUnit: "", Size: 0, SizeUnit: "bytes", Chunk: 0, FName: "/Volumes/Space/archive/media/photo/dadSulbalcon/200308/Catherine35Ans2003/130-3052_IMG.JPG", Class: "small", Throttle: "x", Level: 0},
 			},
 		},
 		{
@@ -131,8 +133,8 @@ func TestSplitFieldsByType(t *testing.T) {
 			in: `2018-10-02 13:32:57 -  small  - throttle x           -           dedup - 0 bytes - Chunk 00000 of /Users/daniel/GoogleDrive/Jobs/Sologlobe/Sologlobe  Mar 08,2013  03 40 PM.QBB
 2018-10-02 13:32:57 -  small  - throttle x           -           dedup - 0 bytes - Chunk 00001 of /Users/daniel/GoogleDrive/Jobs/Sologlobe/Sologlobe  Mar 08,2013  03 40 PM.QBB`,
 			out: []Transmitted{
-				Transmitted{Type: "DedupChunked", Stamp: "2018-10-02 13:32:57", Speed: 0, SpeedUnit: "", Size: 0, SizeUnit: "bytes", Chunk: 0, FName: "/Users/daniel/GoogleDrive/Jobs/Sologlobe/Sologlobe  Mar 08,2013  03 40 PM.QBB"},
-				Transmitted{Type: "DedupChunked", Stamp: "2018-10-02 13:32:57", Speed: 0, SpeedUnit: "", Size: 0, SizeUnit: "bytes", Chunk: 1, FName: "/Users/daniel/GoogleDrive/Jobs/Sologlobe/Sologlobe  Mar 08,2013  03 40 PM.QBB"},
+				Transmitted{Type: "DedupChunked", Stamp: "2018-10-02 13:32:57", Speed: 0, SpeedUnit: "", Size: 0, SizeUnit: "bytes", Chunk: 0, FName: "/Users/daniel/GoogleDrive/Jobs/Sologlobe/Sologlobe  Mar 08,2013  03 40 PM.QBB", Class: "small", Throttle: "x", Level: 0},
+				Transmitted{Type: "DedupChunked", Stamp: "2018-10-02 13:32:57", Speed: 0, SpeedUnit: "", Size: 0, SizeUnit: "bytes", Chunk: 1, FName: "/Users/daniel/GoogleDrive/Jobs/Sologlobe/Sologlobe  Mar 08,2013  03 40 PM.QBB", Class: "small", Throttle: "x", Level: 0},
 			},
 		},
 		{
@@ -142,10 +144,10 @@ func TestSplitFieldsByType(t *testing.T) {
 2018-10-01 15:25:14 -                                                                   - /Volumes/Space/archive/media/photo/catou/2007-07-04-lesours/IMG_4941.JPG
 2018-10-01 15:25:14 -                                                                   - /Users/daniel/GoogleDrive/Google Photos/2013/12/IMG_1490.JPG`,
 			out: []Transmitted{
-				Transmitted{Type: "CombinedHeader", Stamp: "2018-10-01 15:25:14", Speed: 3822, SpeedUnit: "kBits/sec", Size: 3489825, SizeUnit: "bytes*", Chunk: 3, FName: "Multiple small files batched in one request, the 3 files are listed below:"},
-				Transmitted{Type: "CombinedContinued", Stamp: "2018-10-01 15:25:14", Speed: 3822, SpeedUnit: "kBits/sec", Size: 3489825, SizeUnit: "bytes*", Chunk: -3, FName: "/Volumes/Space/archive/media/photo/catou/2005_11_02-R/IMG_0927.JPG"},
-				Transmitted{Type: "CombinedContinued", Stamp: "2018-10-01 15:25:14", Speed: 3822, SpeedUnit: "kBits/sec", Size: 3489825, SizeUnit: "bytes*", Chunk: -2, FName: "/Volumes/Space/archive/media/photo/catou/2007-07-04-lesours/IMG_4941.JPG"},
-				Transmitted{Type: "CombinedContinued", Stamp: "2018-10-01 15:25:14", Speed: 3822, SpeedUnit: "kBits/sec", Size: 3489825, SizeUnit: "bytes*", Chunk: -1, FName: "/Users/daniel/GoogleDrive/Google Photos/2013/12/IMG_1490.JPG"},
+				Transmitted{Type: "CombinedHeader", Stamp: "2018-10-01 15:25:14", Speed: 3822, SpeedUnit: "kBits/sec", Size: 3489825, SizeUnit: "bytes*", Chunk: 3, FName: "Multiple small files batched in one request, the 3 files are listed below:", Class: "large", Throttle: "manual", Level: 11},
+				Transmitted{Type: "CombinedContinued", Stamp: "2018-10-01 15:25:14", Speed: 3822, SpeedUnit: "kBits/sec", Size: 3489825, SizeUnit: "bytes*", Chunk: -3, FName: "/Volumes/Space/archive/media/photo/catou/2005_11_02-R/IMG_0927.JPG", Class: "large", Throttle: "manual", Level: 11},
+				Transmitted{Type: "CombinedContinued", Stamp: "2018-10-01 15:25:14", Speed: 3822, SpeedUnit: "kBits/sec", Size: 3489825, SizeUnit: "bytes*", Chunk: -2, FName: "/Volumes/Space/archive/media/photo/catou/2007-07-04-lesours/IMG_4941.JPG", Class: "large", Throttle: "manual", Level: 11},
+				Transmitted{Type: "CombinedContinued", Stamp: "2018-10-01 15:25:14", Speed: 3822, SpeedUnit: "kBits/sec", Size: 3489825, SizeUnit: "bytes*", Chunk: -1, FName: "/Users/daniel/GoogleDrive/Google Photos/2013/12/IMG_1490.JPG", Class: "large", Throttle: "manual", Level: 11},
 			},
 		},
 		{
@@ -154,9 +156,9 @@ func TestSplitFieldsByType(t *testing.T) {
 2018-10-11 10:49:35 -  large  - throttle auto     11 -  1973 kBits/sec -   634794 bytes - Chunk 0052a of /Users/daniel/Library/Containers/com.docker.docker/Data/vms/0/Docker.qcow2
 2018-10-11 10:49:37 -  large  - throttle auto     11 -  2604 kBits/sec -   834682 bytes - Chunk 00545 of /Users/daniel/Library/Containers/com.docker.docker/Data/vms/0/Docker.qcow2`,
 			out: []Transmitted{
-				Transmitted{Type: "Chunked", Stamp: "2018-10-11 10:49:34", Speed: 1643, SpeedUnit: "kBits/sec", Size: 410714, SizeUnit: "bytes", Chunk: 1305, FName: "/Users/daniel/Library/Containers/com.docker.docker/Data/vms/0/Docker.qcow2"},
-				Transmitted{Type: "Chunked", Stamp: "2018-10-11 10:49:35", Speed: 1973, SpeedUnit: "kBits/sec", Size: 634794, SizeUnit: "bytes", Chunk: 1322, FName: "/Users/daniel/Library/Containers/com.docker.docker/Data/vms/0/Docker.qcow2"},
-				Transmitted{Type: "Chunked", Stamp: "2018-10-11 10:49:37", Speed: 2604, SpeedUnit: "kBits/sec", Size: 834682, SizeUnit: "bytes", Chunk: 1349, FName: "/Users/daniel/Library/Containers/com.docker.docker/Data/vms/0/Docker.qcow2"},
+				Transmitted{Type: "Chunked", Stamp: "2018-10-11 10:49:34", Speed: 1643, SpeedUnit: "kBits/sec", Size: 410714, SizeUnit: "bytes", Chunk: 1305, FName: "/Users/daniel/Library/Containers/com.docker.docker/Data/vms/0/Docker.qcow2", Class: "large", Throttle: "auto", Level: 11},
+				Transmitted{Type: "Chunked", Stamp: "2018-10-11 10:49:35", Speed: 1973, SpeedUnit: "kBits/sec", Size: 634794, SizeUnit: "bytes", Chunk: 1322, FName: "/Users/daniel/Library/Containers/com.docker.docker/Data/vms/0/Docker.qcow2", Class: "large", Throttle: "auto", Level: 11},
+				Transmitted{Type: "Chunked", Stamp: "2018-10-11 10:49:37", Speed: 2604, SpeedUnit: "kBits/sec", Size: 834682, SizeUnit: "bytes", Chunk: 1349, FName: "/Users/daniel/Library/Containers/com.docker.docker/Data/vms/0/Docker.qcow2", Class: "large", Throttle: "auto", Level: 11},
 			},
 		},
 	}
@@ -169,7 +171,10 @@ func TestSplitFieldsByType(t *testing.T) {
 			for _, line := range lines {
 				var tx Transmitted
 				if isFastMethod {
-					tx = splitFieldsFast(line, &lastCombined)
+					var err error
+					if tx, err = splitFieldsFast(line, &lastCombined); err != nil {
+						t.Fatalf("%v: %q", err, line)
+					}
 				} else {
 					tx = splitFields(line, &lastCombined)
 				}
@@ -195,36 +200,36 @@ func TestSplitFields(t *testing.T) {
 		{
 			filename: "./test/data/transmitted.log",
 			out: []Transmitted{
-				Transmitted{Type: "Normal", Stamp: "2018-10-02 13:27:18", Speed: 3112, SpeedUnit: "kBits/sec", Size: 30460266, SizeUnit: "bytes", Chunk: 0, FName: "/Volumes/Space/archive/media/video/PMB/12-23-2008(1)/20081219122438.mpg"},
-				Transmitted{Type: "Dedup", Stamp: "2018-10-10 01:40:42", Speed: 0, SpeedUnit: "", Size: 0, SizeUnit: "bytes", Chunk: 0, FName: "/Users/daniel/Library/Containers/com.evernote.Evernote/Data/Library/Application Support/com.evernote.Evernote/puppetmaster/OutputsCache.json"},
-				Transmitted{Type: "CombinedHeader", Stamp: "2018-10-01 15:25:14", Speed: 3822, SpeedUnit: "kBits/sec", Size: 3489825, SizeUnit: "bytes*", Chunk: 3, FName: "Multiple small files batched in one request, the 3 files are listed below:"},
-				Transmitted{Type: "CombinedContinued", Stamp: "2018-10-01 15:25:14", Speed: 3822, SpeedUnit: "kBits/sec", Size: 3489825, SizeUnit: "bytes*", Chunk: -3, FName: "/Volumes/Space/archive/media/photo/catou/2005_11_02-R/IMG_0927.JPG"},
-				Transmitted{Type: "CombinedContinued", Stamp: "2018-10-01 15:25:14", Speed: 3822, SpeedUnit: "kBits/sec", Size: 3489825, SizeUnit: "bytes*", Chunk: -2, FName: "/Volumes/Space/archive/media/photo/catou/2007-07-04-lesours/IMG_4941.JPG"},
-				Transmitted{Type: "CombinedContinued", Stamp: "2018-10-01 15:25:14", Speed: 3822, SpeedUnit: "kBits/sec", Size: 3489825, SizeUnit: "bytes*", Chunk: -1, FName: "/Users/daniel/GoogleDrive/Google Photos/2013/12/IMG_1490.JPG"},
-				Transmitted{Type: "Chunked", Stamp: "2018-10-11 10:49:34", Speed: 1643, SpeedUnit: "kBits/sec", Size: 410714, SizeUnit: "bytes", Chunk: 1305, FName: "/Users/daniel/Library/Containers/com.docker.docker/Data/vms/0/Docker.qcow2"},
-				Transmitted{Type: "Chunked", Stamp: "2018-10-11 10:49:35", Speed: 1973, SpeedUnit: "kBits/sec", Size: 634794, SizeUnit: "bytes", Chunk: 1322, FName: "/Users/daniel/Library/Containers/com.docker.docker/Data/vms/0/Docker.qcow2"},
-				Transmitted{Type: "Chunked", Stamp: "2018-10-11 10:49:37", Speed: 2604, SpeedUnit: "kBits/sec", Size: 834682, SizeUnit: "bytes", Chunk: 1349, FName: "/Users/daniel/Library/Containers/com.docker.docker/Data/vms/0/Docker.qcow2"},
+				Transmitted{Type: "Normal", Stamp: "2018-10-02 13:27:18", Speed: 3112, SpeedUnit: "kBits/sec", Size: 30460266, SizeUnit: "bytes", Chunk: 0, FName: "/Volumes/Space/archive/media/video/PMB/12-23-2008(1)/20081219122438.mpg", Class: "large", Throttle: "manual", Level: 11},
+				Transmitted{Type: "Dedup", Stamp: "2018-10-10 01:40:42", Speed: 0, SpeedUnit: "", Size: 0, SizeUnit: "bytes", Chunk: 0, FName: "/Users/daniel/Library/Containers/com.evernote.Evernote/Data/Library/Application Support/com.evernote.Evernote/puppetmaster/OutputsCache.json", Class: "small", Throttle: "x", Level: 0},
+				Transmitted{Type: "CombinedHeader", Stamp: "2018-10-01 15:25:14", Speed: 3822, SpeedUnit: "kBits/sec", Size: 3489825, SizeUnit: "bytes*", Chunk: 3, FName: "Multiple small files batched in one request, the 3 files are listed below:", Class: "large", Throttle: "manual", Level: 11},
+				Transmitted{Type: "CombinedContinued", Stamp: "2018-10-01 15:25:14", Speed: 3822, SpeedUnit: "kBits/sec", Size: 3489825, SizeUnit: "bytes*", Chunk: -3, FName: "/Volumes/Space/archive/media/photo/catou/2005_11_02-R/IMG_0927.JPG", Class: "large", Throttle: "manual", Level: 11},
+				Transmitted{Type: "CombinedContinued", Stamp: "2018-10-01 15:25:14", Speed: 3822, SpeedUnit: "kBits/sec", Size: 3489825, SizeUnit: "bytes*", Chunk: -2, FName: "/Volumes/Space/archive/media/photo/catou/2007-07-04-lesours/IMG_4941.JPG", Class: "large", Throttle: "manual", Level: 11},
+				Transmitted{Type: "CombinedContinued", Stamp: "2018-10-01 15:25:14", Speed: 3822, SpeedUnit: "kBits/sec", Size: 3489825, SizeUnit: "bytes*", Chunk: -1, FName: "/Users/daniel/GoogleDrive/Google Photos/2013/12/IMG_1490.JPG", Class: "large", Throttle: "manual", Level: 11},
+				Transmitted{Type: "Chunked", Stamp: "2018-10-11 10:49:34", Speed: 1643, SpeedUnit: "kBits/sec", Size: 410714, SizeUnit: "bytes", Chunk: 1305, FName: "/Users/daniel/Library/Containers/com.docker.docker/Data/vms/0/Docker.qcow2", Class: "large", Throttle: "auto", Level: 11},
+				Transmitted{Type: "Chunked", Stamp: "2018-10-11 10:49:35", Speed: 1973, SpeedUnit: "kBits/sec", Size: 634794, SizeUnit: "bytes", Chunk: 1322, FName: "/Users/daniel/Library/Containers/com.docker.docker/Data/vms/0/Docker.qcow2", Class: "large", Throttle: "auto", Level: 11},
+				Transmitted{Type: "Chunked", Stamp: "2018-10-11 10:49:37", Speed: 2604, SpeedUnit: "kBits/sec", Size: 834682, SizeUnit: "bytes", Chunk: 1349, FName: "/Users/daniel/Library/Containers/com.docker.docker/Data/vms/0/Docker.qcow2", Class: "large", Throttle: "auto", Level: 11},
 			},
 		},
 		{
 			filename: "./test/data/transmitted-sample.log",
 			out: []Transmitted{
 
-				Transmitted{Type: "Empty", Stamp: "", Speed: 0, SpeedUnit: "", Size: 0, SizeUnit: "", Chunk: 0, FName: ""},
+				Transmitted{Type: "Empty", Stamp: "", Speed: 0, SpeedUnit: "", Size: 0, SizeUnit: "", Chunk: 0, FName: "", Class: "", Throttle: "", Level: 0},
 				// special case with different width: /Volumes/Space/fake_filename_to_refresh_volume_dashboard.txt
-				Transmitted{Type: "Normal", Stamp: "2018-10-17 18:39:45", Speed: 8, SpeedUnit: "kBits/sec", Size: 1, SizeUnit: "bytes", Chunk: 0, FName: "/Volumes/Space/fake_filename_to_refresh_volume_dashboard.txt"},
-				Transmitted{Type: "Normal", Stamp: "2018-10-02 02:39:30", Speed: 3450, SpeedUnit: "kBits/sec", Size: 7827914, SizeUnit: "bytes", Chunk: 0, FName: "/Volumes/Space/archive/media/mp3/creative/Binye (Respect)/08-Seourouba.mp3"},
-				Transmitted{Type: "Normal", Stamp: "2018-10-02 02:39:36", Speed: 4972, SpeedUnit: "kBits/sec", Size: 7832042, SizeUnit: "bytes", Chunk: 0, FName: "/Volumes/Space/archive/media/mp3/peered/Brazil-Rodrigo/Cantoria 1 - Elomar, Geraldo Azevedo, Vital Faria e Xangai - 1984/09 Cantiga do Estradar.mp3"},
-				Transmitted{Type: "Dedup", Stamp: "2018-10-01 03:35:31", Speed: 0, SpeedUnit: "", Size: 0, SizeUnit: "bytes", Chunk: 0, FName: "/Users/daniel/.bash_sessions/34D616D0-93F6-4AF2-AD60-9A5D4B83C76A.historynew"},
-				Transmitted{Type: "Dedup", Stamp: "2018-10-01 03:35:48", Speed: 0, SpeedUnit: "", Size: 0, SizeUnit: "bytes", Chunk: 0, FName: "/Volumes/Space/archive/media/photo/dadSulbalcon/200308/Catherine35Ans2003/130-3052_IMG.JPG"},
-				Transmitted{Type: "DedupChunked", Stamp: "2018-10-02 13:32:57", Speed: 0, SpeedUnit: "", Size: 0, SizeUnit: "bytes", Chunk: 0, FName: "/Users/daniel/GoogleDrive/Jobs/Sologlobe/Sologlobe  Mar 08,2013  03 40 PM.QBB"},
-				Transmitted{Type: "DedupChunked", Stamp: "2018-10-02 13:32:57", Speed: 0, SpeedUnit: "", Size: 0, SizeUnit: "bytes", Chunk: 1, FName: "/Users/daniel/GoogleDrive/Jobs/Sologlobe/Sologlobe  Mar 08,2013  03 40 PM.QBB"},
-				Transmitted{Type: "CombinedHeader", Stamp: "2018-10-01 00:00:18", Speed: 3429, SpeedUnit: "kBits/sec", Size: 1616376, SizeUnit: "bytes*", Chunk: 7, FName: "Multiple small files batched in one request, the 7 files are listed below:"},
-				Transmitted{Type: "CombinedHeader", Stamp: "2018-10-01 00:00:22", Speed: 2632, SpeedUnit: "kBits/sec", Size: 1645021, SizeUnit: "bytes*", Chunk: 7, FName: "Multiple small files batched in one request, the 7 files are listed below:"},
-				Transmitted{Type: "CombinedContinued", Stamp: "2018-10-01 00:00:18", Speed: 2632, SpeedUnit: "kBits/sec", Size: 1645021, SizeUnit: "bytes*", Chunk: -7, FName: "/Volumes/Space/archive/media/photo/dad/2003/2003_08_23/129-2919_IMG.JPG"},
-				Transmitted{Type: "CombinedContinued", Stamp: "2018-10-01 00:00:18", Speed: 2632, SpeedUnit: "kBits/sec", Size: 1645021, SizeUnit: "bytes*", Chunk: -6, FName: "/Volumes/Space/archive/media/photo/dad/2003/2003_07_06/125-2583_IMG.JPG"},
-				Transmitted{Type: "Chunked", Stamp: "2018-10-02 13:30:58", Speed: 28, SpeedUnit: "kBits/sec", Size: 7290, SizeUnit: "bytes", Chunk: 3, FName: "/Volumes/Space/archive/media/ebooks/ebook-1100/Over 1100 General Computer Ebooks/The UNIX CD Bookshelf, v3.0 (2003).zip"},
-				Transmitted{Type: "Chunked", Stamp: "2018-10-02 13:31:15", Speed: 4143, SpeedUnit: "kBits/sec", Size: 10486490, SizeUnit: "bytes", Chunk: 0, FName: "/Volumes/Space/archive/media/ebooks/ebook-1100/Over 1100 General Computer Ebooks/The UNIX CD Bookshelf, v3.0 (2003).zip"},
+				Transmitted{Type: "Normal", Stamp: "2018-10-17 18:39:45", Speed: 8, SpeedUnit: "kBits/sec", Size: 1, SizeUnit: "bytes", Chunk: 0, FName: "/Volumes/Space/fake_filename_to_refresh_volume_dashboard.txt", Class: "small", Throttle: "auto", Level: 11},
+				Transmitted{Type: "Normal", Stamp: "2018-10-02 02:39:30", Speed: 3450, SpeedUnit: "kBits/sec", Size: 7827914, SizeUnit: "bytes", Chunk: 0, FName: "/Volumes/Space/archive/media/mp3/creative/Binye (Respect)/08-Seourouba.mp3", Class: "large", Throttle: "manual", Level: 11},
+				Transmitted{Type: "Normal", Stamp: "2018-10-02 02:39:36", Speed: 4972, SpeedUnit: "kBits/sec", Size: 7832042, SizeUnit: "bytes", Chunk: 0, FName: "/Volumes/Space/archive/media/mp3/peered/Brazil-Rodrigo/Cantoria 1 - Elomar, Geraldo Azevedo, Vital Faria e Xangai - 1984/09 Cantiga do Estradar.mp3", Class: "large", Throttle: "manual", Level: 11},
+				Transmitted{Type: "Dedup", Stamp: "2018-10-01 03:35:31", Speed: 0, SpeedUnit: "", Size: 0, SizeUnit: "bytes", Chunk: 0, FName: "/Users/daniel/.bash_sessions/34D616D0-93F6-4AF2-AD60-9A5D4B83C76A.historynew", Class: "small", Throttle: "x", Level: 0},
+				Transmitted{Type: "Dedup", Stamp: "2018-10-01 03:35:48", Speed: 0, SpeedUnit: "", Size: 0, SizeUnit: "bytes", Chunk: 0, FName: "/Volumes/Space/archive/media/photo/dadSulbalcon/200308/Catherine35Ans2003/130-3052_IMG.JPG", Class: "small", Throttle: "x", Level: 0},
+				Transmitted{Type: "DedupChunked", Stamp: "2018-10-02 13:32:57", Speed: 0, SpeedUnit: "", Size: 0, SizeUnit: "bytes", Chunk: 0, FName: "/Users/daniel/GoogleDrive/Jobs/Sologlobe/Sologlobe  Mar 08,2013  03 40 PM.QBB", Class: "small", Throttle: "x", Level: 0},
+				Transmitted{Type: "DedupChunked", Stamp: "2018-10-02 13:32:57", Speed: 0, SpeedUnit: "", Size: 0, SizeUnit: "bytes", Chunk: 1, FName: "/Users/daniel/GoogleDrive/Jobs/Sologlobe/Sologlobe  Mar 08,2013  03 40 PM.QBB", Class: "small", Throttle: "x", Level: 0},
+				Transmitted{Type: "CombinedHeader", Stamp: "2018-10-01 00:00:18", Speed: 3429, SpeedUnit: "kBits/sec", Size: 1616376, SizeUnit: "bytes*", Chunk: 7, FName: "Multiple small files batched in one request, the 7 files are listed below:", Class: "large", Throttle: "manual", Level: 11},
+				Transmitted{Type: "CombinedHeader", Stamp: "2018-10-01 00:00:22", Speed: 2632, SpeedUnit: "kBits/sec", Size: 1645021, SizeUnit: "bytes*", Chunk: 7, FName: "Multiple small files batched in one request, the 7 files are listed below:", Class: "large", Throttle: "manual", Level: 11},
+				Transmitted{Type: "CombinedContinued", Stamp: "2018-10-01 00:00:18", Speed: 2632, SpeedUnit: "kBits/sec", Size: 1645021, SizeUnit: "bytes*", Chunk: -7, FName: "/Volumes/Space/archive/media/photo/dad/2003/2003_08_23/129-2919_IMG.JPG", Class: "large", Throttle: "manual", Level: 11},
+				Transmitted{Type: "CombinedContinued", Stamp: "2018-10-01 00:00:18", Speed: 2632, SpeedUnit: "kBits/sec", Size: 1645021, SizeUnit: "bytes*", Chunk: -6, FName: "/Volumes/Space/archive/media/photo/dad/2003/2003_07_06/125-2583_IMG.JPG", Class: "large", Throttle: "manual", Level: 11},
+				Transmitted{Type: "Chunked", Stamp: "2018-10-02 13:30:58", Speed: 28, SpeedUnit: "kBits/sec", Size: 7290, SizeUnit: "bytes", Chunk: 3, FName: "/Volumes/Space/archive/media/ebooks/ebook-1100/Over 1100 General Computer Ebooks/The UNIX CD Bookshelf, v3.0 (2003).zip", Class: "small", Throttle: "manual", Level: 11},
+				Transmitted{Type: "Chunked", Stamp: "2018-10-02 13:31:15", Speed: 4143, SpeedUnit: "kBits/sec", Size: 10486490, SizeUnit: "bytes", Chunk: 0, FName: "/Volumes/Space/archive/media/ebooks/ebook-1100/Over 1100 General Computer Ebooks/The UNIX CD Bookshelf, v3.0 (2003).zip", Class: "large", Throttle: "manual", Level: 11},
 			},
 		},
 	}
@@ -242,7 +247,10 @@ func TestSplitFields(t *testing.T) {
 				line := scanner.Text()
 				var tx Transmitted
 				if isFastMethod {
-					tx = splitFieldsFast(line, &lastCombined)
+					var err error
+					if tx, err = splitFieldsFast(line, &lastCombined); err != nil {
+						t.Fatalf("%v: %q", err, line)
+					}
 				} else {
 					tx = splitFields(line, &lastCombined)
 				}
@@ -270,26 +278,26 @@ func TestParseTransmited(t *testing.T) {
 		{
 			filename: "./test/data/transmitted.log",
 			out: []Transmitted{
-				Transmitted{Type: "Normal", Stamp: "2018-10-02 13:27:18", Speed: 3112, SpeedUnit: "kBits/sec", Size: 30460266, SizeUnit: "bytes", Chunk: 0, FName: "/Volumes/Space/archive/media/video/PMB/12-23-2008(1)/20081219122438.mpg"},
-				Transmitted{Type: "CombinedContinued", Stamp: "2018-10-01 15:25:14", Speed: 3822, SpeedUnit: "kBits/sec", Size: 3489825, SizeUnit: "bytes*", Chunk: -3, FName: "/Volumes/Space/archive/media/photo/catou/2005_11_02-R/IMG_0927.JPG"},
-				Transmitted{Type: "CombinedContinued", Stamp: "2018-10-01 15:25:14", Speed: 3822, SpeedUnit: "kBits/sec", Size: 3489825, SizeUnit: "bytes*", Chunk: -2, FName: "/Volumes/Space/archive/media/photo/catou/2007-07-04-lesours/IMG_4941.JPG"},
-				Transmitted{Type: "CombinedContinued", Stamp: "2018-10-01 15:25:14", Speed: 3822, SpeedUnit: "kBits/sec", Size: 3489825, SizeUnit: "bytes*", Chunk: -1, FName: "/Users/daniel/GoogleDrive/Google Photos/2013/12/IMG_1490.JPG"},
-				Transmitted{Type: "Chunked", Stamp: "2018-10-11 10:49:34", Speed: 1643, SpeedUnit: "kBits/sec", Size: 410714, SizeUnit: "bytes", Chunk: 1305, FName: "/Users/daniel/Library/Containers/com.docker.docker/Data/vms/0/Docker.qcow2"},
-				Transmitted{Type: "Chunked", Stamp: "2018-10-11 10:49:35", Speed: 1973, SpeedUnit: "kBits/sec", Size: 634794, SizeUnit: "bytes", Chunk: 1322, FName: "/Users/daniel/Library/Containers/com.docker.docker/Data/vms/0/Docker.qcow2"},
-				Transmitted{Type: "Chunked", Stamp: "2018-10-11 10:49:37", Speed: 2604, SpeedUnit: "kBits/sec", Size: 834682, SizeUnit: "bytes", Chunk: 1349, FName: "/Users/daniel/Library/Containers/com.docker.docker/Data/vms/0/Docker.qcow2"},
+				Transmitted{Type: "Normal", Stamp: "2018-10-02 13:27:18", Speed: 3112, SpeedUnit: "kBits/sec", Size: 30460266, SizeUnit: "bytes", Chunk: 0, FName: "/Volumes/Space/archive/media/video/PMB/12-23-2008(1)/20081219122438.mpg", Class: "large", Throttle: "manual", Level: 11},
+				Transmitted{Type: "CombinedContinued", Stamp: "2018-10-01 15:25:14", Speed: 3822, SpeedUnit: "kBits/sec", Size: 3489825, SizeUnit: "bytes*", Chunk: -3, FName: "/Volumes/Space/archive/media/photo/catou/2005_11_02-R/IMG_0927.JPG", Class: "large", Throttle: "manual", Level: 11},
+				Transmitted{Type: "CombinedContinued", Stamp: "2018-10-01 15:25:14", Speed: 3822, SpeedUnit: "kBits/sec", Size: 3489825, SizeUnit: "bytes*", Chunk: -2, FName: "/Volumes/Space/archive/media/photo/catou/2007-07-04-lesours/IMG_4941.JPG", Class: "large", Throttle: "manual", Level: 11},
+				Transmitted{Type: "CombinedContinued", Stamp: "2018-10-01 15:25:14", Speed: 3822, SpeedUnit: "kBits/sec", Size: 3489825, SizeUnit: "bytes*", Chunk: -1, FName: "/Users/daniel/GoogleDrive/Google Photos/2013/12/IMG_1490.JPG", Class: "large", Throttle: "manual", Level: 11},
+				Transmitted{Type: "Chunked", Stamp: "2018-10-11 10:49:34", Speed: 1643, SpeedUnit: "kBits/sec", Size: 410714, SizeUnit: "bytes", Chunk: 1305, FName: "/Users/daniel/Library/Containers/com.docker.docker/Data/vms/0/Docker.qcow2", Class: "large", Throttle: "auto", Level: 11},
+				Transmitted{Type: "Chunked", Stamp: "2018-10-11 10:49:35", Speed: 1973, SpeedUnit: "kBits/sec", Size: 634794, SizeUnit: "bytes", Chunk: 1322, FName: "/Users/daniel/Library/Containers/com.docker.docker/Data/vms/0/Docker.qcow2", Class: "large", Throttle: "auto", Level: 11},
+				Transmitted{Type: "Chunked", Stamp: "2018-10-11 10:49:37", Speed: 2604, SpeedUnit: "kBits/sec", Size: 834682, SizeUnit: "bytes", Chunk: 1349, FName: "/Users/daniel/Library/Containers/com.docker.docker/Data/vms/0/Docker.qcow2", Class: "large", Throttle: "auto", Level: 11},
 			},
 		},
 		{
 			filename: "./test/data/transmitted-sample.log",
 			out: []Transmitted{
 
-				Transmitted{Type: "Normal", Stamp: "2018-10-17 18:39:45", Speed: 8, SpeedUnit: "kBits/sec", Size: 1, SizeUnit: "bytes", Chunk: 0, FName: "/Volumes/Space/fake_filename_to_refresh_volume_dashboard.txt"},
-				Transmitted{Type: "Normal", Stamp: "2018-10-02 02:39:30", Speed: 3450, SpeedUnit: "kBits/sec", Size: 7827914, SizeUnit: "bytes", Chunk: 0, FName: "/Volumes/Space/archive/media/mp3/creative/Binye (Respect)/08-Seourouba.mp3"},
-				Transmitted{Type: "Normal", Stamp: "2018-10-02 02:39:36", Speed: 4972, SpeedUnit: "kBits/sec", Size: 7832042, SizeUnit: "bytes", Chunk: 0, FName: "/Volumes/Space/archive/media/mp3/peered/Brazil-Rodrigo/Cantoria 1 - Elomar, Geraldo Azevedo, Vital Faria e Xangai - 1984/09 Cantiga do Estradar.mp3"},
-				Transmitted{Type: "CombinedContinued", Stamp: "2018-10-01 00:00:18", Speed: 2632, SpeedUnit: "kBits/sec", Size: 1645021, SizeUnit: "bytes*", Chunk: -7, FName: "/Volumes/Space/archive/media/photo/dad/2003/2003_08_23/129-2919_IMG.JPG"},
-				Transmitted{Type: "CombinedContinued", Stamp: "2018-10-01 00:00:18", Speed: 2632, SpeedUnit: "kBits/sec", Size: 1645021, SizeUnit: "bytes*", Chunk: -6, FName: "/Volumes/Space/archive/media/photo/dad/2003/2003_07_06/125-2583_IMG.JPG"},
-				Transmitted{Type: "Chunked", Stamp: "2018-10-02 13:30:58", Speed: 28, SpeedUnit: "kBits/sec", Size: 7290, SizeUnit: "bytes", Chunk: 3, FName: "/Volumes/Space/archive/media/ebooks/ebook-1100/Over 1100 General Computer Ebooks/The UNIX CD Bookshelf, v3.0 (2003).zip"},
-				Transmitted{Type: "Chunked", Stamp: "2018-10-02 13:31:15", Speed: 4143, SpeedUnit: "kBits/sec", Size: 10486490, SizeUnit: "bytes", Chunk: 0, FName: "/Volumes/Space/archive/media/ebooks/ebook-1100/Over 1100 General Computer Ebooks/The UNIX CD Bookshelf, v3.0 (2003).zip"}},
+				Transmitted{Type: "Normal", Stamp: "2018-10-17 18:39:45", Speed: 8, SpeedUnit: "kBits/sec", Size: 1, SizeUnit: "bytes", Chunk: 0, FName: "/Volumes/Space/fake_filename_to_refresh_volume_dashboard.txt", Class: "small", Throttle: "auto", Level: 11},
+				Transmitted{Type: "Normal", Stamp: "2018-10-02 02:39:30", Speed: 3450, SpeedUnit: "kBits/sec", Size: 7827914, SizeUnit: "bytes", Chunk: 0, FName: "/Volumes/Space/archive/media/mp3/creative/Binye (Respect)/08-Seourouba.mp3", Class: "large", Throttle: "manual", Level: 11},
+				Transmitted{Type: "Normal", Stamp: "2018-10-02 02:39:36", Speed: 4972, SpeedUnit: "kBits/sec", Size: 7832042, SizeUnit: "bytes", Chunk: 0, FName: "/Volumes/Space/archive/media/mp3/peered/Brazil-Rodrigo/Cantoria 1 - Elomar, Geraldo Azevedo, Vital Faria e Xangai - 1984/09 Cantiga do Estradar.mp3", Class: "large", Throttle: "manual", Level: 11},
+				Transmitted{Type: "CombinedContinued", Stamp: "2018-10-01 00:00:18", Speed: 2632, SpeedUnit: "kBits/sec", Size: 1645021, SizeUnit: "bytes*", Chunk: -7, FName: "/Volumes/Space/archive/media/photo/dad/2003/2003_08_23/129-2919_IMG.JPG", Class: "large", Throttle: "manual", Level: 11},
+				Transmitted{Type: "CombinedContinued", Stamp: "2018-10-01 00:00:18", Speed: 2632, SpeedUnit: "kBits/sec", Size: 1645021, SizeUnit: "bytes*", Chunk: -6, FName: "/Volumes/Space/archive/media/photo/dad/2003/2003_07_06/125-2583_IMG.JPG", Class: "large", Throttle: "manual", Level: 11},
+				Transmitted{Type: "Chunked", Stamp: "2018-10-02 13:30:58", Speed: 28, SpeedUnit: "kBits/sec", Size: 7290, SizeUnit: "bytes", Chunk: 3, FName: "/Volumes/Space/archive/media/ebooks/ebook-1100/Over 1100 General Computer Ebooks/The UNIX CD Bookshelf, v3.0 (2003).zip", Class: "small", Throttle: "manual", Level: 11},
+				Transmitted{Type: "Chunked", Stamp: "2018-10-02 13:31:15", Speed: 4143, SpeedUnit: "kBits/sec", Size: 10486490, SizeUnit: "bytes", Chunk: 0, FName: "/Volumes/Space/archive/media/ebooks/ebook-1100/Over 1100 General Computer Ebooks/The UNIX CD Bookshelf, v3.0 (2003).zip", Class: "large", Throttle: "manual", Level: 11}},
 		},
 	}
 	for _, tt := range data {
@@ -315,3 +323,38 @@ func vslice(s []Transmitted) string {
 	}
 	return str
 }
+
+func TestSplitFieldsFastMalformed(t *testing.T) {
+	normal := "2018-10-02 13:27:18 -  large  - throttle manual   11 -  3112 kBits/sec - 30460266 bytes - /Volumes/Space/archive/media/video/PMB/12-23-2008(1)/20081219122438.mpg"
+	for _, line := range []string{
+		normal[:30],
+		normal[:88],
+		"2018-10-13 10:55:33 -  small  - throttle x           -           dedup - 0 bytes - Chunk 0050",
+		"2018-10-13 10:55:33 -  small  - throttle x           -           dedup - 0 bytes - Chunk zz of /a",
+		"2018-10-01 15:25:14 -  large  - throttle manual   11 -  3822 kBits/sec - 10469477 bytes - Multiple small files batched in one request, the x files",
+		"2018-10-02 13:31:15 -  large  - throttle manual   11 - 10486490 bytes - Chunk 00000 of /Volumes/Space/archive/a.zip",
+	} {
+		lastCombined := Transmitted{}
+		if _, err := splitFieldsFast(line, &lastCombined); !errors.Is(err, errMalformed) {
+			t.Errorf("expected a malformed line error, got %v: %q", err, line)
+		}
+	}
+}
+
+func TestReadTransmittedTruncated(t *testing.T) {
+	data, err := ioutil.ReadFile("test/data/transmitted-sample.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	// a line cut short in the middle, and the last one truncated
+	corrupt := strings.Join(lines[:3], "") + lines[3][:40] + "\n" + strings.Join(lines[4:len(lines)-2], "") + lines[len(lines)-2][:50]
+	got, err := scanTransmitted(strings.NewReader(corrupt), true)
+	var malformed *MalformedError
+	if !errors.As(err, &malformed) || malformed.Lines != 2 || malformed.Line != 4 {
+		t.Fatalf("expected 2 malformed lines, the first at line 4, got %v", err)
+	}
+	if expected := len(sampleTransmitted(t)) - 2; len(got) != expected {
+		t.Errorf("expected the %d other records, got %d", expected, len(got))
+	}
+}
@@ -10,6 +10,16 @@ let dataURL = "data/galoisFlow.json";
 // let dataURL = "data/diracFlow.json";
 // let dataURL = 'data/fermatFlow.json'
 
+// hosts in the dropdown, replaced by data/hosts.json when bzAgent collect maintains it
+let hosts = [
+  "galois",
+  "davinci",
+  "dirac",
+  "fermat",
+  "dirac-initial",
+  "fermat-initial",
+];
+
 const svg = d3
   .select("body")
   .append("svg")
@@ -133,14 +143,7 @@ function dropdown() {
 
   select
     .selectAll("option")
-    .data([
-      "galois",
-      "davinci",
-      "dirac",
-      "fermat",
-      "dirac-initial",
-      "fermat-initial",
-    ])
+    .data(hosts)
     .enter()
     .append("option")
     .attr("selected", (d) => {
@@ -291,6 +294,7 @@ fetchTransformAndDraw();
 
 async function fetchTransformAndDraw() {
   // const data = await unemploymentData()
+  await loadHosts();
   const data = await bzData();
 
   // In the file, this is the structure:
@@ -305,6 +309,69 @@ async function fetchTransformAndDraw() {
   // ]
 
   render(transform(data));
+  await markers();
+}
+
+// hosts pushed by bzAgent, if any: the first one is shown, unless the current one is among them
+async function loadHosts() {
+  try {
+    const pushed = await d3.json("data/hosts.json");
+    if (pushed && pushed.length > 0) {
+      hosts = pushed;
+      if (!hosts.some((h) => dataURL === `data/${h}Flow.json`)) {
+        dataURL = `data/${hosts[0]}Flow.json`;
+      }
+    }
+  } catch (err) {
+    // no data/hosts.json: keep the static list
+  }
+}
+
+// anomalies (from bzFlow -output anomalies), if any, drawn as markers:
+// full lines for the whole host (name "/"), dashed for a directory group
+async function markers() {
+  const anomaliesURL = dataURL.replace(/Flow\.json$/, "Anomalies.json");
+  let anomalies;
+  try {
+    anomalies = await d3.json(anomaliesURL);
+  } catch (err) {
+    return; // no anomalies for this host
+  }
+  const [from, to] = x.domain();
+  const kindColor = (d) => (d.kind === "spike" ? "#d62728" : "#1f77b4");
+  const marker = svg
+    .append("g")
+    .attr("class", "markers")
+    .selectAll("g")
+    .data(
+      (anomalies || [])
+        .map((d) => ({ ...d, date: new Date(d.date) }))
+        .filter((d) => d.date >= from && d.date <= to)
+    )
+    .enter()
+    .append("g")
+    .attr("transform", (d) => `translate(${x(d.date)},${margin.top})`);
+
+  marker
+    .append("line")
+    .attr("y2", height - margin.top - margin.bottom)
+    .style("pointer-events", "none")
+    .style("stroke", kindColor)
+    .style("stroke-opacity", 0.6)
+    .style("stroke-dasharray", (d) => (d.name === "/" ? null : "2,2"));
+
+  marker
+    .append("path")
+    .attr("d", d3.symbol().type(d3.symbolTriangle).size(60))
+    .attr("transform", (d) => (d.kind === "spike" ? null : "rotate(180)"))
+    .style("fill", kindColor)
+    .append("title")
+    .text(
+      (d) =>
+        `${d.date.toISOString().substring(0, 10)} ${d.kind}: ${d.name} ${
+          d.value
+        } (median ${d.median})`
+    );
 }
 
 function transform(data) {
@@ -0,0 +1,242 @@
+package backblaze
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// WhatIfReport simulates a change to the exclusion rules against the current filelists and fileids:
+// which files would start being backed up (no longer excluded),
+// and which would stop being backed up (newly excluded)
+type WhatIfReport struct {
+	Added   []string     `json:"added"`
+	Removed []string     `json:"removed"`
+	Start   FileTotal    `json:"start"`
+	Stop    FileTotal    `json:"stop"`
+	Dirs    []WhatIfDir  `json:"dirs"`
+	Files   []WhatIfFile `json:"files"`
+
+	current  ExclusionRules
+	proposed ExclusionRules
+	dirs     map[string]*WhatIfDir
+}
+
+// FileTotal is a count of files and their total size
+type FileTotal struct {
+	Files int   `json:"files"`
+	Bytes int64 `json:"bytes"`
+}
+
+func (total *FileTotal) add(size int64) {
+	total.Files++
+	total.Bytes += size
+}
+
+// WhatIfDir is the change for the files directly in a directory
+type WhatIfDir struct {
+	Dir   string    `json:"dir"`
+	Start FileTotal `json:"start"`
+	Stop  FileTotal `json:"stop"`
+}
+
+// WhatIfFile is a file which would change: Change is "start" or "stop"
+type WhatIfFile struct {
+	Change  string   `json:"change"`
+	Path    string   `json:"path"`
+	Size    int64    `json:"size"`
+	Reasons []string `json:"reasons"`
+}
+
+// NewWhatIfReport compares the current rules with those after adding and removing rules,
+// it fails if a removed rule is not a current one
+func NewWhatIfReport(current, added, removed ExclusionRules) (*WhatIfReport, error) {
+	proposed, err := current.Apply(added, removed)
+	if err != nil {
+		return nil, err
+	}
+	report := &WhatIfReport{
+		Added:    make([]string, 0, len(added)),
+		Removed:  make([]string, 0, len(removed)),
+		Dirs:     make([]WhatIfDir, 0),
+		Files:    make([]WhatIfFile, 0),
+		current:  current,
+		proposed: proposed,
+		dirs:     make(map[string]*WhatIfDir),
+	}
+	for _, rule := range added {
+		report.Added = append(report.Added, rule.String())
+	}
+	for _, rule := range removed {
+		report.Removed = append(report.Removed, rule.String())
+	}
+	return report, nil
+}
+
+// AddBackedUp considers a file which is currently backed up:
+// it stops being backed up if the proposed rules exclude it, and the current ones did not
+func (report *WhatIfReport) AddBackedUp(path string, size int64) {
+	reasons := report.proposed.Explain(path)
+	if len(reasons) == 0 || len(report.current.Explain(path)) > 0 {
+		return
+	}
+	report.Stop.add(size)
+	report.dir(path).Stop.add(size)
+	report.Files = append(report.Files, WhatIfFile{Change: "stop", Path: path, Size: size, Reasons: reasons})
+}
+
+// AddNotBackedUp considers a file which is currently not backed up:
+// it starts being backed up if the current rules explain it, and the proposed ones do not.
+// Files no rule explains stay as they are, we do not know why they are not backed up.
+func (report *WhatIfReport) AddNotBackedUp(path string, size int64) {
+	reasons := report.current.Explain(path)
+	if len(reasons) == 0 || len(report.proposed.Explain(path)) > 0 {
+		return
+	}
+	report.Start.add(size)
+	report.dir(path).Start.add(size)
+	report.Files = append(report.Files, WhatIfFile{Change: "start", Path: path, Size: size, Reasons: reasons})
+}
+
+func (report *WhatIfReport) dir(path string) *WhatIfDir {
+	dir := filepath.Dir(path) + "/"
+	if dir == "//" {
+		dir = "/"
+	}
+	wd, ok := report.dirs[dir]
+	if !ok {
+		wd = &WhatIfDir{Dir: dir}
+		report.dirs[dir] = wd
+	}
+	return wd
+}
+
+// Rank fills in the topN affected directories, by bytes changed (either way),
+// and keeps only the topN largest changed files
+func (report *WhatIfReport) Rank(topN int) {
+	sort.Slice(report.Files, func(i, j int) bool {
+		if report.Files[i].Size == report.Files[j].Size {
+			return report.Files[i].Path < report.Files[j].Path
+		}
+		return report.Files[i].Size > report.Files[j].Size
+	})
+	if len(report.Files) > topN {
+		report.Files = report.Files[:topN]
+	}
+
+	report.Dirs = make([]WhatIfDir, 0, len(report.dirs))
+	for _, wd := range report.dirs {
+		report.Dirs = append(report.Dirs, *wd)
+	}
+	changed := func(wd WhatIfDir) int64 { return wd.Start.Bytes + wd.Stop.Bytes }
+	sort.Slice(report.Dirs, func(i, j int) bool {
+		if changed(report.Dirs[i]) == changed(report.Dirs[j]) {
+			return report.Dirs[i].Dir < report.Dirs[j].Dir
+		}
+		return changed(report.Dirs[i]) > changed(report.Dirs[j])
+	})
+	if len(report.Dirs) > topN {
+		report.Dirs = report.Dirs[:topN]
+	}
+}
+
+// WriteFormat writes the report in one of the Format* formats
+func (report *WhatIfReport) WriteFormat(w io.Writer, format string) error {
+	switch format {
+	case FormatText:
+		return report.WriteText(w)
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	case FormatJSONL:
+		return report.WriteJSONL(w)
+	case FormatCSV:
+		return report.WriteCSV(w)
+	}
+	return fmt.Errorf("unknown format: %q", format)
+}
+
+// WriteJSONL writes the totals, then one line per directory and per file,
+// each with a "record" field (total,dir,file)
+func (report *WhatIfReport) WriteJSONL(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	enc.Encode(struct {
+		Record  string    `json:"record"`
+		Added   []string  `json:"added"`
+		Removed []string  `json:"removed"`
+		Start   FileTotal `json:"start"`
+		Stop    FileTotal `json:"stop"`
+	}{"total", report.Added, report.Removed, report.Start, report.Stop})
+	for _, wd := range report.Dirs {
+		enc.Encode(struct {
+			Record string `json:"record"`
+			WhatIfDir
+		}{"dir", wd})
+	}
+	for _, wf := range report.Files {
+		enc.Encode(struct {
+			Record string `json:"record"`
+			WhatIfFile
+		}{"file", wf})
+	}
+	return bw.Flush()
+}
+
+// WriteCSV writes a single table, with a header: record,key,startFiles,startBytes,stopFiles,stopBytes
+func (report *WhatIfReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	row := func(record, key string, start, stop FileTotal) {
+		cw.Write([]string{record, key,
+			strconv.Itoa(start.Files), strconv.FormatInt(start.Bytes, 10),
+			strconv.Itoa(stop.Files), strconv.FormatInt(stop.Bytes, 10)})
+	}
+	cw.Write([]string{"record", "key", "startFiles", "startBytes", "stopFiles", "stopBytes"})
+	row("total", "", report.Start, report.Stop)
+	for _, wd := range report.Dirs {
+		row("dir", wd.Dir, wd.Start, wd.Stop)
+	}
+	for _, wf := range report.Files {
+		total := FileTotal{Files: 1, Bytes: wf.Size}
+		if wf.Change == "start" {
+			row("file", wf.Path, total, FileTotal{})
+		} else {
+			row("file", wf.Path, FileTotal{}, total)
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteText writes the report for humans
+func (report *WhatIfReport) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, rule := range report.Added {
+		fmt.Fprintf(bw, "WhatIf: + %s\n", rule)
+	}
+	for _, rule := range report.Removed {
+		fmt.Fprintf(bw, "WhatIf: - %s\n", rule)
+	}
+	fmt.Fprintf(bw, "WhatIf: would start being backed up: %d (%s)\n", report.Start.Files, HumanBytes(report.Start.Bytes))
+	fmt.Fprintf(bw, "WhatIf: would stop being backed up: %d (%s)\n", report.Stop.Files, HumanBytes(report.Stop.Bytes))
+	if len(report.Files) > 0 {
+		fmt.Fprintf(bw, "WhatIf: Largest files\n")
+		for _, wf := range report.Files {
+			fmt.Fprintf(bw, " %5s %10s : %s %v\n", wf.Change, HumanBytes(wf.Size), wf.Path, wf.Reasons)
+		}
+	}
+	if len(report.Dirs) > 0 {
+		fmt.Fprintf(bw, "WhatIf: Affected directories (start stop)\n")
+		for _, wd := range report.Dirs {
+			fmt.Fprintf(bw, " +%9d %10s -%9d %10s : %s\n",
+				wd.Start.Files, HumanBytes(wd.Start.Bytes), wd.Stop.Files, HumanBytes(wd.Stop.Bytes), wd.Dir)
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,76 @@
+package backblaze
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func testWhatIfReport(t *testing.T) *WhatIfReport {
+	infile, err := os.Open("./test/data/whatif.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer infile.Close()
+	added, removed, err := ParseRuleChanges(infile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// - suffix .iso
+	// + dir /Users/daniel/Downloads/
+	report, err := NewWhatIfReport(DefaultExclusionRules(), added, removed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// backed up
+	report.AddBackedUp("/Users/daniel/.bash_profile", 1200)         // unchanged
+	report.AddBackedUp("/Users/daniel/Downloads/notes.txt", 52000)  // stop
+	report.AddNotBackedUp("/Users/daniel/Downloads/ubuntu.iso", 42) // still excluded, by the dir
+	report.AddNotBackedUp("/Users/daniel/Desktop/old.iso", 1000)    // start
+	report.AddNotBackedUp("/Users/daniel/VMs/win10.vmdk", 4000)     // unchanged
+	report.AddNotBackedUp("/Volumes/Space/scratch/tmp.bin", 100)    // unexplained, unchanged
+	report.Rank(10)
+	return report
+}
+
+func TestWhatIfReport(t *testing.T) {
+	report := testWhatIfReport(t)
+	if report.Start != (FileTotal{Files: 1, Bytes: 1000}) {
+		t.Errorf("unexpected start: %#v", report.Start)
+	}
+	if report.Stop != (FileTotal{Files: 1, Bytes: 52000}) {
+		t.Errorf("unexpected stop: %#v", report.Stop)
+	}
+	dirs := []WhatIfDir{
+		{Dir: "/Users/daniel/Downloads/", Stop: FileTotal{Files: 1, Bytes: 52000}},
+		{Dir: "/Users/daniel/Desktop/", Start: FileTotal{Files: 1, Bytes: 1000}},
+	}
+	if !reflect.DeepEqual(dirs, report.Dirs) {
+		t.Errorf("expected:\n%#v\ngot:\n%#v", dirs, report.Dirs)
+	}
+	files := []WhatIfFile{
+		{Change: "stop", Path: "/Users/daniel/Downloads/notes.txt", Size: 52000, Reasons: []string{"dir:/users/daniel/downloads/"}},
+		{Change: "start", Path: "/Users/daniel/Desktop/old.iso", Size: 1000, Reasons: []string{"suffix:.iso"}},
+	}
+	if !reflect.DeepEqual(files, report.Files) {
+		t.Errorf("expected:\n%#v\ngot:\n%#v", files, report.Files)
+	}
+}
+
+func TestWhatIfReportCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testWhatIfReport(t).WriteFormat(&buf, FormatCSV); err != nil {
+		t.Fatal(err)
+	}
+	expected := `record,key,startFiles,startBytes,stopFiles,stopBytes
+total,,1,1000,1,52000
+dir,/Users/daniel/Downloads/,0,0,1,52000
+dir,/Users/daniel/Desktop/,1,1000,0,0
+file,/Users/daniel/Downloads/notes.txt,0,0,1,52000
+file,/Users/daniel/Desktop/old.iso,1,1000,0,0
+`
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}